@@ -319,6 +319,38 @@ resource "aws_iam_role_policy" "ec2_detailed_monitoring" {
   })
 }
 
+# AmazonSSMManagedInstanceCore allows ssm:GetParameter on all parameters,
+# deny reading the secrets of other RunsOn stacks in the same account
+resource "aws_iam_role_policy" "ec2_deny_other_stack_parameters" {
+  name = "DenyOtherStackParameters"
+  role = aws_iam_role.ec2_instance.id
+
+  policy = jsonencode({
+    Version = "2012-10-17"
+    Statement = [
+      {
+        Effect = "Deny"
+        Action = [
+          "ssm:GetParameter",
+          "ssm:GetParameters",
+          "ssm:GetParameterHistory"
+        ]
+        Resource = [
+          "arn:aws:ssm:${var.region}:${var.account_id}:parameter/*"
+        ]
+        Condition = {
+          Null = {
+            "aws:ResourceTag/runs-on-stack-name" = "false"
+          }
+          StringNotEquals = {
+            "aws:ResourceTag/runs-on-stack-name" = var.stack_name
+          }
+        }
+      }
+    ]
+  })
+}
+
 # EFS access policy (conditional)
 resource "aws_iam_role_policy" "ec2_efs_access" {
   count = var.enable_efs ? 1 : 0
@@ -354,4 +354,19 @@ resource "aws_apprunner_service" "this" {
       "runs-on-resource" = "apprunner-service" # Used for resource discovery
     }
   )
+
+  lifecycle {
+    # App Runner only supports these CPU/memory combinations. Checked here rather than in a variable
+    # validation, which cannot reference another variable before Terraform 1.9 / OpenTofu 1.8.
+    precondition {
+      condition = contains(try({
+        "256"  = [512, 1024]
+        "512"  = [1024]
+        "1024" = [2048, 3072, 4096]
+        "2048" = [4096, 6144]
+        "4096" = [8192, 10240, 12288]
+      }[tostring(var.app_cpu)], []), var.app_memory)
+      error_message = "Memory must match app_cpu: 256 (512, 1024), 512 (1024), 1024 (2048, 3072, 4096), 2048 (4096, 6144), 4096 (8192, 10240, 12288)."
+    }
+  }
 }
@@ -167,11 +167,16 @@ def handler(event, context):
         logger.error("Slack webhook URL is not configured")
         return {"statusCode": 500, "body": "Slack webhook URL is not configured"}
 
-    records = event.get("Records", [])
+    records = event.get("Records", []) if isinstance(event, dict) else []
+    if not isinstance(records, list):
+        records = []
     for record in records:
-        sns = record.get("Sns", {})
-        subject = sns.get("Subject", "")
-        message = sns.get("Message", "")
+        sns = record.get("Sns") if isinstance(record, dict) else None
+        if not isinstance(sns, dict):
+            logger.warning("Skipping record without an SNS message")
+            continue
+        subject = str(sns.get("Subject") or "")
+        message = sns.get("Message") or ""
 
         # Base payload with username and icon
         payload = {
@@ -182,9 +187,9 @@ def handler(event, context):
         # Try to parse message as JSON (CloudWatch alarms)
         try:
             alarm_data = json.loads(message)
-            if "AlarmName" in alarm_data:
+            if isinstance(alarm_data, dict) and "AlarmName" in alarm_data:
                 # CloudWatch alarm formatting
-                state = alarm_data.get("NewStateValue", "UNKNOWN")
+                state = str(alarm_data.get("NewStateValue", "UNKNOWN"))
                 state_emoji = {"ALARM": ":rotating_light:", "OK": ":white_check_mark:", "INSUFFICIENT_DATA": ":warning:"}.get(state, ":question:")
                 title = f"{state_emoji} CloudWatch Alarm: {state}"
                 text = f"*Alarm:* {alarm_data.get('AlarmName', 'N/A')}\n*Reason:* {alarm_data.get('NewStateReason', 'N/A')}"
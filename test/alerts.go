@@ -0,0 +1,428 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cloudwatchtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// =============================================================================
+// ALARM CONFIGURATION
+// =============================================================================
+
+// Defaults of the alerting inputs in variables.tf.
+const (
+	DefaultAppAlarmDailyMinutes                  = 4000
+	DefaultSQSQueueOldestMessageThresholdSeconds = 0 // Alarm disabled
+)
+
+// AlarmInputs are the stack outputs and module inputs the alarms in modules/core/cloudwatch.tf
+// are derived from.
+type AlarmInputs struct {
+	StackName             string
+	TopicARN              string // sns_topic_arn
+	AppRunnerServiceARN   string // apprunner_service_arn
+	MainQueueURL          string // sqs_queue_main_url
+	AppAlarmDailyMinutes  int    // app_alarm_daily_minutes
+	SQSOldestMessageLimit int    // sqs_queue_oldest_message_threshold_seconds, 0 disables the alarm
+}
+
+// GetAlarmInputs returns the alarm inputs of the stack deployed with options from config.
+func GetAlarmInputs(t *testing.T, options *terraform.Options, config ScenarioConfig) AlarmInputs {
+	inputs := AlarmInputs{
+		StackName:             terraform.Output(t, options, "stack_name"),
+		TopicARN:              terraform.Output(t, options, "sns_topic_arn"),
+		AppRunnerServiceARN:   terraform.Output(t, options, "apprunner_service_arn"),
+		MainQueueURL:          terraform.Output(t, options, "sqs_queue_main_url"),
+		AppAlarmDailyMinutes:  config.AppAlarmDailyMinutes,
+		SQSOldestMessageLimit: config.SQSQueueOldestMessageThresholdSeconds,
+	}
+	if inputs.AppAlarmDailyMinutes <= 0 {
+		inputs.AppAlarmDailyMinutes = DefaultAppAlarmDailyMinutes
+	}
+	if inputs.SQSOldestMessageLimit <= 0 {
+		inputs.SQSOldestMessageLimit = DefaultSQSQueueOldestMessageThresholdSeconds
+	}
+	return inputs
+}
+
+// AlarmExpectation is the configuration an alarm of the stack should have.
+type AlarmExpectation struct {
+	Name               string
+	Namespace          string
+	MetricName         string
+	Statistic          string
+	ComparisonOperator string
+	Threshold          float64
+	Period             int32
+	EvaluationPeriods  int32
+	TreatMissingData   string // Empty for the CloudWatch default (missing)
+	Dimensions         map[string]string
+	Actions            []string // Alarm and OK actions
+}
+
+// ExpectedAlarms returns the alarms the stack should have for inputs, and the names of the alarms
+// it should not have (the SQS alarm when its threshold is 0).
+func ExpectedAlarms(inputs AlarmInputs) (expected []AlarmExpectation, absent []string) {
+	serviceName := inputs.StackName // The App Runner service is named after the stack
+	expected = append(expected, AlarmExpectation{
+		Name:               inputs.StackName + "-app-daily-budget",
+		Namespace:          "AWS/AppRunner",
+		MetricName:         "ActiveInstances",
+		Statistic:          "Sum",
+		ComparisonOperator: "GreaterThanThreshold",
+		Threshold:          float64(inputs.AppAlarmDailyMinutes),
+		Period:             86400,
+		EvaluationPeriods:  1,
+		Dimensions:         map[string]string{"ServiceName": serviceName, "ServiceArn": inputs.AppRunnerServiceARN},
+		Actions:            []string{inputs.TopicARN},
+	})
+
+	sqsAlarm := inputs.StackName + "-sqs-main-oldest-message"
+	if inputs.SQSOldestMessageLimit <= 0 {
+		return expected, []string{sqsAlarm}
+	}
+	expected = append(expected, AlarmExpectation{
+		Name:               sqsAlarm,
+		Namespace:          "AWS/SQS",
+		MetricName:         "ApproximateAgeOfOldestMessage",
+		Statistic:          "Maximum",
+		ComparisonOperator: "GreaterThanOrEqualToThreshold",
+		Threshold:          float64(inputs.SQSOldestMessageLimit),
+		Period:             60,
+		EvaluationPeriods:  1,
+		TreatMissingData:   "notBreaching",
+		Dimensions:         map[string]string{"QueueName": queueNameFromURL(inputs.MainQueueURL)},
+		Actions:            []string{inputs.TopicARN},
+	})
+	return expected, nil
+}
+
+// queueNameFromURL returns the queue name of an SQS queue URL.
+func queueNameFromURL(queueURL string) string {
+	return queueURL[strings.LastIndex(queueURL, "/")+1:]
+}
+
+// CompareAlarm returns the differences between an alarm and its expected configuration.
+func CompareAlarm(expected AlarmExpectation, actual cloudwatchtypes.MetricAlarm) []string {
+	var diffs []string
+	check := func(field string, want, got interface{}) {
+		if fmt.Sprint(want) != fmt.Sprint(got) {
+			diffs = append(diffs, fmt.Sprintf("%s: expected %v, got %v", field, want, got))
+		}
+	}
+
+	check("Namespace", expected.Namespace, aws.ToString(actual.Namespace))
+	check("MetricName", expected.MetricName, aws.ToString(actual.MetricName))
+	check("Statistic", expected.Statistic, actual.Statistic)
+	check("ComparisonOperator", expected.ComparisonOperator, actual.ComparisonOperator)
+	check("Threshold", expected.Threshold, aws.ToFloat64(actual.Threshold))
+	check("Period", expected.Period, aws.ToInt32(actual.Period))
+	check("EvaluationPeriods", expected.EvaluationPeriods, aws.ToInt32(actual.EvaluationPeriods))
+	treatMissingData := expected.TreatMissingData
+	if treatMissingData == "" {
+		treatMissingData = "missing"
+	}
+	actualTreatMissingData := aws.ToString(actual.TreatMissingData)
+	if actualTreatMissingData == "" {
+		actualTreatMissingData = "missing"
+	}
+	check("TreatMissingData", treatMissingData, actualTreatMissingData)
+
+	dimensions := map[string]string{}
+	for _, dimension := range actual.Dimensions {
+		dimensions[aws.ToString(dimension.Name)] = aws.ToString(dimension.Value)
+	}
+	check("Dimensions", sortedPairs(expected.Dimensions), sortedPairs(dimensions))
+
+	check("AlarmActions", sortedCopy(expected.Actions), sortedCopy(actual.AlarmActions))
+	check("OKActions", sortedCopy(expected.Actions), sortedCopy(actual.OKActions))
+	if !aws.ToBool(actual.ActionsEnabled) {
+		diffs = append(diffs, "ActionsEnabled: expected true, got false")
+	}
+	return diffs
+}
+
+// sortedPairs renders a map as sorted key=value pairs.
+func sortedPairs(values map[string]string) []string {
+	pairs := make([]string, 0, len(values))
+	for key, value := range values {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return pairs
+}
+
+// sortedCopy returns a sorted copy of values.
+func sortedCopy(values []string) []string {
+	sorted := append([]string{}, values...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// ValidateAlarms checks that the stack's alarms match their inputs: thresholds, metrics,
+// dimensions and alarm/OK actions on the alerts topic.
+func ValidateAlarms(t *testing.T, inputs AlarmInputs) {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := cloudwatch.NewFromConfig(cfg)
+
+	expected, absent := ExpectedAlarms(inputs)
+	names := append([]string{}, absent...)
+	for _, alarm := range expected {
+		names = append(names, alarm.Name)
+	}
+
+	output, err := client.DescribeAlarms(ctx, &cloudwatch.DescribeAlarmsInput{
+		AlarmNames: names,
+		AlarmTypes: []cloudwatchtypes.AlarmType{cloudwatchtypes.AlarmTypeMetricAlarm},
+	})
+	require.NoError(t, err, "Failed to describe alarms")
+	alarms := map[string]cloudwatchtypes.MetricAlarm{}
+	for _, alarm := range output.MetricAlarms {
+		alarms[aws.ToString(alarm.AlarmName)] = alarm
+	}
+
+	for _, alarm := range expected {
+		actual, found := alarms[alarm.Name]
+		if !assert.True(t, found, "Alarm %s should exist", alarm.Name) {
+			continue
+		}
+		diffs := CompareAlarm(alarm, actual)
+		assert.Empty(t, diffs, "Alarm %s does not match its inputs", alarm.Name)
+		if len(diffs) == 0 {
+			t.Logf("✓ Alarm %s: %s %s %s %.0f, actions on %s", alarm.Name, alarm.Statistic, alarm.MetricName,
+				alarm.ComparisonOperator, alarm.Threshold, inputs.TopicARN)
+		}
+	}
+	for _, name := range absent {
+		assert.NotContains(t, alarms, name, "Alarm %s should not exist when its threshold is 0", name)
+	}
+}
+
+// =============================================================================
+// ALARM DELIVERY
+// =============================================================================
+
+// SNSMessage is an SNS message as delivered to SQS and HTTP(S) subscribers.
+type SNSMessage struct {
+	Type      string `json:"Type"`
+	MessageID string `json:"MessageId"`
+	TopicArn  string `json:"TopicArn"`
+	Subject   string `json:"Subject"`
+	Message   string `json:"Message"`
+	Timestamp string `json:"Timestamp"`
+
+	// Subscription confirmations only
+	Token        string `json:"Token"`
+	SubscribeURL string `json:"SubscribeURL"`
+
+	SignatureVersion string `json:"SignatureVersion"`
+	Signature        string `json:"Signature"`
+	SigningCertURL   string `json:"SigningCertURL"`
+	UnsubscribeURL   string `json:"UnsubscribeURL"`
+}
+
+// AlarmNotification is the message CloudWatch publishes to alarm and OK actions.
+type AlarmNotification struct {
+	AlarmName      string `json:"AlarmName"`
+	AlarmArn       string `json:"AlarmArn"`
+	NewStateValue  string `json:"NewStateValue"`
+	OldStateValue  string `json:"OldStateValue"`
+	NewStateReason string `json:"NewStateReason"`
+	Trigger        struct {
+		MetricName         string  `json:"MetricName"`
+		Namespace          string  `json:"Namespace"`
+		ComparisonOperator string  `json:"ComparisonOperator"`
+		Threshold          float64 `json:"Threshold"`
+		Dimensions         []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"Dimensions"`
+	} `json:"Trigger"`
+}
+
+// ParseAlarmNotification parses an SNS message body (as delivered to an SQS subscription without
+// raw message delivery) carrying a CloudWatch alarm notification.
+func ParseAlarmNotification(body []byte) (SNSMessage, AlarmNotification, error) {
+	var message SNSMessage
+	var notification AlarmNotification
+	if err := json.Unmarshal(body, &message); err != nil {
+		return message, notification, fmt.Errorf("failed to parse SNS message: %w", err)
+	}
+	if message.Type != "Notification" {
+		return message, notification, fmt.Errorf("SNS message is a %q, not a Notification", message.Type)
+	}
+	if err := json.Unmarshal([]byte(message.Message), &notification); err != nil {
+		return message, notification, fmt.Errorf("failed to parse alarm notification: %w", err)
+	}
+	if notification.AlarmName == "" {
+		return message, notification, fmt.Errorf("SNS message is not an alarm notification")
+	}
+	return message, notification, nil
+}
+
+// snsToSQSPolicy returns the queue policy that lets topicARN deliver to queueARN.
+func snsToSQSPolicy(queueARN, topicARN string) string {
+	policy, _ := json.Marshal(map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{{
+			"Effect":    "Allow",
+			"Principal": map[string]string{"Service": "sns.amazonaws.com"},
+			"Action":    "sqs:SendMessage",
+			"Resource":  queueARN,
+			"Condition": map[string]interface{}{"ArnEquals": map[string]string{"aws:SourceArn": topicARN}},
+		}},
+	})
+	return string(policy)
+}
+
+// SubscribeTestQueue creates an SQS queue subscribed to the topic and returns its URL. The
+// subscription and queue are deleted when the test ends.
+func SubscribeTestQueue(t *testing.T, topicARN string) string {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	sqsClient := sqs.NewFromConfig(cfg)
+	snsClient := sns.NewFromConfig(cfg)
+
+	topicName := topicARN[strings.LastIndex(topicARN, ":")+1:]
+	queue, err := sqsClient.CreateQueue(ctx, &sqs.CreateQueueInput{
+		QueueName: aws.String(fmt.Sprintf("%s-test-%d", topicName, time.Now().Unix())),
+	})
+	require.NoError(t, err, "Failed to create test queue")
+	queueURL := aws.ToString(queue.QueueUrl)
+	t.Cleanup(func() {
+		_, _ = sqsClient.DeleteQueue(ctx, &sqs.DeleteQueueInput{QueueUrl: aws.String(queueURL)})
+	})
+
+	attributes, err := sqsClient.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+		QueueUrl:       aws.String(queueURL),
+		AttributeNames: []sqstypes.QueueAttributeName{sqstypes.QueueAttributeNameQueueArn},
+	})
+	require.NoError(t, err, "Failed to get test queue ARN")
+	queueARN := attributes.Attributes[string(sqstypes.QueueAttributeNameQueueArn)]
+
+	_, err = sqsClient.SetQueueAttributes(ctx, &sqs.SetQueueAttributesInput{
+		QueueUrl:   aws.String(queueURL),
+		Attributes: map[string]string{string(sqstypes.QueueAttributeNamePolicy): snsToSQSPolicy(queueARN, topicARN)},
+	})
+	require.NoError(t, err, "Failed to allow %s to send to the test queue", topicName)
+
+	subscription, err := snsClient.Subscribe(ctx, &sns.SubscribeInput{
+		TopicArn:              aws.String(topicARN),
+		Protocol:              aws.String("sqs"),
+		Endpoint:              aws.String(queueARN),
+		ReturnSubscriptionArn: true,
+	})
+	require.NoError(t, err, "Failed to subscribe the test queue to %s", topicName)
+	t.Cleanup(func() {
+		_, _ = snsClient.Unsubscribe(ctx, &sns.UnsubscribeInput{SubscriptionArn: subscription.SubscriptionArn})
+	})
+
+	t.Logf("Subscribed test queue %s to %s", queueURL, topicName)
+	return queueURL
+}
+
+// ForceAlarmState sets the state of an alarm with SetAlarmState, which runs its actions. An alarm
+// already in that state is first set to the opposite state, so the change is always notified.
+// The reason should be unique, to find the resulting notification. The alarm returns to its
+// evaluated state at its next evaluation.
+func ForceAlarmState(t *testing.T, alarmName string, state cloudwatchtypes.StateValue, reason string) {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := cloudwatch.NewFromConfig(cfg)
+
+	output, err := client.DescribeAlarms(ctx, &cloudwatch.DescribeAlarmsInput{AlarmNames: []string{alarmName}})
+	require.NoError(t, err, "Failed to describe alarm %s", alarmName)
+	require.Len(t, output.MetricAlarms, 1, "Alarm %s should exist", alarmName)
+
+	if output.MetricAlarms[0].StateValue == state {
+		opposite := cloudwatchtypes.StateValueOk
+		if state == cloudwatchtypes.StateValueOk {
+			opposite = cloudwatchtypes.StateValueAlarm
+		}
+		_, err = client.SetAlarmState(ctx, &cloudwatch.SetAlarmStateInput{
+			AlarmName:   aws.String(alarmName),
+			StateValue:  opposite,
+			StateReason: aws.String(reason + " (reset)"),
+		})
+		require.NoError(t, err, "Failed to reset alarm %s to %s", alarmName, opposite)
+	}
+
+	_, err = client.SetAlarmState(ctx, &cloudwatch.SetAlarmStateInput{
+		AlarmName:   aws.String(alarmName),
+		StateValue:  state,
+		StateReason: aws.String(reason),
+	})
+	require.NoError(t, err, "Failed to set alarm %s to %s", alarmName, state)
+	t.Logf("Set alarm %s to %s", alarmName, state)
+}
+
+// WaitForAlarmNotification receives from an SQS subscription of the alerts topic until the
+// notification of alarmName entering state with the given reason arrives, and returns it.
+func WaitForAlarmNotification(t *testing.T, queueURL, alarmName, state, reason string, timeout time.Duration) (SNSMessage, AlarmNotification) {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := sqs.NewFromConfig(cfg)
+
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		output, err := client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:            aws.String(queueURL),
+			MaxNumberOfMessages: 10,
+			WaitTimeSeconds:     20,
+		})
+		require.NoError(t, err, "Failed to receive from %s", queueURL)
+
+		for _, received := range output.Messages {
+			_, _ = client.DeleteMessage(ctx, &sqs.DeleteMessageInput{QueueUrl: aws.String(queueURL), ReceiptHandle: received.ReceiptHandle})
+
+			message, notification, err := ParseAlarmNotification([]byte(aws.ToString(received.Body)))
+			if err != nil {
+				t.Logf("Ignoring message: %v", err)
+				continue
+			}
+			if notification.AlarmName == alarmName && notification.NewStateValue == state && notification.NewStateReason == reason {
+				return message, notification
+			}
+			t.Logf("Ignoring notification of %s entering %s", notification.AlarmName, notification.NewStateValue)
+		}
+	}
+	require.FailNow(t, "Alarm notification not delivered", "No %s notification of %s within %s", state, alarmName, timeout)
+	return SNSMessage{}, AlarmNotification{}
+}
+
+// ValidateAlarmDelivery forces each alarm of the stack into ALARM and checks that its notification
+// is delivered to an SQS subscription of the alerts topic, describing the alarm's metric.
+func ValidateAlarmDelivery(t *testing.T, inputs AlarmInputs) {
+	queueURL := SubscribeTestQueue(t, inputs.TopicARN)
+
+	expected, _ := ExpectedAlarms(inputs)
+	for _, alarm := range expected {
+		reason := fmt.Sprintf("terratest forced alarm %d", time.Now().UnixNano())
+		ForceAlarmState(t, alarm.Name, cloudwatchtypes.StateValueAlarm, reason)
+
+		message, notification := WaitForAlarmNotification(t, queueURL, alarm.Name, string(cloudwatchtypes.StateValueAlarm), reason, 3*time.Minute)
+		assert.Equal(t, inputs.TopicARN, message.TopicArn, "Notification should come from the alerts topic")
+		assert.Contains(t, message.Subject, alarm.Name, "Subject should name the alarm")
+		assert.Equal(t, alarm.MetricName, notification.Trigger.MetricName)
+		assert.Equal(t, alarm.Namespace, notification.Trigger.Namespace)
+		assert.Equal(t, alarm.Threshold, notification.Trigger.Threshold)
+		t.Logf("✓ %s notification of %s delivered to %s (message %s)", notification.NewStateValue, alarm.Name,
+			queueNameFromURL(queueURL), message.MessageID)
+	}
+}
@@ -0,0 +1,148 @@
+package test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cloudwatchtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testTopicARN = "arn:aws:sns:us-east-1:123456789012:test-alerts1-alerts"
+
+func testAlarmInputs() AlarmInputs {
+	return AlarmInputs{
+		StackName:             "test-alerts1",
+		TopicARN:              testTopicARN,
+		AppRunnerServiceARN:   "arn:aws:apprunner:us-east-1:123456789012:service/test-alerts1/0123456789abcdef",
+		MainQueueURL:          "https://sqs.us-east-1.amazonaws.com/123456789012/test-alerts1-main.fifo",
+		AppAlarmDailyMinutes:  1234,
+		SQSOldestMessageLimit: 600,
+	}
+}
+
+// metricAlarm builds the alarm CloudWatch would return for an expectation.
+func metricAlarm(expected AlarmExpectation) cloudwatchtypes.MetricAlarm {
+	alarm := cloudwatchtypes.MetricAlarm{
+		AlarmName:          aws.String(expected.Name),
+		Namespace:          aws.String(expected.Namespace),
+		MetricName:         aws.String(expected.MetricName),
+		Statistic:          cloudwatchtypes.Statistic(expected.Statistic),
+		ComparisonOperator: cloudwatchtypes.ComparisonOperator(expected.ComparisonOperator),
+		Threshold:          aws.Float64(expected.Threshold),
+		Period:             aws.Int32(expected.Period),
+		EvaluationPeriods:  aws.Int32(expected.EvaluationPeriods),
+		ActionsEnabled:     aws.Bool(true),
+		AlarmActions:       expected.Actions,
+		OKActions:          expected.Actions,
+	}
+	if expected.TreatMissingData != "" {
+		alarm.TreatMissingData = aws.String(expected.TreatMissingData)
+	}
+	for name, value := range expected.Dimensions {
+		alarm.Dimensions = append(alarm.Dimensions, cloudwatchtypes.Dimension{Name: aws.String(name), Value: aws.String(value)})
+	}
+	return alarm
+}
+
+func TestExpectedAlarms(t *testing.T) {
+	expected, absent := ExpectedAlarms(testAlarmInputs())
+	require.Len(t, expected, 2)
+	assert.Empty(t, absent)
+
+	budget := expected[0]
+	assert.Equal(t, "test-alerts1-app-daily-budget", budget.Name)
+	assert.Equal(t, 1234.0, budget.Threshold)
+	assert.Equal(t, map[string]string{
+		"ServiceName": "test-alerts1",
+		"ServiceArn":  "arn:aws:apprunner:us-east-1:123456789012:service/test-alerts1/0123456789abcdef",
+	}, budget.Dimensions)
+
+	sqsAlarm := expected[1]
+	assert.Equal(t, "test-alerts1-sqs-main-oldest-message", sqsAlarm.Name)
+	assert.Equal(t, 600.0, sqsAlarm.Threshold)
+	assert.Equal(t, map[string]string{"QueueName": "test-alerts1-main.fifo"}, sqsAlarm.Dimensions)
+	assert.Equal(t, []string{testTopicARN}, sqsAlarm.Actions)
+
+	// A threshold of 0 disables the SQS alarm
+	inputs := testAlarmInputs()
+	inputs.SQSOldestMessageLimit = DefaultSQSQueueOldestMessageThresholdSeconds
+	expected, absent = ExpectedAlarms(inputs)
+	assert.Len(t, expected, 1)
+	assert.Equal(t, []string{"test-alerts1-sqs-main-oldest-message"}, absent)
+}
+
+func TestCompareAlarm(t *testing.T) {
+	expected, _ := ExpectedAlarms(testAlarmInputs())
+	budget, sqsAlarm := expected[0], expected[1]
+
+	assert.Empty(t, CompareAlarm(budget, metricAlarm(budget)))
+	assert.Empty(t, CompareAlarm(sqsAlarm, metricAlarm(sqsAlarm)))
+
+	// Inputs not applied: default threshold, other queue, no OK action, default missing data handling
+	actual := metricAlarm(sqsAlarm)
+	actual.Threshold = aws.Float64(300)
+	actual.Dimensions = []cloudwatchtypes.Dimension{{Name: aws.String("QueueName"), Value: aws.String("test-alerts1-jobs.fifo")}}
+	actual.OKActions = nil
+	actual.TreatMissingData = nil
+	assert.Equal(t, []string{
+		"Threshold: expected 600, got 300",
+		"TreatMissingData: expected notBreaching, got missing",
+		"Dimensions: expected [QueueName=test-alerts1-main.fifo], got [QueueName=test-alerts1-jobs.fifo]",
+		"OKActions: expected [" + testTopicARN + "], got []",
+	}, CompareAlarm(sqsAlarm, actual))
+
+	actual = metricAlarm(budget)
+	actual.ActionsEnabled = aws.Bool(false)
+	actual.Statistic = cloudwatchtypes.StatisticAverage
+	assert.Equal(t, []string{
+		"Statistic: expected Sum, got Average",
+		"ActionsEnabled: expected true, got false",
+	}, CompareAlarm(budget, actual))
+}
+
+func TestParseAlarmNotification(t *testing.T) {
+	body, err := os.ReadFile(filepath.Join("testdata", "sns", "alarm-notification.json"))
+	require.NoError(t, err)
+
+	message, notification, err := ParseAlarmNotification(body)
+	require.NoError(t, err)
+	assert.Equal(t, testTopicARN, message.TopicArn)
+	assert.Equal(t, "8b2a5c1e-3f0d-5d7a-9c4e-2f6b1a7d9e01", message.MessageID)
+	assert.Equal(t, "test-alerts1-sqs-main-oldest-message", notification.AlarmName)
+	assert.Equal(t, "ALARM", notification.NewStateValue)
+	assert.Equal(t, "OK", notification.OldStateValue)
+	assert.Equal(t, "terratest forced alarm 1735787045000000000", notification.NewStateReason)
+	assert.Equal(t, "ApproximateAgeOfOldestMessage", notification.Trigger.MetricName)
+	assert.Equal(t, 600.0, notification.Trigger.Threshold)
+	require.Len(t, notification.Trigger.Dimensions, 1)
+	assert.Equal(t, "QueueName", notification.Trigger.Dimensions[0].Name)
+
+	_, _, err = ParseAlarmNotification([]byte(`{"Type": "SubscriptionConfirmation"}`))
+	assert.ErrorContains(t, err, "not a Notification")
+	_, _, err = ParseAlarmNotification([]byte(`{"Type": "Notification", "Message": "plain text"}`))
+	assert.ErrorContains(t, err, "failed to parse alarm notification")
+	_, _, err = ParseAlarmNotification([]byte(`{"Type": "Notification", "Message": "{}"}`))
+	assert.ErrorContains(t, err, "not an alarm notification")
+}
+
+func TestSNSToSQSPolicy(t *testing.T) {
+	queueARN := "arn:aws:sqs:us-east-1:123456789012:test-alerts1-alerts-test-1"
+	policy, err := ParsePolicyDocument(snsToSQSPolicy(queueARN, testTopicARN))
+	require.NoError(t, err)
+	require.Len(t, policy.Statement, 1)
+
+	var raw map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(snsToSQSPolicy(queueARN, testTopicARN)), &raw))
+	statement := raw["Statement"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"Service": "sns.amazonaws.com"}, statement["Principal"])
+
+	request := AccessRequest{Action: "sqs:SendMessage", Resource: queueARN, Context: map[string]string{"aws:SourceArn": testTopicARN}}
+	assert.Equal(t, AccessAllowed, EvaluateAccess([]PolicyDocument{policy}, request))
+	request.Context["aws:SourceArn"] = "arn:aws:sns:us-east-1:123456789012:other-alerts"
+	assert.Equal(t, AccessImplicitDeny, EvaluateAccess([]PolicyDocument{policy}, request), "Other topics cannot send")
+}
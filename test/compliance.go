@@ -0,0 +1,379 @@
+package test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// =============================================================================
+// COMPLIANCE CONTROLS
+// =============================================================================
+
+// Control IDs recorded by the Security/* and Compliance/* validators.
+const (
+	ControlS3EncryptionKMS     = "S3-ENCRYPTION-KMS"
+	ControlS3AccessLogging     = "S3-ACCESS-LOGGING"
+	ControlS3PublicAccessBlock = "S3-PUBLIC-ACCESS-BLOCK"
+	ControlIAMNoAdminPolicies  = "IAM-NO-ADMIN-POLICIES"
+	ControlS3Versioning        = "S3-VERSIONING"
+	ControlLogRetention        = "LOGS-RETENTION"
+)
+
+// ComplianceControlTitles describes each control in reports.
+var ComplianceControlTitles = map[string]string{
+	ControlS3EncryptionKMS:     "S3 buckets are encrypted at rest with SSE-KMS",
+	ControlS3AccessLogging:     "S3 buckets send server access logs to the logging bucket",
+	ControlS3PublicAccessBlock: "S3 buckets block all public access",
+	ControlIAMNoAdminPolicies:  "IAM roles have no administrative managed policies attached",
+	ControlS3Versioning:        "S3 bucket versioning matches the bucket's purpose",
+	ControlLogRetention:        "CloudWatch log groups have a retention policy",
+}
+
+// ControlMappings maps control IDs to framework references, e.g.
+// S3-ENCRYPTION-KMS -> "CIS AWS Foundations v1.4.0" -> ["2.1.1"].
+type ControlMappings map[string]map[string][]string
+
+// Framework names used by DefaultControlMappings.
+const (
+	FrameworkCIS  = "CIS AWS Foundations v1.4.0"
+	FrameworkSOC2 = "SOC 2"
+)
+
+// DefaultControlMappings is used unless RUNS_ON_TEST_CONTROL_MAPPING points at a mapping file.
+// Controls without a CIS recommendation of their own only map to SOC 2 criteria.
+var DefaultControlMappings = ControlMappings{
+	ControlS3EncryptionKMS:     {FrameworkCIS: {"2.1.1"}, FrameworkSOC2: {"CC6.1", "CC6.7"}},
+	ControlS3AccessLogging:     {FrameworkSOC2: {"CC7.2"}},
+	ControlS3PublicAccessBlock: {FrameworkCIS: {"2.1.5"}, FrameworkSOC2: {"CC6.1", "CC6.6"}},
+	ControlIAMNoAdminPolicies:  {FrameworkCIS: {"1.16"}, FrameworkSOC2: {"CC6.3"}},
+	ControlS3Versioning:        {FrameworkSOC2: {"A1.2"}},
+	ControlLogRetention:        {FrameworkSOC2: {"CC7.2"}},
+}
+
+// LoadControlMappings reads a YAML (or JSON) mapping file of the form:
+//
+//	S3-ENCRYPTION-KMS:
+//	  CIS AWS Foundations v1.4.0: ["2.1.1"]
+//	  SOC 2: ["CC6.1"]
+func LoadControlMappings(path string) (ControlMappings, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read control mapping: %w", err)
+	}
+	var mappings ControlMappings
+	if err := yaml.Unmarshal(data, &mappings); err != nil {
+		return nil, fmt.Errorf("failed to parse control mapping %s: %w", path, err)
+	}
+	return mappings, nil
+}
+
+// =============================================================================
+// COMPLIANCE REPORT
+// =============================================================================
+
+// ControlResult is the evidence for one control on one resource.
+type ControlResult struct {
+	ControlID  string              `json:"control_id"`
+	Title      string              `json:"title,omitempty"`
+	Test       string              `json:"test"`
+	Resource   string              `json:"resource"` // ARN of the checked resource
+	Expected   string              `json:"expected"`
+	Actual     string              `json:"actual"`
+	Passed     bool                `json:"passed"`
+	Frameworks map[string][]string `json:"frameworks,omitempty"`
+	CheckedAt  time.Time           `json:"checked_at"`
+}
+
+// ComplianceReport collects control results of a scenario.
+type ComplianceReport struct {
+	Scenario    string          `json:"scenario"`
+	StackName   string          `json:"stack_name"`
+	GeneratedAt time.Time       `json:"generated_at"`
+	Summary     ReportSummary   `json:"summary"`
+	Results     []ControlResult `json:"results"`
+
+	mu       sync.Mutex
+	mappings ControlMappings
+}
+
+// ReportSummary counts control results.
+type ReportSummary struct {
+	Total  int `json:"total"`
+	Passed int `json:"passed"`
+	Failed int `json:"failed"`
+}
+
+// NewComplianceReport creates an empty report. mappings may be nil (no framework references).
+func NewComplianceReport(scenario, stackName string, mappings ControlMappings) *ComplianceReport {
+	return &ComplianceReport{Scenario: scenario, StackName: stackName, mappings: mappings}
+}
+
+// Add records a result, filling in the control title and framework references.
+func (r *ComplianceReport) Add(result ControlResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if result.Title == "" {
+		result.Title = ComplianceControlTitles[result.ControlID]
+	}
+	if result.Frameworks == nil {
+		result.Frameworks = r.mappings[result.ControlID]
+	}
+	if result.CheckedAt.IsZero() {
+		result.CheckedAt = time.Now().UTC()
+	}
+	r.Results = append(r.Results, result)
+}
+
+// snapshot returns a copy of the report with results sorted by control and resource, and the summary filled in.
+func (r *ComplianceReport) snapshot(now time.Time) *ComplianceReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	results := append([]ControlResult(nil), r.Results...)
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].ControlID != results[j].ControlID {
+			return results[i].ControlID < results[j].ControlID
+		}
+		return results[i].Resource < results[j].Resource
+	})
+
+	summary := ReportSummary{Total: len(results)}
+	for _, result := range results {
+		if result.Passed {
+			summary.Passed++
+		} else {
+			summary.Failed++
+		}
+	}
+	return &ComplianceReport{
+		Scenario:    r.Scenario,
+		StackName:   r.StackName,
+		GeneratedAt: now.UTC(),
+		Summary:     summary,
+		Results:     results,
+	}
+}
+
+// JSON renders the report as indented JSON.
+func (r *ComplianceReport) JSON(now time.Time) ([]byte, error) {
+	data, err := json.MarshalIndent(r.snapshot(now), "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// JUnit XML document. Each control result is a test case: the class name is the control ID and
+// the name is the resource, so CI systems group evidence by control.
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name       string          `xml:"name,attr"`
+	Tests      int             `xml:"tests,attr"`
+	Failures   int             `xml:"failures,attr"`
+	Timestamp  string          `xml:"timestamp,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	Cases      []junitTestCase `xml:"testcase"`
+}
+
+type junitProperty struct {
+	Name  string `xml:"name,attr"`
+	Value string `xml:"value,attr"`
+}
+
+type junitTestCase struct {
+	ClassName  string          `xml:"classname,attr"`
+	Name       string          `xml:"name,attr"`
+	Properties []junitProperty `xml:"properties>property"`
+	Failure    *junitFailure   `xml:"failure"`
+	SystemOut  string          `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// JUnitXML renders the report as a JUnit XML document with one test suite for the scenario.
+func (r *ComplianceReport) JUnitXML(now time.Time) ([]byte, error) {
+	report := r.snapshot(now)
+
+	suite := junitTestSuite{
+		Name:      report.Scenario,
+		Tests:     report.Summary.Total,
+		Failures:  report.Summary.Failed,
+		Timestamp: report.GeneratedAt.Format(time.RFC3339),
+		Properties: []junitProperty{
+			{Name: "stack_name", Value: report.StackName},
+		},
+	}
+	for _, result := range report.Results {
+		testCase := junitTestCase{
+			ClassName: result.ControlID,
+			Name:      result.Resource,
+			Properties: []junitProperty{
+				{Name: "test", Value: result.Test},
+				{Name: "expected", Value: result.Expected},
+				{Name: "actual", Value: result.Actual},
+			},
+			SystemOut: result.Title,
+		}
+		frameworks := make([]string, 0, len(result.Frameworks))
+		for framework := range result.Frameworks {
+			frameworks = append(frameworks, framework)
+		}
+		sort.Strings(frameworks)
+		for _, framework := range frameworks {
+			testCase.Properties = append(testCase.Properties, junitProperty{
+				Name:  framework,
+				Value: strings.Join(result.Frameworks[framework], ","),
+			})
+		}
+		if !result.Passed {
+			testCase.Failure = &junitFailure{
+				Message: fmt.Sprintf("expected %s, got %s", result.Expected, result.Actual),
+				Type:    "ControlFailure",
+				Text:    fmt.Sprintf("%s\nresource: %s\nexpected: %s\nactual: %s", result.Title, result.Resource, result.Expected, result.Actual),
+			}
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+
+	data, err := xml.MarshalIndent(junitTestSuites{
+		Name:     "runs-on compliance",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Suites:   []junitTestSuite{suite},
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(data, '\n')...), nil
+}
+
+// WriteFiles writes <dir>/<scenario>-compliance.json and <dir>/<scenario>-compliance.xml and returns their paths.
+func (r *ComplianceReport) WriteFiles(dir string, now time.Time) ([]string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create report directory: %w", err)
+	}
+
+	jsonReport, err := r.JSON(now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render JSON report: %w", err)
+	}
+	junitReport, err := r.JUnitXML(now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render JUnit report: %w", err)
+	}
+
+	base := filepath.Join(dir, diagnosticsDirName(r.Scenario, "")+"-compliance")
+	paths := []string{base + ".json", base + ".xml"}
+	for i, data := range [][]byte{jsonReport, junitReport} {
+		if err := os.WriteFile(paths[i], data, 0o644); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", paths[i], err)
+		}
+	}
+	return paths, nil
+}
+
+// =============================================================================
+// COMPLIANCE RECORDING
+// =============================================================================
+
+var (
+	complianceReportsMu sync.Mutex
+	complianceReports   = map[string]*ComplianceReport{}
+)
+
+// StartComplianceReport starts recording the control results of the validators run in t's subtests.
+// The JSON and JUnit XML reports are written to RUNS_ON_TEST_REPORT_DIR (default ./reports) when t completes.
+// Framework references come from RUNS_ON_TEST_CONTROL_MAPPING if set, DefaultControlMappings otherwise.
+func StartComplianceReport(t *testing.T, stackName string) *ComplianceReport {
+	mappings := DefaultControlMappings
+	if path := os.Getenv("RUNS_ON_TEST_CONTROL_MAPPING"); path != "" {
+		loaded, err := LoadControlMappings(path)
+		if err != nil {
+			t.Fatalf("Invalid RUNS_ON_TEST_CONTROL_MAPPING: %v", err)
+		}
+		mappings = loaded
+	}
+
+	report := NewComplianceReport(t.Name(), stackName, mappings)
+	complianceReportsMu.Lock()
+	complianceReports[t.Name()] = report
+	complianceReportsMu.Unlock()
+
+	t.Cleanup(func() {
+		complianceReportsMu.Lock()
+		delete(complianceReports, t.Name())
+		complianceReportsMu.Unlock()
+
+		paths, err := report.WriteFiles(GetOptionalEnv("RUNS_ON_TEST_REPORT_DIR", "reports"), time.Now())
+		if err != nil {
+			t.Logf("Warning: failed to write compliance report: %v", err)
+			return
+		}
+		summary := report.snapshot(time.Now()).Summary
+		t.Logf("Compliance report: %d controls checked, %d passed, %d failed (%s)",
+			summary.Total, summary.Passed, summary.Failed, strings.Join(paths, ", "))
+	})
+	return report
+}
+
+// recordControl adds a control result to the compliance report started by t or its closest parent, if any.
+func recordControl(t *testing.T, controlID, resource, expected, actual string, passed bool) {
+	var report *ComplianceReport
+	complianceReportsMu.Lock()
+	for name := t.Name(); report == nil && name != ""; {
+		report = complianceReports[name]
+		name = name[:max(strings.LastIndex(name, "/"), 0)]
+	}
+	complianceReportsMu.Unlock()
+	if report == nil {
+		return
+	}
+
+	report.Add(ControlResult{
+		ControlID: controlID,
+		Test:      t.Name(),
+		Resource:  resource,
+		Expected:  expected,
+		Actual:    actual,
+		Passed:    passed,
+	})
+}
+
+// s3BucketARN returns the ARN of a bucket in the partition of the test region.
+func s3BucketARN(bucketName string) string {
+	return fmt.Sprintf("arn:%s:s3:::%s", awsPartition(GetAWSRegion()), bucketName)
+}
+
+// awsPartition returns the ARN partition of a region.
+func awsPartition(region string) string {
+	switch {
+	case strings.HasPrefix(region, "cn-"):
+		return "aws-cn"
+	case strings.HasPrefix(region, "us-gov-"):
+		return "aws-us-gov"
+	default:
+		return "aws"
+	}
+}
@@ -0,0 +1,175 @@
+package test
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var complianceReportTime = time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func newTestComplianceReport() *ComplianceReport {
+	report := NewComplianceReport("TestScenarioBasic", "test-abc123", DefaultControlMappings)
+	report.Add(ControlResult{
+		ControlID: ControlS3Versioning,
+		Test:      "TestScenarioBasic/Compliance/S3Versioning",
+		Resource:  "arn:aws:s3:::test-abc123-config",
+		Expected:  "Enabled",
+		Actual:    "Suspended",
+		Passed:    false,
+		CheckedAt: complianceReportTime,
+	})
+	report.Add(ControlResult{
+		ControlID: ControlS3EncryptionKMS,
+		Test:      "TestScenarioBasic/Security/S3Encryption",
+		Resource:  "arn:aws:s3:::test-abc123-config",
+		Expected:  "aws:kms",
+		Actual:    "aws:kms",
+		Passed:    true,
+		CheckedAt: complianceReportTime,
+	})
+	report.Add(ControlResult{
+		ControlID: "CUSTOM-CONTROL",
+		Test:      "TestScenarioBasic/Security/Custom",
+		Resource:  "arn:aws:iam::123456789012:role/test-abc123-ec2-instance-role",
+		Expected:  "x",
+		Actual:    "x",
+		Passed:    true,
+		CheckedAt: complianceReportTime,
+	})
+	return report
+}
+
+func TestComplianceReportJSON(t *testing.T) {
+	data, err := newTestComplianceReport().JSON(complianceReportTime)
+	require.NoError(t, err)
+
+	var parsed struct {
+		Scenario    string        `json:"scenario"`
+		StackName   string        `json:"stack_name"`
+		GeneratedAt time.Time     `json:"generated_at"`
+		Summary     ReportSummary `json:"summary"`
+		Results     []struct {
+			ControlID  string              `json:"control_id"`
+			Title      string              `json:"title"`
+			Test       string              `json:"test"`
+			Resource   string              `json:"resource"`
+			Expected   string              `json:"expected"`
+			Actual     string              `json:"actual"`
+			Passed     bool                `json:"passed"`
+			Frameworks map[string][]string `json:"frameworks"`
+		} `json:"results"`
+	}
+	require.NoError(t, json.Unmarshal(data, &parsed))
+
+	assert.Equal(t, "TestScenarioBasic", parsed.Scenario)
+	assert.Equal(t, "test-abc123", parsed.StackName)
+	assert.Equal(t, complianceReportTime, parsed.GeneratedAt)
+	assert.Equal(t, ReportSummary{Total: 3, Passed: 2, Failed: 1}, parsed.Summary)
+
+	// Sorted by control ID
+	require.Len(t, parsed.Results, 3)
+	assert.Equal(t, "CUSTOM-CONTROL", parsed.Results[0].ControlID)
+	assert.Empty(t, parsed.Results[0].Frameworks, "Unmapped controls have no framework references")
+	assert.Equal(t, ControlS3EncryptionKMS, parsed.Results[1].ControlID)
+	assert.Equal(t, ComplianceControlTitles[ControlS3EncryptionKMS], parsed.Results[1].Title)
+	assert.Equal(t, []string{"2.1.1"}, parsed.Results[1].Frameworks[FrameworkCIS])
+
+	versioning := parsed.Results[2]
+	assert.Equal(t, ControlS3Versioning, versioning.ControlID)
+	assert.Equal(t, "TestScenarioBasic/Compliance/S3Versioning", versioning.Test)
+	assert.Equal(t, "arn:aws:s3:::test-abc123-config", versioning.Resource)
+	assert.Equal(t, "Enabled", versioning.Expected)
+	assert.Equal(t, "Suspended", versioning.Actual)
+	assert.False(t, versioning.Passed)
+	assert.Equal(t, []string{"A1.2"}, versioning.Frameworks[FrameworkSOC2])
+}
+
+func TestComplianceReportJUnitXML(t *testing.T) {
+	data, err := newTestComplianceReport().JUnitXML(complianceReportTime)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `<?xml version="1.0" encoding="UTF-8"?>`)
+
+	var parsed junitTestSuites
+	require.NoError(t, xml.Unmarshal(data, &parsed))
+	assert.Equal(t, 3, parsed.Tests)
+	assert.Equal(t, 1, parsed.Failures)
+	require.Len(t, parsed.Suites, 1)
+
+	suite := parsed.Suites[0]
+	assert.Equal(t, "TestScenarioBasic", suite.Name)
+	assert.Equal(t, "2025-01-02T03:04:05Z", suite.Timestamp)
+	assert.Equal(t, []junitProperty{{Name: "stack_name", Value: "test-abc123"}}, suite.Properties)
+	require.Len(t, suite.Cases, 3)
+
+	encryption := suite.Cases[1]
+	assert.Equal(t, ControlS3EncryptionKMS, encryption.ClassName)
+	assert.Equal(t, "arn:aws:s3:::test-abc123-config", encryption.Name)
+	assert.Nil(t, encryption.Failure)
+	assert.Contains(t, encryption.Properties, junitProperty{Name: FrameworkCIS, Value: "2.1.1"})
+	assert.Contains(t, encryption.Properties, junitProperty{Name: FrameworkSOC2, Value: "CC6.1,CC6.7"})
+
+	versioning := suite.Cases[2]
+	require.NotNil(t, versioning.Failure)
+	assert.Equal(t, "expected Enabled, got Suspended", versioning.Failure.Message)
+	assert.Equal(t, "ControlFailure", versioning.Failure.Type)
+	assert.Contains(t, versioning.Properties, junitProperty{Name: "expected", Value: "Enabled"})
+	assert.Contains(t, versioning.Properties, junitProperty{Name: "actual", Value: "Suspended"})
+	assert.Contains(t, versioning.Properties, junitProperty{Name: "test", Value: "TestScenarioBasic/Compliance/S3Versioning"})
+}
+
+func TestLoadControlMappings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mapping.yml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+S3-ENCRYPTION-KMS:
+  CIS AWS Foundations v3.0.0: ["2.1.1"]
+  ISO 27001: ["A.8.24"]
+`), 0o644))
+
+	mappings, err := LoadControlMappings(path)
+	require.NoError(t, err)
+	assert.Equal(t, ControlMappings{
+		ControlS3EncryptionKMS: {"CIS AWS Foundations v3.0.0": {"2.1.1"}, "ISO 27001": {"A.8.24"}},
+	}, mappings)
+
+	_, err = LoadControlMappings(filepath.Join(t.TempDir(), "missing.yml"))
+	assert.Error(t, err)
+}
+
+func TestStartComplianceReport(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("RUNS_ON_TEST_REPORT_DIR", dir)
+	t.Setenv("RUNS_ON_TEST_CONTROL_MAPPING", "")
+
+	// Subtests record into the report of the test that started it, which is written when that test completes
+	t.Run("Scenario", func(t *testing.T) {
+		StartComplianceReport(t, "test-report")
+		t.Run("Security/S3Encryption", func(t *testing.T) {
+			recordControl(t, ControlS3EncryptionKMS, "arn:aws:s3:::bucket", "aws:kms", "aws:kms", true)
+		})
+	})
+
+	data, err := os.ReadFile(filepath.Join(dir, "TestStartComplianceReport_Scenario-compliance.json"))
+	require.NoError(t, err)
+	var report ComplianceReport
+	require.NoError(t, json.Unmarshal(data, &report))
+	assert.Equal(t, "test-report", report.StackName)
+	require.Len(t, report.Results, 1)
+	assert.Equal(t, "TestStartComplianceReport/Scenario/Security/S3Encryption", report.Results[0].Test)
+	assert.FileExists(t, filepath.Join(dir, "TestStartComplianceReport_Scenario-compliance.xml"))
+
+	// Without a started report, recording is a no-op
+	recordControl(t, ControlS3EncryptionKMS, "arn:aws:s3:::bucket", "aws:kms", "none", false)
+}
+
+func TestAWSPartition(t *testing.T) {
+	assert.Equal(t, "aws", awsPartition("us-east-1"))
+	assert.Equal(t, "aws-cn", awsPartition("cn-north-1"))
+	assert.Equal(t, "aws-us-gov", awsPartition("us-gov-west-1"))
+}
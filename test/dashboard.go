@@ -0,0 +1,432 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	cloudwatchlogstypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// =============================================================================
+// DASHBOARD PARSING
+// =============================================================================
+
+// Dashboard is the body of a CloudWatch dashboard (aws_cloudwatch_dashboard.runs_on).
+type Dashboard struct {
+	Widgets []DashboardWidget `json:"widgets"`
+}
+
+// DashboardWidget is a widget of a dashboard. Metric widgets list metrics, log widgets hold a
+// Logs Insights query.
+type DashboardWidget struct {
+	Type       string `json:"type"`
+	X          int    `json:"x"`
+	Y          int    `json:"y"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	Properties struct {
+		Metrics []json.RawMessage `json:"metrics"`
+		Query   string            `json:"query"`
+		Region  string            `json:"region"`
+		Title   string            `json:"title"`
+	} `json:"properties"`
+}
+
+// String names the widget in problems.
+func (w DashboardWidget) String() string {
+	return fmt.Sprintf("%s widget %q at (%d,%d)", w.Type, w.Properties.Title, w.X, w.Y)
+}
+
+// DashboardMetric is a metric of a metric widget.
+type DashboardMetric struct {
+	Namespace  string
+	MetricName string
+	Dimensions map[string]string
+}
+
+// ParseDashboard parses a dashboard body.
+func ParseDashboard(body string) (Dashboard, error) {
+	var dashboard Dashboard
+	if err := json.Unmarshal([]byte(body), &dashboard); err != nil {
+		return dashboard, fmt.Errorf("failed to parse dashboard body: %w", err)
+	}
+	return dashboard, nil
+}
+
+// Metrics returns the metrics of a metric widget. Rows are [namespace, name, dimension name,
+// dimension value, ..., {rendering options}], where "." repeats the value of the previous row.
+// Math expression rows have no metric and are skipped.
+func (w DashboardWidget) Metrics() ([]DashboardMetric, error) {
+	var metrics []DashboardMetric
+	var previous []string
+	for i, raw := range w.Properties.Metrics {
+		var row []interface{}
+		if err := json.Unmarshal(raw, &row); err != nil {
+			return nil, fmt.Errorf("metric %d is not an array: %w", i, err)
+		}
+
+		var values []string
+		for j, element := range row {
+			switch value := element.(type) {
+			case string:
+				if value == "." {
+					if j >= len(previous) {
+						return nil, fmt.Errorf("metric %d repeats position %d the previous metric does not have", i, j)
+					}
+					value = previous[j]
+				}
+				values = append(values, value)
+			case map[string]interface{}:
+				// Rendering options (label, color, expression) end the row
+			default:
+				return nil, fmt.Errorf("metric %d has a %T at position %d", i, element, j)
+			}
+		}
+		previous = values
+		if len(values) == 0 {
+			continue
+		}
+		if len(values) < 2 || len(values)%2 != 0 {
+			return nil, fmt.Errorf("metric %d is not namespace, name and dimension pairs: %v", i, values)
+		}
+
+		metric := DashboardMetric{Namespace: values[0], MetricName: values[1], Dimensions: map[string]string{}}
+		for j := 2; j < len(values); j += 2 {
+			metric.Dimensions[values[j]] = values[j+1]
+		}
+		metrics = append(metrics, metric)
+	}
+	return metrics, nil
+}
+
+var logQuerySourcePattern = regexp.MustCompile(`'([^']*)'`)
+
+// splitLogQueryCommands splits a Logs Insights query on the pipes between commands, ignoring
+// pipes inside quoted strings and /regular expressions/. A slash opens a regular expression when
+// it follows whitespace and is not followed by it, so "x / 60" stays a division.
+func splitLogQueryCommands(query string) []string {
+	var commands []string
+	var current strings.Builder
+	var quote rune
+	var escaped bool
+	runes := []rune(query)
+	for i, r := range runes {
+		switch {
+		case escaped:
+			escaped = false
+		case quote != 0:
+			if r == '\\' {
+				escaped = true
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'' || r == '`':
+			quote = r
+		case r == '/' && i > 0 && unicode.IsSpace(runes[i-1]) && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]):
+			quote = r
+		case r == '|':
+			commands = append(commands, strings.TrimSpace(current.String()))
+			current.Reset()
+			continue
+		}
+		current.WriteRune(r)
+	}
+	return append(commands, strings.TrimSpace(current.String()))
+}
+
+// SplitLogQuery splits the query of a log widget into the log groups of its leading SOURCE
+// commands and the remaining commands, which is what StartQuery expects.
+func SplitLogQuery(query string) (sources []string, commands []string) {
+	commands = splitLogQueryCommands(query)
+	for len(commands) > 0 && strings.HasPrefix(commands[0], "SOURCE ") {
+		for _, match := range logQuerySourcePattern.FindAllStringSubmatch(commands[0], -1) {
+			sources = append(sources, match[1])
+		}
+		commands = commands[1:]
+	}
+	return sources, commands
+}
+
+// logQueryCommands are the Logs Insights commands a dashboard query may use.
+var logQueryCommands = []string{"display", "fields", "filter", "filterIndex", "stats", "sort", "limit", "parse", "dedup", "pattern", "diff", "unmask", "unnest"}
+
+// LogQueryProblems returns the commands of a query that Logs Insights would reject: empty
+// commands (a doubled pipe) and unknown command names.
+func LogQueryProblems(commands []string) []string {
+	var problems []string
+	if len(commands) == 0 {
+		return []string{"query has no commands"}
+	}
+	for i, command := range commands {
+		name, _, _ := strings.Cut(command, " ")
+		switch {
+		case command == "":
+			problems = append(problems, fmt.Sprintf("command %d is empty (doubled pipe)", i+1))
+		case !slices.Contains(logQueryCommands, name):
+			problems = append(problems, fmt.Sprintf("command %d %q is not a Logs Insights command", i+1, name))
+		}
+	}
+	return problems
+}
+
+// =============================================================================
+// STACK REFERENCES
+// =============================================================================
+
+// DashboardReferences are the resources of a stack a dashboard may refer to: metric dimension
+// values by dimension name, and log groups.
+type DashboardReferences struct {
+	Region     string
+	Dimensions map[string][]string
+	LogGroups  []string
+}
+
+// DashboardReferencesFromOutputs collects the references from the outputs of the root module, as
+// returned by terraform.OutputAll or StackOutputs.
+func DashboardReferencesFromOutputs(outputs map[string]interface{}) DashboardReferences {
+	refs := DashboardReferences{Dimensions: map[string][]string{}}
+	add := func(dimension, value string) {
+		if value != "" && !slices.Contains(refs.Dimensions[dimension], value) {
+			refs.Dimensions[dimension] = append(refs.Dimensions[dimension], value)
+		}
+	}
+
+	for name, raw := range outputs {
+		value, ok := raw.(string)
+		if !ok || value == "" {
+			continue
+		}
+		switch {
+		case name == "aws_region":
+			refs.Region = value
+		case strings.HasPrefix(name, "sqs_queue_") && strings.HasSuffix(name, "_url"):
+			add("QueueName", queueNameFromURL(value))
+		case strings.HasPrefix(name, "dynamodb_") && strings.HasSuffix(name, "_table_name"):
+			add("TableName", value)
+		case strings.HasSuffix(name, "_bucket_name"):
+			add("BucketName", value)
+		case strings.HasSuffix(name, "_log_group_name"):
+			add("LogGroupName", value)
+			refs.LogGroups = append(refs.LogGroups, value)
+		case name == "sns_topic_arn":
+			add("TopicName", value[strings.LastIndex(value, ":")+1:])
+		case name == "apprunner_service_arn":
+			// arn:aws:apprunner:<region>:<account>:service/<name>/<id>
+			add("ServiceArn", value)
+			if parts := strings.Split(value, "/"); len(parts) == 3 {
+				add("ServiceName", parts[1])
+			}
+		}
+	}
+	for _, values := range refs.Dimensions {
+		slices.Sort(values)
+	}
+	slices.Sort(refs.LogGroups)
+	return refs
+}
+
+// CheckDashboard returns the widgets of a dashboard that refer to something the stack does not
+// have: metric dimensions that are not stack resources, log queries on other log groups, another
+// region, or queries Logs Insights would reject. Such widgets render empty.
+func CheckDashboard(dashboard Dashboard, refs DashboardReferences) []string {
+	var problems []string
+	report := func(widget DashboardWidget, format string, args ...interface{}) {
+		problems = append(problems, widget.String()+": "+fmt.Sprintf(format, args...))
+	}
+
+	if len(dashboard.Widgets) == 0 {
+		return []string{"dashboard has no widgets"}
+	}
+	for _, widget := range dashboard.Widgets {
+		if refs.Region != "" && widget.Properties.Region != "" && widget.Properties.Region != refs.Region {
+			report(widget, "region %s is not the stack region %s", widget.Properties.Region, refs.Region)
+		}
+
+		switch widget.Type {
+		case "metric":
+			metrics, err := widget.Metrics()
+			if err != nil {
+				report(widget, "%v", err)
+				continue
+			}
+			if len(metrics) == 0 {
+				report(widget, "no metrics")
+			}
+			for _, metric := range metrics {
+				for _, name := range slices.Sorted(maps.Keys(metric.Dimensions)) {
+					value := metric.Dimensions[name]
+					known, ok := refs.Dimensions[name]
+					switch {
+					case !ok:
+						report(widget, "%s %s dimension %s has no stack output to check against", metric.Namespace, metric.MetricName, name)
+					case !slices.Contains(known, value):
+						report(widget, "%s %s dimension %s=%s is not a resource of the stack (%s)", metric.Namespace,
+							metric.MetricName, name, value, strings.Join(known, ", "))
+					}
+				}
+			}
+
+		case "log":
+			sources, commands := SplitLogQuery(widget.Properties.Query)
+			if len(sources) == 0 {
+				report(widget, "query has no SOURCE log group")
+			}
+			for _, source := range sources {
+				if !slices.Contains(refs.LogGroups, source) {
+					report(widget, "log group %s is not a log group of the stack (%s)", source, strings.Join(refs.LogGroups, ", "))
+				}
+			}
+			for _, problem := range LogQueryProblems(commands) {
+				report(widget, "%s", problem)
+			}
+		}
+	}
+	return problems
+}
+
+// =============================================================================
+// DASHBOARD SOURCES
+// =============================================================================
+
+// DashboardFromShowJSON reads the body of aws_cloudwatch_dashboard.runs_on from `tofu show -json`
+// output. A plan of a new stack has no body yet: it refers to the App Runner service ID.
+func DashboardFromShowJSON(showJSON []byte) (Dashboard, error) {
+	resources, err := StackResources(showJSON)
+	if err != nil {
+		return Dashboard{}, err
+	}
+	for _, resource := range resources {
+		if resource.Type != "aws_cloudwatch_dashboard" {
+			continue
+		}
+		body := resource.stringValue("dashboard_body")
+		if body == "" {
+			return Dashboard{}, fmt.Errorf("%s has no dashboard_body, it is not known until apply", resource.Address)
+		}
+		return ParseDashboard(body)
+	}
+	return Dashboard{}, errors.New("no aws_cloudwatch_dashboard resource (is enable_dashboard set?)")
+}
+
+// StackOutputs returns the root module outputs from `tofu show -json` output, like
+// terraform.OutputAll does for an applied stack.
+func StackOutputs(showJSON []byte) (map[string]interface{}, error) {
+	type outputs struct {
+		Outputs map[string]struct {
+			Value interface{} `json:"value"`
+		} `json:"outputs"`
+	}
+	var show struct {
+		Values        *outputs `json:"values"`
+		PlannedValues *outputs `json:"planned_values"`
+	}
+	if err := json.Unmarshal(showJSON, &show); err != nil {
+		return nil, fmt.Errorf("failed to parse show JSON: %w", err)
+	}
+
+	source := show.Values
+	if source == nil {
+		source = show.PlannedValues
+	}
+	if source == nil {
+		return nil, fmt.Errorf("show JSON has neither values nor planned_values")
+	}
+	values := map[string]interface{}{}
+	for name, output := range source.Outputs {
+		values[name] = output.Value
+	}
+	return values, nil
+}
+
+// GetDashboard fetches and parses a deployed dashboard.
+func GetDashboard(t *testing.T, dashboardName string) Dashboard {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := cloudwatch.NewFromConfig(cfg)
+
+	output, err := client.GetDashboard(ctx, &cloudwatch.GetDashboardInput{DashboardName: aws.String(dashboardName)})
+	require.NoError(t, err, "Failed to get dashboard %s", dashboardName)
+	dashboard, err := ParseDashboard(aws.ToString(output.DashboardBody))
+	require.NoError(t, err)
+	return dashboard
+}
+
+// =============================================================================
+// VALIDATORS
+// =============================================================================
+
+// ValidateDashboard fetches the stack's dashboard and checks each widget against the stack
+// outputs, then checks that the log groups its queries read exist and that Logs Insights accepts
+// each query.
+func ValidateDashboard(t *testing.T, options *terraform.Options) {
+	outputs := terraform.OutputAll(t, options)
+	dashboardName, _ := outputs["dashboard_name"].(string)
+	require.NotEmpty(t, dashboardName, "dashboard_name output should be set (enable_dashboard)")
+
+	dashboard := GetDashboard(t, dashboardName)
+	refs := DashboardReferencesFromOutputs(outputs)
+	for _, problem := range CheckDashboard(dashboard, refs) {
+		assert.Fail(t, "Dashboard widget refers to something the stack does not have", problem)
+	}
+
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := cloudwatchlogs.NewFromConfig(cfg)
+
+	existing := map[string]bool{}
+	var queries int
+	for _, widget := range dashboard.Widgets {
+		if widget.Type != "log" {
+			continue
+		}
+		sources, commands := SplitLogQuery(widget.Properties.Query)
+		for _, source := range sources {
+			if _, checked := existing[source]; !checked {
+				existing[source] = logGroupExists(t, client, source)
+				assert.True(t, existing[source], "Log group %s of %s should exist", source, widget)
+			}
+		}
+
+		// A query on a missing log group fails with ResourceNotFound, not a syntax error
+		if len(sources) == 0 || !existing[sources[0]] {
+			continue
+		}
+		output, err := client.StartQuery(ctx, &cloudwatchlogs.StartQueryInput{
+			LogGroupNames: sources,
+			QueryString:   aws.String(strings.Join(commands, " | ")),
+			StartTime:     aws.Int64(time.Now().Add(-time.Hour).Unix()),
+			EndTime:       aws.Int64(time.Now().Unix()),
+		})
+		var malformed *cloudwatchlogstypes.MalformedQueryException
+		if errors.As(err, &malformed) {
+			assert.Fail(t, "Logs Insights rejects a dashboard query", "%s: %s", widget, aws.ToString(malformed.Message))
+			continue
+		}
+		require.NoError(t, err, "Failed to start the query of %s", widget)
+		_, _ = client.StopQuery(ctx, &cloudwatchlogs.StopQueryInput{QueryId: output.QueryId})
+		queries++
+	}
+
+	t.Logf("✓ %d widgets of %s refer to resources of the stack, %d queries accepted", len(dashboard.Widgets), dashboardName, queries)
+}
+
+// logGroupExists reports whether a log group with exactly this name exists.
+func logGroupExists(t *testing.T, client *cloudwatchlogs.Client, name string) bool {
+	_, ok := describeLogGroup(t, client, name)
+	return ok
+}
@@ -0,0 +1,141 @@
+package test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loadDashboardState reads the recorded state of a stack with enable_dashboard from
+// testdata/dashboard and returns its dashboard and references.
+func loadDashboardState(t *testing.T) (Dashboard, DashboardReferences) {
+	data, err := os.ReadFile(filepath.Join("testdata", "dashboard", "stack.json"))
+	require.NoError(t, err)
+	dashboard, err := DashboardFromShowJSON(data)
+	require.NoError(t, err)
+	outputs, err := StackOutputs(data)
+	require.NoError(t, err)
+	return dashboard, DashboardReferencesFromOutputs(outputs)
+}
+
+func TestDashboardFromShowJSON(t *testing.T) {
+	dashboard, refs := loadDashboardState(t)
+	assert.Len(t, dashboard.Widgets, 16)
+	assert.Equal(t, "us-east-1", refs.Region)
+	assert.Contains(t, refs.Dimensions["QueueName"], "test-dash1-main.fifo")
+	assert.Equal(t, []string{"test-dash1"}, refs.Dimensions["ServiceName"])
+	assert.Equal(t, []string{
+		"/aws/apprunner/test-dash1/0123456789abcdef0123456789abcdef/application",
+		"test-dash1/ec2/instances",
+	}, refs.LogGroups)
+
+	// A plan of a new stack cannot know the body yet
+	data, err := os.ReadFile(filepath.Join("testdata", "dashboard", "plan-before-apply.json"))
+	require.NoError(t, err)
+	_, err = DashboardFromShowJSON(data)
+	assert.ErrorContains(t, err, "not known until apply")
+	outputs, err := StackOutputs(data)
+	require.NoError(t, err)
+	assert.Equal(t, "test-dash1-Dashboard", outputs["dashboard_name"])
+
+	_, err = DashboardFromShowJSON([]byte(`{"values": {"root_module": {}}}`))
+	assert.ErrorContains(t, err, "is enable_dashboard set?")
+}
+
+func TestDashboardWidgetMetrics(t *testing.T) {
+	var widget DashboardWidget
+	require.NoError(t, json.Unmarshal([]byte(`{"type": "metric", "properties": {"metrics": [
+		["AWS/SQS", "ApproximateNumberOfMessagesVisible", "QueueName", "test-main.fifo"],
+		[".", "ApproximateAgeOfOldestMessage", ".", ".", {"stat": "Maximum"}],
+		[{"expression": "m1 + m2", "label": "Total"}]
+	]}}`), &widget))
+
+	metrics, err := widget.Metrics()
+	require.NoError(t, err)
+	assert.Equal(t, []DashboardMetric{
+		{Namespace: "AWS/SQS", MetricName: "ApproximateNumberOfMessagesVisible", Dimensions: map[string]string{"QueueName": "test-main.fifo"}},
+		{Namespace: "AWS/SQS", MetricName: "ApproximateAgeOfOldestMessage", Dimensions: map[string]string{"QueueName": "test-main.fifo"}},
+	}, metrics)
+
+	for raw, message := range map[string]string{
+		`[["AWS/SQS", "Metric", "QueueName"]]`: "not namespace, name and dimension pairs",
+		`[["AWS/SQS", "Metric", 5, "x"]]`:      "has a float64 at position 2",
+		`[[".", "Metric"]]`:                    "repeats position 0",
+		`["AWS/SQS"]`:                          "is not an array",
+	} {
+		require.NoError(t, json.Unmarshal([]byte(`{"type": "metric", "properties": {"metrics": `+raw+`}}`), &widget))
+		_, err := widget.Metrics()
+		assert.ErrorContains(t, err, message, raw)
+	}
+}
+
+func TestSplitLogQuery(t *testing.T) {
+	sources, commands := SplitLogQuery("SOURCE 'group-a' | SOURCE 'group-b'\n| filter level = \"a|b\"\n| stats sum(bytes) / 60 as rate")
+	assert.Equal(t, []string{"group-a", "group-b"}, sources)
+	assert.Equal(t, []string{`filter level = "a|b"`, "stats sum(bytes) / 60 as rate"}, commands)
+
+	// Pipes and quotes inside regular expressions do not split commands
+	_, commands = SplitLogQuery(`SOURCE 'group' | filter message like /a|b/ | parse data /"name":"(?<name>[^"]+)"/ | fields name`)
+	assert.Equal(t, []string{"filter message like /a|b/", `parse data /"name":"(?<name>[^"]+)"/`, "fields name"}, commands)
+
+	assert.Empty(t, LogQueryProblems(commands))
+	assert.Equal(t, []string{"command 2 is empty (doubled pipe)"}, LogQueryProblems([]string{"filter x", "", "stats count()"}))
+	assert.Equal(t, []string{`command 1 "fitler" is not a Logs Insights command`}, LogQueryProblems([]string{"fitler x"}))
+	assert.Equal(t, []string{"query has no commands"}, LogQueryProblems(nil))
+}
+
+func TestCheckDashboard(t *testing.T) {
+	dashboard, refs := loadDashboardState(t)
+	assert.Empty(t, CheckDashboard(dashboard, refs))
+
+	// Typos and references to another stack
+	broken, _ := loadDashboardState(t)
+	broken.Widgets[0].Properties.Metrics[0] = json.RawMessage(`["AWS/SQS", "ApproximateNumberOfMessagesVisible", "QueueName", "test-dash1-mian.fifo"]`)
+	broken.Widgets[1].Properties.Query = "SOURCE '/aws/apprunner/test-dash2/0123456789abcdef0123456789abcdef/application'\n| stats count()"
+	broken.Widgets[3].Properties.Query = "SOURCE '/aws/apprunner/test-dash1/0123456789abcdef0123456789abcdef/application'\n| filter x\n| | stats count()"
+	broken.Widgets[4].Properties.Query = "fields @timestamp"
+	broken.Widgets[5].Properties.Region = "eu-west-1"
+	assert.Equal(t, []string{
+		`metric widget "Jobs Currently Queued" at (0,0): AWS/SQS ApproximateNumberOfMessagesVisible dimension QueueName=test-dash1-mian.fifo is not a resource of the stack ` +
+			`(test-dash1-events, test-dash1-github.fifo, test-dash1-housekeeping, test-dash1-jobs.fifo, test-dash1-main.fifo, test-dash1-pool, test-dash1-termination)`,
+		`log widget "Total Runners Scheduled (Current Period)" at (6,0): log group /aws/apprunner/test-dash2/0123456789abcdef0123456789abcdef/application is not a log group of the stack ` +
+			`(/aws/apprunner/test-dash1/0123456789abcdef0123456789abcdef/application, test-dash1/ec2/instances)`,
+		`log widget "Internal/Overall Queue Duration Percentiles (P50/P90)" at (18,0): command 2 is empty (doubled pipe)`,
+		`log widget "Completed Jobs by Conclusion" at (0,6): query has no SOURCE log group`,
+		`log widget "EC2 Read" at (8,6): region eu-west-1 is not the stack region us-east-1`,
+	}, CheckDashboard(broken, refs))
+
+	// Dimensions without a stack output cannot be checked
+	broken, _ = loadDashboardState(t)
+	broken.Widgets[0].Properties.Metrics[0] = json.RawMessage(`["AWS/EC2", "CPUUtilization", "InstanceId", "i-0123456789abcdef0"]`)
+	assert.Equal(t, []string{
+		`metric widget "Jobs Currently Queued" at (0,0): AWS/EC2 CPUUtilization dimension InstanceId has no stack output to check against`,
+	}, CheckDashboard(broken, refs))
+
+	assert.Equal(t, []string{"dashboard has no widgets"}, CheckDashboard(Dashboard{}, refs))
+}
+
+// TestDashboardModuleQueries checks the Logs Insights queries of modules/core/cloudwatch.tf
+// directly, so a typo is caught before the recorded state is refreshed.
+func TestDashboardModuleQueries(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("..", "modules", "core", "cloudwatch.tf"))
+	require.NoError(t, err)
+
+	matches := regexp.MustCompile(`(?m)^\s*query\s*=\s*(".*")$`).FindAllStringSubmatch(string(data), -1)
+	require.NotEmpty(t, matches, "No dashboard queries found")
+	for _, match := range matches {
+		// HCL and Go share the escapes the queries use
+		query, err := strconv.Unquote(match[1])
+		require.NoError(t, err, "Failed to unquote %s", match[1])
+
+		sources, commands := SplitLogQuery(query)
+		assert.Equal(t, []string{"${local.apprunner_log_group_name}"}, sources, query)
+		assert.Empty(t, LogQueryProblems(commands), query)
+	}
+}
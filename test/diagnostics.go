@@ -0,0 +1,600 @@
+package test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/google/go-github/v68/github"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+)
+
+// =============================================================================
+// DIAGNOSTICS BUNDLE
+// =============================================================================
+
+// Limits that keep a diagnostics bundle reasonably small.
+const (
+	diagnosticsMaxLogEvents    = 20000 // App Runner log events
+	diagnosticsMaxDLQMessages  = 50    // Messages peeked per dead letter queue
+	diagnosticsMaxInstances    = 20    // Stack (runner) instances whose console output is collected
+	diagnosticsCloudInitLines  = 2000  // Tail of /var/log/cloud-init-output.log
+	diagnosticsSensitiveOutput = "(sensitive)"
+)
+
+// Diagnostics writes a bundle of stack state to a local directory when a scenario fails.
+// Collection runs from t.Cleanup, so it must be registered after the teardown it has to precede:
+// cleanups run in reverse order of registration.
+//
+// The bundle (under RUNS_ON_TEST_DIAGNOSTICS_DIR, default ./diagnostics) contains:
+//   - terraform-outputs.json, state-list.txt and state-summary.txt
+//   - apprunner-application.log (App Runner application logs since the scenario started)
+//   - sqs.json (queue depths) and dlq/<queue>.json (dead letter queue messages)
+//   - instances/<id>/console-output.txt (stack instances, e.g. runners)
+//   - instances/<id>/cloud-init-output.log (test instances registered with WatchInstance)
+//   - github/<run-id>/<job-id>-<job>.log (workflow runs correlated with the stack's test IDs)
+//   - collection-errors.txt (anything that could not be collected)
+type Diagnostics struct {
+	stackName string
+	options   *terraform.Options
+	start     time.Time
+
+	// Dir is the bundle directory, created on the first write
+	Dir string
+
+	mu     sync.Mutex
+	errors []string
+}
+
+// NewDiagnostics registers collection of a diagnostics bundle for the stack deployed with moduleOptions,
+// run if the test has failed by the time its cleanups run. Register the module teardown with t.Cleanup
+// before calling it (and before InitAndApply, so failed applies are covered too), as
+// scenarioModuleOptions does:
+//
+//	t.Cleanup(func() { terraform.Destroy(t, moduleOptions) })
+//	diagnostics := NewDiagnostics(t, moduleOptions)
+//	terraform.InitAndApply(t, moduleOptions)
+func NewDiagnostics(t *testing.T, moduleOptions *terraform.Options) *Diagnostics {
+	stackName, _ := moduleOptions.Vars["stack_name"].(string)
+	d := &Diagnostics{
+		stackName: stackName,
+		options:   moduleOptions,
+		start:     time.Now(),
+		Dir: filepath.Join(GetOptionalEnv("RUNS_ON_TEST_DIAGNOSTICS_DIR", "diagnostics"),
+			diagnosticsDirName(t.Name(), stackName)),
+	}
+
+	t.Cleanup(func() {
+		if t.Failed() {
+			d.Collect(t)
+		}
+	})
+	return d
+}
+
+// WatchInstance registers collection of a test instance's console output and cloud-init output
+// (via SSM) when the (sub)test fails. Register the instance's termination with t.Cleanup first:
+//
+//	t.Cleanup(func() { TerminateTestInstance(t, instanceID) })
+//	diagnostics.WatchInstance(t, instanceID, OSLinux)
+func (d *Diagnostics) WatchInstance(t *testing.T, instanceID string, instanceOS InstanceOS) {
+	t.Cleanup(func() {
+		if t.Failed() {
+			d.collectInstance(t, instanceID, instanceOS)
+		}
+	})
+}
+
+// Collect writes the stack-wide part of the bundle. Failures are logged and recorded in the bundle,
+// never reported as test failures.
+func (d *Diagnostics) Collect(t *testing.T) {
+	t.Logf("Collecting diagnostics for stack %s into %s", d.stackName, d.Dir)
+
+	outputs := d.collectTerraform(t)
+	d.collectAppRunnerLogs(t, outputs["apprunner_log_group_name"])
+	d.collectQueues(t)
+	d.collectStackInstances(t)
+	d.collectWorkflowRuns(t)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.errors) > 0 {
+		d.writeLocked(t, "collection-errors.txt", []byte(strings.Join(d.errors, "\n")+"\n"))
+	}
+	t.Logf("Diagnostics bundle written to %s (%d collection errors)", d.Dir, len(d.errors))
+}
+
+// failed records a collection failure.
+func (d *Diagnostics) failed(t *testing.T, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	t.Logf("Warning: diagnostics: %s", message)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.errors = append(d.errors, message)
+}
+
+// write writes a file of the bundle, creating directories as needed.
+func (d *Diagnostics) write(t *testing.T, name string, data []byte) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.writeLocked(t, name, data)
+}
+
+// writeLocked is write with d.mu held.
+func (d *Diagnostics) writeLocked(t *testing.T, name string, data []byte) {
+	path := filepath.Join(d.Dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Logf("Warning: diagnostics: failed to create %s: %v", filepath.Dir(path), err)
+		return
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Logf("Warning: diagnostics: failed to write %s: %v", path, err)
+	}
+}
+
+// writeJSON writes v as indented JSON.
+func (d *Diagnostics) writeJSON(t *testing.T, name string, v interface{}) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		d.failed(t, "failed to encode %s: %v", name, err)
+		return
+	}
+	d.write(t, name, append(data, '\n'))
+}
+
+// collectTerraform writes the (redacted) outputs and a state summary, and returns the plain string outputs.
+func (d *Diagnostics) collectTerraform(t *testing.T) map[string]string {
+	outputs := map[string]string{}
+
+	raw, err := terraform.RunTerraformCommandE(t, d.options, "output", "-json")
+	if err != nil {
+		d.failed(t, "failed to read terraform outputs: %v", err)
+	} else if redacted, values, err := redactTerraformOutputs([]byte(raw)); err != nil {
+		d.failed(t, "failed to parse terraform outputs: %v", err)
+	} else {
+		d.write(t, "terraform-outputs.json", redacted)
+		outputs = values
+	}
+
+	list, err := terraform.RunTerraformCommandE(t, d.options, "state", "list")
+	if err != nil {
+		d.failed(t, "failed to list terraform state: %v", err)
+		return outputs
+	}
+	d.write(t, "state-list.txt", []byte(list))
+	d.write(t, "state-summary.txt", []byte(summarizeStateList(list)))
+	return outputs
+}
+
+// collectAppRunnerLogs writes the App Runner application log events since the scenario started.
+func (d *Diagnostics) collectAppRunnerLogs(t *testing.T, logGroupName string) {
+	if logGroupName == "" {
+		d.failed(t, "apprunner_log_group_name output not available, skipping App Runner logs")
+		return
+	}
+
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := cloudwatchlogs.NewFromConfig(cfg)
+
+	var b strings.Builder
+	count := 0
+	paginator := cloudwatchlogs.NewFilterLogEventsPaginator(client, &cloudwatchlogs.FilterLogEventsInput{
+		LogGroupName: aws.String(logGroupName),
+		StartTime:    aws.Int64(d.start.Add(-5 * time.Minute).UnixMilli()),
+	})
+	for paginator.HasMorePages() && count < diagnosticsMaxLogEvents {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			d.failed(t, "failed to read App Runner logs from %s: %v", logGroupName, err)
+			break
+		}
+		for _, event := range page.Events {
+			fmt.Fprintf(&b, "%s %s\n", time.UnixMilli(aws.ToInt64(event.Timestamp)).UTC().Format(time.RFC3339Nano),
+				strings.TrimRight(aws.ToString(event.Message), "\n"))
+			count++
+		}
+	}
+	d.write(t, "apprunner-application.log", []byte(b.String()))
+	t.Logf("Collected %d App Runner log events from %s", count, logGroupName)
+}
+
+// diagnosticsQueue is a queue entry of sqs.json.
+type diagnosticsQueue struct {
+	URL        string            `json:"url"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+// collectQueues writes the depth of every stack queue and peeks at the messages of dead letter queues.
+func (d *Diagnostics) collectQueues(t *testing.T) {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := sqs.NewFromConfig(cfg)
+
+	var queues []diagnosticsQueue
+	paginator := sqs.NewListQueuesPaginator(client, &sqs.ListQueuesInput{QueueNamePrefix: aws.String(d.stackName)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			d.failed(t, "failed to list queues: %v", err)
+			break
+		}
+
+		for _, queueURL := range page.QueueUrls {
+			attrs, err := client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+				QueueUrl: aws.String(queueURL),
+				AttributeNames: []sqstypes.QueueAttributeName{
+					sqstypes.QueueAttributeNameApproximateNumberOfMessages,
+					sqstypes.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+					sqstypes.QueueAttributeNameApproximateNumberOfMessagesDelayed,
+					sqstypes.QueueAttributeNameRedrivePolicy,
+				},
+			})
+			if err != nil {
+				d.failed(t, "failed to get attributes of %s: %v", queueURL, err)
+				continue
+			}
+			queues = append(queues, diagnosticsQueue{URL: queueURL, Attributes: attrs.Attributes})
+
+			if name := queueURL[strings.LastIndex(queueURL, "/")+1:]; strings.Contains(name, "dlq") {
+				d.collectDeadLetterMessages(t, client, queueURL, name)
+			}
+		}
+	}
+	d.writeJSON(t, "sqs.json", queues)
+}
+
+// collectDeadLetterMessages peeks at a dead letter queue's messages. A zero visibility timeout
+// leaves them available, so the same messages may be received more than once.
+func (d *Diagnostics) collectDeadLetterMessages(t *testing.T, client *sqs.Client, queueURL, name string) {
+	ctx := context.Background()
+	seen := map[string]bool{}
+	var messages []map[string]interface{}
+
+	for attempt := 0; attempt < diagnosticsMaxDLQMessages/10 && len(messages) < diagnosticsMaxDLQMessages; attempt++ {
+		received, err := client.ReceiveMessage(ctx, &sqs.ReceiveMessageInput{
+			QueueUrl:                    aws.String(queueURL),
+			MaxNumberOfMessages:         10,
+			VisibilityTimeout:           0,
+			WaitTimeSeconds:             1,
+			MessageSystemAttributeNames: []sqstypes.MessageSystemAttributeName{sqstypes.MessageSystemAttributeNameAll},
+		})
+		if err != nil {
+			d.failed(t, "failed to receive messages from %s: %v", name, err)
+			break
+		}
+		if len(received.Messages) == 0 {
+			break
+		}
+		for _, message := range received.Messages {
+			id := aws.ToString(message.MessageId)
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			messages = append(messages, map[string]interface{}{
+				"message_id": id,
+				"attributes": message.Attributes,
+				"body":       aws.ToString(message.Body),
+			})
+		}
+	}
+
+	if len(messages) > 0 {
+		d.writeJSON(t, filepath.Join("dlq", name+".json"), messages)
+		t.Logf("Collected %d messages from dead letter queue %s", len(messages), name)
+	}
+}
+
+// collectStackInstances writes the console output of instances tagged with the stack name (runners, pool instances).
+func (d *Diagnostics) collectStackInstances(t *testing.T) {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := ec2.NewFromConfig(cfg)
+
+	result, err := client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
+		Filters: []ec2types.Filter{
+			{
+				Name:   aws.String("tag:runs-on-stack-name"),
+				Values: []string{d.stackName},
+			},
+		},
+	})
+	if err != nil {
+		d.failed(t, "failed to describe stack instances: %v", err)
+		return
+	}
+
+	var instances []map[string]interface{}
+	for _, reservation := range result.Reservations {
+		for _, instance := range reservation.Instances {
+			instanceID := aws.ToString(instance.InstanceId)
+			entry := map[string]interface{}{
+				"instance_id":   instanceID,
+				"instance_type": string(instance.InstanceType),
+				"launch_time":   aws.ToTime(instance.LaunchTime),
+			}
+			if instance.State != nil {
+				entry["state"] = string(instance.State.Name)
+			}
+			if instance.StateReason != nil {
+				entry["state_reason"] = aws.ToString(instance.StateReason.Message)
+			}
+			instances = append(instances, entry)
+
+			if len(instances) <= diagnosticsMaxInstances {
+				d.collectConsoleOutput(t, client, instanceID)
+			}
+		}
+	}
+	d.writeJSON(t, "instances.json", instances)
+}
+
+// collectInstance writes a test instance's console output and the tail of its cloud-init output.
+func (d *Diagnostics) collectInstance(t *testing.T, instanceID string, instanceOS InstanceOS) {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	d.collectConsoleOutput(t, ec2.NewFromConfig(cfg), instanceID)
+
+	command := fmt.Sprintf("sudo tail -n %d /var/log/cloud-init-output.log", diagnosticsCloudInitLines)
+	name := "cloud-init-output.log"
+	if instanceOS == OSWindows {
+		command = fmt.Sprintf(`Get-Content -Tail %d C:\ProgramData\Amazon\EC2Launch\log\agent.log`, diagnosticsCloudInitLines)
+		name = "ec2launch-agent.log"
+	}
+
+	stdout, stderr, err := instanceOS.RunCommand(t, instanceID, []string{command})
+	if err != nil {
+		d.failed(t, "failed to read %s of %s: %v (stderr: %s)", name, instanceID, err, stderr)
+		return
+	}
+	d.write(t, filepath.Join("instances", instanceID, name), []byte(stdout))
+}
+
+// collectConsoleOutput writes the latest console output of an instance.
+func (d *Diagnostics) collectConsoleOutput(t *testing.T, client *ec2.Client, instanceID string) {
+	ctx := context.Background()
+	result, err := client.GetConsoleOutput(ctx, &ec2.GetConsoleOutputInput{
+		InstanceId: aws.String(instanceID),
+		Latest:     aws.Bool(true),
+	})
+	if err != nil {
+		d.failed(t, "failed to get console output of %s: %v", instanceID, err)
+		return
+	}
+
+	output, err := base64.StdEncoding.DecodeString(aws.ToString(result.Output))
+	if err != nil {
+		d.failed(t, "failed to decode console output of %s: %v", instanceID, err)
+		return
+	}
+	d.write(t, filepath.Join("instances", instanceID, "console-output.txt"), output)
+}
+
+// collectWorkflowRuns writes the job logs of the workflow runs correlated with the stack's test IDs.
+func (d *Diagnostics) collectWorkflowRuns(t *testing.T) {
+	runs := workflowRunsForStack(d.stackName)
+	if len(runs) == 0 {
+		return
+	}
+	if os.Getenv("GITHUB_TOKEN") == "" {
+		d.failed(t, "GITHUB_TOKEN not set, skipping job logs of %d workflow runs", len(runs))
+		return
+	}
+
+	for _, run := range runs {
+		files, err := downloadWorkflowJobLogs(context.Background(), run)
+		if err != nil {
+			d.failed(t, "failed to download job logs of run %d: %v", run.RunID, err)
+		}
+		for name, data := range files {
+			d.write(t, filepath.Join("github", fmt.Sprint(run.RunID), name), data)
+		}
+	}
+}
+
+// =============================================================================
+// DIAGNOSTICS HELPERS
+// =============================================================================
+
+var diagnosticsNameReplacer = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// diagnosticsDirName returns the bundle directory name for a test and stack, safe for any filesystem.
+func diagnosticsDirName(testName, stackName string) string {
+	name := diagnosticsNameReplacer.ReplaceAllString(testName, "_")
+	if stackName != "" {
+		name += "-" + diagnosticsNameReplacer.ReplaceAllString(stackName, "_")
+	}
+	return strings.Trim(name, "_")
+}
+
+// redactTerraformOutputs replaces sensitive values in `tofu output -json` output and returns the redacted
+// JSON along with the outputs that are plain strings.
+func redactTerraformOutputs(raw []byte) ([]byte, map[string]string, error) {
+	var outputs map[string]struct {
+		Sensitive bool            `json:"sensitive"`
+		Type      json.RawMessage `json:"type"`
+		Value     json.RawMessage `json:"value"`
+	}
+	if err := json.Unmarshal(raw, &outputs); err != nil {
+		return nil, nil, err
+	}
+
+	values := map[string]string{}
+	for name, output := range outputs {
+		if output.Sensitive {
+			output.Value, _ = json.Marshal(diagnosticsSensitiveOutput)
+			outputs[name] = output
+			continue
+		}
+		var value string
+		if json.Unmarshal(output.Value, &value) == nil {
+			values[name] = value
+		}
+	}
+
+	redacted, err := json.MarshalIndent(outputs, "", "  ")
+	if err != nil {
+		return nil, nil, err
+	}
+	return append(redacted, '\n'), values, nil
+}
+
+// summarizeStateList counts the resources of `tofu state list` output by module and resource type.
+func summarizeStateList(list string) string {
+	counts := map[string]int{}
+	total := 0
+	for _, line := range strings.Split(list, "\n") {
+		address := strings.TrimSpace(line)
+		if address == "" {
+			continue
+		}
+		total++
+
+		// module.core.aws_sqs_queue.main["x"] -> module.core aws_sqs_queue
+		var modules []string
+		parts := strings.Split(address, ".")
+		for len(parts) >= 2 && parts[0] == "module" {
+			modules = append(modules, "module."+strings.SplitN(parts[1], "[", 2)[0])
+			parts = parts[2:]
+		}
+		resourceType := parts[0]
+		if resourceType == "data" && len(parts) > 1 {
+			resourceType = "data." + parts[1]
+		}
+
+		module := strings.Join(modules, ".")
+		if module == "" {
+			module = "(root)"
+		}
+		counts[module+" "+resourceType]++
+	}
+
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d resources\n", total)
+	for _, key := range keys {
+		module, resourceType, _ := strings.Cut(key, " ")
+		fmt.Fprintf(&b, "%-40s %-50s %d\n", module, resourceType, counts[key])
+	}
+	return b.String()
+}
+
+// =============================================================================
+// WORKFLOW RUN REGISTRY
+// =============================================================================
+
+// workflowRunRef is a workflow run found by WatchForWorkflowRun, kept for diagnostics.
+type workflowRunRef struct {
+	Repo   string
+	RunID  int64
+	TestID string
+	Opts   GitHubOptions
+}
+
+var (
+	workflowRunsMu sync.Mutex
+	workflowRuns   []workflowRunRef
+)
+
+// recordWorkflowRun remembers a run correlated with a test ID. Test IDs of the integration helpers
+// start with the stack name, which is how Diagnostics finds the runs of its stack.
+func recordWorkflowRun(opts GitHubOptions, repo string, runID int64, testID string) {
+	workflowRunsMu.Lock()
+	defer workflowRunsMu.Unlock()
+	workflowRuns = append(workflowRuns, workflowRunRef{Repo: repo, RunID: runID, TestID: testID, Opts: opts})
+}
+
+// workflowRunsForStack returns the recorded runs whose test ID belongs to the stack.
+func workflowRunsForStack(stackName string) []workflowRunRef {
+	workflowRunsMu.Lock()
+	defer workflowRunsMu.Unlock()
+
+	var runs []workflowRunRef
+	for _, run := range workflowRuns {
+		if stackName != "" && strings.HasPrefix(run.TestID, stackName+"-") {
+			runs = append(runs, run)
+		}
+	}
+	return runs
+}
+
+// downloadWorkflowJobLogs downloads the logs of every job of a run, keyed by file name
+// (<job-id>-<job-name>.log). Jobs whose logs are not available yet are skipped and reported in the error.
+func downloadWorkflowJobLogs(ctx context.Context, run workflowRunRef) (map[string][]byte, error) {
+	owner, repoName, err := parseRepo(run.Repo)
+	if err != nil {
+		return nil, err
+	}
+	client, err := getGitHubClient(run.Opts)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs, err := listAllWorkflowJobs(ctx, client, owner, repoName, run.RunID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+
+	files := map[string][]byte{}
+	var failures []string
+	for _, job := range jobs {
+		name := fmt.Sprintf("%d-%s.log", job.GetID(), diagnosticsNameReplacer.ReplaceAllString(job.GetName(), "_"))
+		data, err := downloadWorkflowJobLog(ctx, client, owner, repoName, job.GetID())
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("job %d: %v", job.GetID(), err))
+			continue
+		}
+		files[name] = data
+	}
+
+	if len(failures) > 0 {
+		return files, fmt.Errorf("%s", strings.Join(failures, "; "))
+	}
+	return files, nil
+}
+
+// downloadWorkflowJobLog follows the redirect GitHub returns for a job's logs.
+func downloadWorkflowJobLog(ctx context.Context, client *github.Client, owner, repoName string, jobID int64) ([]byte, error) {
+	logURL, _, err := client.Actions.GetWorkflowJobLogs(ctx, owner, repoName, jobID, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, logURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d downloading logs", resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,126 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v68/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiagnosticsDirName(t *testing.T) {
+	assert.Equal(t, "TestScenarioBasic_Functional_arm64-test-abc123",
+		diagnosticsDirName("TestScenarioBasic/Functional/arm64", "test-abc123"))
+	assert.Equal(t, "TestScenarioWindows", diagnosticsDirName("TestScenarioWindows", ""))
+	assert.Equal(t, "TestX_a_b_-stack", diagnosticsDirName("TestX/a b:/", "stack"))
+}
+
+func TestRedactTerraformOutputs(t *testing.T) {
+	raw := []byte(`{
+		"stack_name": {"sensitive": false, "type": "string", "value": "test-abc123"},
+		"apprunner_log_group_name": {"sensitive": false, "type": "string", "value": "/aws/apprunner/test-abc123/0123/application"},
+		"security_group_ids": {"sensitive": false, "type": ["list", "string"], "value": ["sg-1", "sg-2"]},
+		"license_key": {"sensitive": true, "type": "string", "value": "secret-license"}
+	}`)
+
+	redacted, values, err := redactTerraformOutputs(raw)
+	require.NoError(t, err)
+	assert.NotContains(t, string(redacted), "secret-license")
+
+	var parsed map[string]struct {
+		Sensitive bool        `json:"sensitive"`
+		Value     interface{} `json:"value"`
+	}
+	require.NoError(t, json.Unmarshal(redacted, &parsed))
+	assert.Equal(t, diagnosticsSensitiveOutput, parsed["license_key"].Value)
+	assert.True(t, parsed["license_key"].Sensitive)
+	assert.Equal(t, []interface{}{"sg-1", "sg-2"}, parsed["security_group_ids"].Value)
+
+	assert.Equal(t, map[string]string{
+		"stack_name":               "test-abc123",
+		"apprunner_log_group_name": "/aws/apprunner/test-abc123/0123/application",
+	}, values, "Only non-sensitive string outputs are returned")
+
+	_, _, err = redactTerraformOutputs([]byte("not json"))
+	assert.Error(t, err)
+}
+
+func TestSummarizeStateList(t *testing.T) {
+	list := `module.core.aws_sqs_queue.main
+module.core.aws_sqs_queue.jobs
+module.core.data.aws_iam_policy_document.sqs
+module.compute.aws_launch_template.linux["default"]
+module.compute.aws_launch_template.linux["private"]
+module.storage.module.efs[0].aws_efs_file_system.this
+random_string.suffix
+
+`
+	summary := summarizeStateList(list)
+	assert.Contains(t, summary, "7 resources\n")
+	assert.Regexp(t, `module\.core\s+aws_sqs_queue\s+2\n`, summary)
+	assert.Regexp(t, `module\.core\s+data\.aws_iam_policy_document\s+1\n`, summary)
+	assert.Regexp(t, `module\.compute\s+aws_launch_template\s+2\n`, summary)
+	assert.Regexp(t, `module\.storage\.module\.efs\s+aws_efs_file_system\s+1\n`, summary)
+	assert.Regexp(t, `\(root\)\s+random_string\s+1\n`, summary)
+
+	assert.Equal(t, "0 resources\n", summarizeStateList(""))
+}
+
+func TestWorkflowRunsForStack(t *testing.T) {
+	recordWorkflowRun(GitHubOptions{}, fakeTestRepo, 101, "test-diag1-20250102-1")
+	recordWorkflowRun(GitHubOptions{}, fakeTestRepo, 102, "test-diag10-20250102-1")
+	recordWorkflowRun(GitHubOptions{}, fakeTestRepo, 103, "test-diag1-20250102-2")
+
+	var runIDs []int64
+	for _, run := range workflowRunsForStack("test-diag1") {
+		runIDs = append(runIDs, run.RunID)
+	}
+	assert.Equal(t, []int64{101, 103}, runIDs, "Runs of other stacks sharing a name prefix are excluded")
+	assert.Empty(t, workflowRunsForStack(""))
+}
+
+func TestDownloadWorkflowJobLogs(t *testing.T) {
+	server, opts := newFakeGitHubTarget(t)
+
+	run, job := newFakeCompletedRun(4000)
+	secondJob := &github.WorkflowJob{
+		ID:         github.Ptr(int64(40001)),
+		RunID:      github.Ptr(int64(4000)),
+		Name:       github.Ptr("build (arm64)"),
+		Status:     github.Ptr("completed"),
+		RunnerName: github.Ptr("runs-on-arm64"),
+	}
+	server.addRun(fakeTestRepo, fakeTestWorkflow, run, job, secondJob)
+
+	files, err := downloadWorkflowJobLogs(context.Background(),
+		workflowRunRef{Repo: fakeTestRepo, RunID: 4000, TestID: "test-diag-1", Opts: opts})
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	assert.Contains(t, string(files["40000-test.log"]), "Job test ran on runs-on-test-runner")
+	assert.Contains(t, string(files["40001-build_arm64_.log"]), "Job build (arm64) ran on runs-on-arm64")
+	assert.Equal(t, 1, countRequests(server, "/actions/jobs/40001/logs"))
+
+	_, err = downloadWorkflowJobLogs(context.Background(),
+		workflowRunRef{Repo: fakeTestRepo, RunID: 4999, TestID: "test-diag-1", Opts: opts})
+	assert.ErrorContains(t, err, "failed to list jobs")
+}
+
+func TestWatchForWorkflowRunRecordsRun(t *testing.T) {
+	server, opts := newFakeGitHubTarget(t)
+
+	testID := "test-diagrec-" + GetTestID()
+	run, job := newFakeCompletedRun(4100)
+	run.DisplayTitle = github.Ptr("RunsOn test " + testID)
+	server.addRun(fakeTestRepo, fakeTestWorkflow, run, job)
+
+	runID, err := WatchForWorkflowRunWithOptions(t, opts, fakeTestRepo, fakeTestWorkflow, testID, time.Now(), 5*time.Second)
+	require.NoError(t, err)
+
+	runs := workflowRunsForStack("test-diagrec")
+	require.Len(t, runs, 1)
+	assert.Equal(t, runID, runs[0].RunID)
+	assert.Equal(t, opts.BaseURL, runs[0].Opts.BaseURL)
+}
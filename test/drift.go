@@ -0,0 +1,109 @@
+package test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// =============================================================================
+// PLAN IDEMPOTENCY
+// =============================================================================
+
+// PlanChanges runs `tofu plan -detailed-exitcode` against the deployed state and returns the
+// classified plan. The plan file is written to a temporary directory, so options are not modified.
+func PlanChanges(t *testing.T, options *terraform.Options) *PlanDiff {
+	planOptions := *options
+	planOptions.PlanFilePath = filepath.Join(t.TempDir(), "plan.tfplan")
+
+	exitCode, err := terraform.PlanExitCodeE(t, &planOptions)
+	require.NoError(t, err, "Failed to run plan")
+	switch exitCode {
+	case 0:
+		return &PlanDiff{}
+	case 2:
+	default:
+		require.Failf(t, "Plan failed", "tofu plan exited with %d", exitCode)
+	}
+
+	planJSON, err := terraform.ShowE(t, &planOptions)
+	require.NoError(t, err, "Failed to show plan")
+	diff, err := ParsePlanDiff([]byte(planJSON))
+	require.NoError(t, err, "Failed to classify plan")
+	return diff
+}
+
+// ValidatePlanIsEmpty checks that planning right after an apply changes nothing. A non-empty plan
+// is a perpetual diff: e.g. jsonencode'd policies that AWS normalizes, tags_all drift or values
+// such as random suffixes that are recomputed on every plan.
+func ValidatePlanIsEmpty(t *testing.T, options *terraform.Options) {
+	diff := PlanChanges(t, options)
+	if !assert.True(t, diff.Empty(), "Plan after apply should be empty (perpetual diff):\n%s", diff) {
+		return
+	}
+	t.Logf("✓ Plan after apply is empty")
+}
+
+// =============================================================================
+// DRIFT INJECTION
+// =============================================================================
+
+// SuspendBucketVersioning suspends versioning of a bucket outside of OpenTofu.
+func SuspendBucketVersioning(t *testing.T, bucketName string) {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := s3.NewFromConfig(cfg)
+
+	_, err := client.PutBucketVersioning(ctx, &s3.PutBucketVersioningInput{
+		Bucket: aws.String(bucketName),
+		VersioningConfiguration: &s3types.VersioningConfiguration{
+			Status: s3types.BucketVersioningStatusSuspended,
+		},
+	})
+	require.NoError(t, err, "Failed to suspend versioning of %s", bucketName)
+	t.Logf("Suspended versioning of %s", bucketName)
+}
+
+// DeleteLogGroupRetention removes the retention policy of a log group outside of OpenTofu, so its
+// events never expire.
+func DeleteLogGroupRetention(t *testing.T, logGroupName string) {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := cloudwatchlogs.NewFromConfig(cfg)
+
+	_, err := client.DeleteRetentionPolicy(ctx, &cloudwatchlogs.DeleteRetentionPolicyInput{
+		LogGroupName: aws.String(logGroupName),
+	})
+	require.NoError(t, err, "Failed to delete retention policy of %s", logGroupName)
+	t.Logf("Deleted retention policy of %s", logGroupName)
+}
+
+// ValidateDriftRepaired checks that the next plan detects a change made outside of OpenTofu as an
+// in-place update of the given resource address, then applies it and checks the plan is empty again.
+func ValidateDriftRepaired(t *testing.T, options *terraform.Options, address string) {
+	diff := PlanChanges(t, options)
+	t.Logf("Plan after drift:\n%s", diff)
+
+	change, found := diff.Change(address)
+	require.True(t, found, "Plan should include %s", address)
+	require.Equal(t, PlanActionUpdate, change.Action, "Drift of %s should be repaired in place", address)
+
+	for _, change := range diff.Changes {
+		if change.Address != address && change.Action != PlanActionNoOp && change.Action != PlanActionRead {
+			assert.Failf(t, "Unexpected change", "Only %s drifted, but the plan would %s %s", address, change.Action, change.Address)
+		}
+	}
+	t.Logf("✓ Plan detects drift of %s (%v)", address, change.Attributes)
+
+	terraform.Apply(t, options)
+	ValidatePlanIsEmpty(t, options)
+	t.Logf("✓ Drift of %s repaired", address)
+}
@@ -0,0 +1,57 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePlanDiffPerpetualDiff(t *testing.T) {
+	diff := loadPlanDiff(t, "perpetual-diff.json")
+	assert.False(t, diff.Empty())
+	assert.Empty(t, diff.StatefulDestructive())
+
+	policy, found := diff.Change("module.core.aws_sqs_queue_policy.main_dead_letter")
+	require.True(t, found)
+	assert.Equal(t, PlanActionUpdate, policy.Action)
+	assert.Equal(t, []string{"policy"}, policy.Attributes, "Reordered policy JSON is reported as a policy change")
+
+	logGroup, found := diff.Change("module.compute.aws_cloudwatch_log_group.ec2_instances")
+	require.True(t, found)
+	assert.Equal(t, []string{"tags_all"}, logGroup.Attributes, "Attributes known after apply are reported")
+
+	_, found = diff.Change("module.core.aws_sqs_queue.main")
+	assert.False(t, found)
+
+	assert.Equal(t, []string{"cache_bucket_name"}, diff.Outputs, "Unchanged outputs are not reported")
+
+	summary := diff.String()
+	assert.Contains(t, summary, "update   module.core.aws_sqs_queue_policy.main_dead_letter: policy\n")
+	assert.Contains(t, summary, "outputs  cache_bucket_name\n")
+}
+
+func TestParsePlanDiffDrift(t *testing.T) {
+	diff := loadPlanDiff(t, "drift-versioning.json")
+	assert.False(t, diff.Empty())
+
+	require.Len(t, diff.Drift, 1)
+	assert.Equal(t, "module.storage.aws_s3_bucket_versioning.config", diff.Drift[0].Address)
+	assert.Equal(t, []string{"versioning_configuration"}, diff.Drift[0].Attributes)
+
+	change, found := diff.Change("module.storage.aws_s3_bucket_versioning.config")
+	require.True(t, found)
+	assert.Equal(t, PlanActionUpdate, change.Action)
+	assert.Equal(t, map[string]int{PlanActionUpdate: 1}, diff.Counts())
+	assert.Empty(t, diff.Outputs)
+	assert.Contains(t, diff.String(), "drifted  module.storage.aws_s3_bucket_versioning.config: versioning_configuration\n")
+}
+
+func TestPlanDiffEmpty(t *testing.T) {
+	assert.True(t, (&PlanDiff{}).Empty())
+	assert.True(t, (&PlanDiff{Changes: []PlanChange{
+		{Address: "data.aws_region.current", Action: PlanActionRead},
+		{Address: "module.storage.aws_s3_bucket.config", Action: PlanActionNoOp},
+	}}).Empty(), "Reads and no-ops change nothing")
+	assert.False(t, (&PlanDiff{Outputs: []string{"stack_name"}}).Empty())
+}
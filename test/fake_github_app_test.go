@@ -0,0 +1,349 @@
+package test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v68/github"
+)
+
+// =============================================================================
+// FAKE GITHUB APP MANIFEST FLOW
+// =============================================================================
+
+// fakeGitHubApp is a GitHub App created through the fake manifest flow.
+type fakeGitHubApp struct {
+	creds      GitHubAppCredentials
+	manifest   string
+	publicKey  *rsa.PublicKey
+	hookConfig github.HookConfig
+}
+
+// handleNewAppFromManifest stands in for the GitHub page the manifest form posts to.
+// Instead of asking a person to confirm, it issues a code and redirects straight back to the
+// manifest redirect_url, like GitHub does after the "Create GitHub App" click.
+func (f *fakeGitHubServer) handleNewAppFromManifest(w http.ResponseWriter, r *http.Request) {
+	raw := r.PostFormValue("manifest")
+	var manifest GitHubAppManifest
+	if err := json.Unmarshal([]byte(raw), &manifest); err != nil || manifest.RedirectURL == "" {
+		http.Error(w, "invalid manifest", http.StatusUnprocessableEntity)
+		return
+	}
+
+	redirect, err := url.Parse(manifest.RedirectURL)
+	if err != nil {
+		http.Error(w, "invalid redirect_url", http.StatusUnprocessableEntity)
+		return
+	}
+
+	f.mu.Lock()
+	code := fmt.Sprintf("code-%d", len(f.manifestCodes)+len(f.apps)+1)
+	f.manifestCodes[code] = raw
+	f.mu.Unlock()
+
+	query := redirect.Query()
+	query.Set("code", code)
+	query.Set("state", r.URL.Query().Get("state"))
+	redirect.RawQuery = query.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (f *fakeGitHubServer) handleConvertAppManifest(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	raw, ok := f.manifestCodes[r.PathValue("code")]
+	if !ok {
+		writeFakeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		return
+	}
+	delete(f.manifestCodes, r.PathValue("code"))
+
+	var manifest GitHubAppManifest
+	_ = json.Unmarshal([]byte(raw), &manifest)
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		writeFakeJSON(w, http.StatusInternalServerError, map[string]string{"message": err.Error()})
+		return
+	}
+
+	f.nextAppID++
+	app := &fakeGitHubApp{
+		creds: GitHubAppCredentials{
+			ID:            f.nextAppID,
+			Slug:          strings.ToLower(strings.ReplaceAll(manifest.Name, " ", "-")),
+			ClientID:      fmt.Sprintf("Iv1.fake%d", f.nextAppID),
+			ClientSecret:  fmt.Sprintf("client-secret-%d", f.nextAppID),
+			WebhookSecret: fmt.Sprintf("webhook-secret-%d", f.nextAppID),
+			PEM:           string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})),
+		},
+		manifest:   raw,
+		publicKey:  &key.PublicKey,
+		hookConfig: github.HookConfig{URL: github.Ptr(manifest.HookAttributes.URL)},
+	}
+	f.apps = append(f.apps, app)
+
+	writeFakeJSON(w, http.StatusCreated, &github.AppConfig{
+		ID:            github.Ptr(app.creds.ID),
+		Slug:          github.Ptr(app.creds.Slug),
+		Name:          github.Ptr(manifest.Name),
+		ClientID:      github.Ptr(app.creds.ClientID),
+		ClientSecret:  github.Ptr(app.creds.ClientSecret),
+		WebhookSecret: github.Ptr(app.creds.WebhookSecret),
+		PEM:           github.Ptr(app.creds.PEM),
+	})
+}
+
+func (f *fakeGitHubServer) handleUpdateAppHookConfig(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	app := f.authenticateApp(r)
+	if app == nil {
+		writeFakeJSON(w, http.StatusUnauthorized, map[string]string{"message": "A JSON web token could not be decoded"})
+		return
+	}
+
+	var config github.HookConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		writeFakeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "Invalid request"})
+		return
+	}
+	if config.URL != nil {
+		app.hookConfig.URL = config.URL
+	}
+	if config.ContentType != nil {
+		app.hookConfig.ContentType = config.ContentType
+	}
+	if config.Secret != nil {
+		app.hookConfig.Secret = config.Secret
+	}
+
+	writeFakeJSON(w, http.StatusOK, &github.HookConfig{URL: app.hookConfig.URL, ContentType: app.hookConfig.ContentType})
+}
+
+// authenticateApp verifies the request's app JWT (RS256 signature, issuer and expiry) and returns
+// the app it was signed for. Must be called with f.mu held.
+func (f *fakeGitHubServer) authenticateApp(r *http.Request) *fakeGitHubApp {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return nil
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil
+	}
+	var claims struct {
+		Iss string `json:"iss"`
+		Exp int64  `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || time.Now().Unix() > claims.Exp {
+		return nil
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil
+	}
+
+	for _, app := range f.apps {
+		if strconv.FormatInt(app.creds.ID, 10) != claims.Iss {
+			continue
+		}
+		digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+		if rsa.VerifyPKCS1v15(app.publicKey, crypto.SHA256, digest[:], signature) != nil {
+			return nil
+		}
+		return app
+	}
+	return nil
+}
+
+// createApp registers an app directly, like a pre-created app in a test org.
+func (f *fakeGitHubServer) createApp(t *testing.T, name, webhookURL string) GitHubAppCredentials {
+	manifest, _ := json.Marshal(map[string]interface{}{
+		"name":            name,
+		"redirect_url":    "https://unused.example.com/callback",
+		"hook_attributes": map[string]string{"url": webhookURL},
+	})
+
+	f.mu.Lock()
+	code := fmt.Sprintf("precreated-%d", len(f.apps)+1)
+	f.manifestCodes[code] = string(manifest)
+	f.mu.Unlock()
+
+	creds, err := ConvertAppManifest(GitHubOptions{BaseURL: f.URL}, code)
+	if err != nil {
+		t.Fatalf("Failed to create fake app: %v", err)
+	}
+	return *creds
+}
+
+// appHookConfig returns the current webhook config of the app with the given ID.
+func (f *fakeGitHubServer) appHookConfig(appID int64) *github.HookConfig {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, app := range f.apps {
+		if app.creds.ID == appID {
+			config := app.hookConfig
+			return &config
+		}
+	}
+	return nil
+}
+
+// =============================================================================
+// FAKE RUNSON APP
+// =============================================================================
+
+// fakeRunsOnApp is an httptest stand-in for the registration endpoints of the App Runner service.
+// Until an app is registered, GET / serves a form posting the app manifest to GitHub;
+// GET /callback converts the manifest code (POST /app-manifests/{code}/conversions) and keeps
+// the returned credentials, after which GET / no longer serves the form.
+// POST /webhook verifies X-Hub-Signature-256 against the app's webhook secret and records
+// workflow_job events.
+type fakeRunsOnApp struct {
+	*httptest.Server
+
+	githubAPIURL string
+	githubWebURL string
+	org          string
+	state        string
+
+	mu     sync.Mutex
+	creds  *GitHubAppCredentials
+	events []*github.WorkflowJobEvent
+}
+
+// newFakeRunsOnApp starts an app stand-in registering against the fake GitHub at github
+// (API under apiPrefix) for the given organization.
+func newFakeRunsOnApp(t *testing.T, gh *fakeGitHubServer, apiPrefix, org string) *fakeRunsOnApp {
+	app := &fakeRunsOnApp{
+		githubAPIURL: gh.URL + apiPrefix,
+		githubWebURL: gh.URL,
+		org:          org,
+		state:        "state-" + strconv.FormatInt(time.Now().UnixNano(), 36),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", app.handleIndex)
+	mux.HandleFunc("GET /callback", app.handleCallback)
+	mux.HandleFunc("POST /webhook", app.handleWebhook)
+
+	app.Server = httptest.NewServer(mux)
+	t.Cleanup(app.Close)
+	return app
+}
+
+// registered returns the credentials obtained by the app, or nil if not registered yet.
+func (a *fakeRunsOnApp) registered() *GitHubAppCredentials {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.creds
+}
+
+// hasCredentials stands in for the app credentials in the config bucket (GitHubOptions.AppRegistered).
+func (a *fakeRunsOnApp) hasCredentials() (bool, error) {
+	return a.registered() != nil, nil
+}
+
+func (a *fakeRunsOnApp) handleIndex(w http.ResponseWriter, r *http.Request) {
+	if a.registered() != nil {
+		fmt.Fprint(w, "<html><body><h1>RunsOn</h1><p>GitHub App registered.</p></body></html>")
+		return
+	}
+
+	manifest, _ := json.Marshal(map[string]interface{}{
+		"name":            "runs-on-test",
+		"url":             a.URL,
+		"redirect_url":    a.URL + "/callback",
+		"hook_attributes": map[string]string{"url": a.URL + "/webhook"},
+		"public":          false,
+		"default_events":  []string{"workflow_job"},
+		"default_permissions": map[string]string{
+			"actions":                          "read",
+			"organization_self_hosted_runners": "write",
+		},
+	})
+	action := fmt.Sprintf("%s/organizations/%s/settings/apps/new?state=%s", a.githubWebURL, a.org, a.state)
+
+	fmt.Fprintf(w, `<html><body>
+<h1>Register RunsOn</h1>
+<form action="%s" method="post">
+  <input type="hidden" name="manifest" value='%s'>
+  <button type="submit">Create GitHub App</button>
+</form>
+</body></html>`, html.EscapeString(action), html.EscapeString(string(manifest)))
+}
+
+func (a *fakeRunsOnApp) handleCallback(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("state") != a.state {
+		http.Error(w, "invalid state", http.StatusBadRequest)
+		return
+	}
+
+	creds, err := ConvertAppManifest(GitHubOptions{BaseURL: a.githubAPIURL}, r.URL.Query().Get("code"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	a.mu.Lock()
+	a.creds = creds
+	a.mu.Unlock()
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func (a *fakeRunsOnApp) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	creds := a.registered()
+	if creds == nil {
+		http.Error(w, "app not registered", http.StatusServiceUnavailable)
+		return
+	}
+
+	payload, err := github.ValidatePayload(r, []byte(creds.WebhookSecret))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	event, err := github.ParseWebHook(github.WebHookType(r), payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if jobEvent, ok := event.(*github.WorkflowJobEvent); ok {
+		a.mu.Lock()
+		a.events = append(a.events, jobEvent)
+		a.mu.Unlock()
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// workflowJobEvents returns the workflow_job events received so far.
+func (a *fakeRunsOnApp) workflowJobEvents() []*github.WorkflowJobEvent {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]*github.WorkflowJobEvent(nil), a.events...)
+}
@@ -0,0 +1,398 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v68/github"
+)
+
+// =============================================================================
+// FAKE GITHUB API
+// =============================================================================
+
+// fakeGitHubServer is an httptest-based stand-in for the GitHub Actions REST API.
+// It serves the endpoints used by the observer-mode helpers:
+//   - GET {prefix}/repos/{owner}/{repo}/actions/workflows/{workflow}/runs (ListWorkflowRunsByFileName)
+//   - GET {prefix}/repos/{owner}/{repo}/actions/runs/{run_id} (GetWorkflowRunByID)
+//   - GET {prefix}/repos/{owner}/{repo}/actions/runs/{run_id}/jobs (ListWorkflowJobs)
+//   - POST {prefix}/repos/{owner}/{repo}/actions/workflows/{workflow}/dispatches (CreateWorkflowDispatchEventByFileName)
+//   - GET {prefix}/repos/{owner}/{repo}/actions/jobs/{job_id}/logs (GetWorkflowJobLogs, redirects to /_logs/{job_id})
+//   - POST {prefix}/app-manifests/{code}/conversions (CompleteAppManifest)
+//   - GET and PATCH {prefix}/app/hook/config (GetHookConfig and UpdateHookConfig, app JWT required)
+//
+// It also serves the GitHub web endpoint the manifest form posts to
+// (POST /organizations/{org}/settings/apps/new), auto-confirming the app, see fake_github_app_test.go.
+//
+// The prefix is empty for the api.github.com layout and "/api/v3" for GitHub Enterprise Server.
+// List endpoints honour page/per_page and emit Link headers like the real API.
+//
+// A dispatch creates a new scripted run whose run name contains the "test_id" input, like a workflow
+// with run-name: "RunsOn test ${{ inputs.test_id }}", so automated mode can be tested end to end.
+//
+// Failure modes can be injected per request: transient errors (failNext) and
+// primary rate limiting (rateLimitNext, 403 with X-RateLimit-Reset).
+type fakeGitHubServer struct {
+	*httptest.Server
+
+	mu         sync.Mutex
+	runs       []*fakeWorkflowRun
+	faults     []fakeFault
+	requests   []string
+	dispatches []github.CreateWorkflowDispatchEventRequest
+	nextRunID  int64
+
+	manifestCodes map[string]string // Unconverted manifest codes and their manifest JSON
+	apps          []*fakeGitHubApp
+	nextAppID     int64
+}
+
+// fakeWorkflowRun is a workflow run served by the fake GitHub API.
+// If statuses is set, the run (and its jobs) advance one status per poll of the run or its jobs,
+// staying on the last status once reached, e.g. queued -> in_progress -> completed.
+// A run whose statuses are all "queued" simulates a job no runner ever picks up.
+type fakeWorkflowRun struct {
+	owner        string
+	repo         string
+	workflowFile string
+	run          *github.WorkflowRun
+	jobs         []*github.WorkflowJob
+
+	statuses []string
+	polls    int
+}
+
+// fakeFault is an injected failure for the next request.
+type fakeFault struct {
+	status         int
+	rateLimitReset time.Time // Set for primary rate limit faults
+}
+
+// newFakeGitHubServer starts a fake GitHub API serving paths under pathPrefix.
+// The server is closed automatically when the test completes.
+func newFakeGitHubServer(t *testing.T, pathPrefix string) *fakeGitHubServer {
+	f := &fakeGitHubServer{nextRunID: 9000, nextAppID: 100, manifestCodes: map[string]string{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+pathPrefix+"/repos/{owner}/{repo}/actions/workflows/{workflow}/runs", f.handleListWorkflowRuns)
+	mux.HandleFunc("GET "+pathPrefix+"/repos/{owner}/{repo}/actions/runs/{run_id}", f.handleGetWorkflowRun)
+	mux.HandleFunc("GET "+pathPrefix+"/repos/{owner}/{repo}/actions/runs/{run_id}/jobs", f.handleListWorkflowJobs)
+	mux.HandleFunc("POST "+pathPrefix+"/repos/{owner}/{repo}/actions/workflows/{workflow}/dispatches", f.handleDispatchWorkflow)
+	mux.HandleFunc("GET "+pathPrefix+"/repos/{owner}/{repo}/actions/jobs/{job_id}/logs", f.handleGetWorkflowJobLogs)
+	mux.HandleFunc("GET /_logs/{job_id}", f.handleDownloadJobLogs)
+	mux.HandleFunc("POST "+pathPrefix+"/app-manifests/{code}/conversions", f.handleConvertAppManifest)
+	mux.HandleFunc("PATCH "+pathPrefix+"/app/hook/config", f.handleUpdateAppHookConfig)
+	mux.HandleFunc("POST /organizations/{org}/settings/apps/new", f.handleNewAppFromManifest)
+
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.requests = append(f.requests, r.URL.RequestURI())
+		var fault *fakeFault
+		if len(f.faults) > 0 {
+			fault = &f.faults[0]
+			f.faults = f.faults[1:]
+		}
+		f.mu.Unlock()
+
+		if fault != nil {
+			writeFakeFault(w, *fault)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(f.Close)
+
+	return f
+}
+
+// newFakeGHESServer starts a fake GitHub Enterprise Server API (paths under /api/v3).
+// Pass the server URL as GitHubOptions.EnterpriseURL to use it from the helpers.
+func newFakeGHESServer(t *testing.T) *fakeGitHubServer {
+	return newFakeGitHubServer(t, "/api/v3")
+}
+
+// addRun registers a workflow run (and its jobs) for the given "owner/repo" and workflow file.
+// The returned run can be given a statuses script to simulate state transitions.
+func (f *fakeGitHubServer) addRun(repo, workflowFile string, run *github.WorkflowRun, jobs ...*github.WorkflowJob) *fakeWorkflowRun {
+	owner, repoName, err := parseRepo(repo)
+	if err != nil {
+		panic(err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	fr := &fakeWorkflowRun{
+		owner:        owner,
+		repo:         repoName,
+		workflowFile: workflowFile,
+		run:          run,
+		jobs:         jobs,
+	}
+	f.runs = append(f.runs, fr)
+	return fr
+}
+
+// failNext makes the next n requests fail with the given HTTP status (e.g. a transient 502).
+func (f *fakeGitHubServer) failNext(n, status int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := 0; i < n; i++ {
+		f.faults = append(f.faults, fakeFault{status: status})
+	}
+}
+
+// rateLimitNext makes the next n requests fail with a primary rate limit error
+// (403 with X-RateLimit-Remaining: 0) that resets at the given time.
+func (f *fakeGitHubServer) rateLimitNext(n int, reset time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := 0; i < n; i++ {
+		f.faults = append(f.faults, fakeFault{status: http.StatusForbidden, rateLimitReset: reset})
+	}
+}
+
+// dispatchRequests returns all workflow dispatch requests received so far.
+func (f *fakeGitHubServer) dispatchRequests() []github.CreateWorkflowDispatchEventRequest {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]github.CreateWorkflowDispatchEventRequest(nil), f.dispatches...)
+}
+
+// requestURIs returns the URIs (path and query) of all requests received so far.
+func (f *fakeGitHubServer) requestURIs() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.requests...)
+}
+
+// advance moves a scripted run to its next status and mirrors it onto the jobs.
+// Must be called with f.mu held.
+func (fr *fakeWorkflowRun) advance() {
+	if len(fr.statuses) == 0 {
+		return
+	}
+
+	status := fr.statuses[min(fr.polls, len(fr.statuses)-1)]
+	fr.polls++
+
+	fr.run.Status = github.Ptr(status)
+	for _, job := range fr.jobs {
+		job.Status = github.Ptr(status)
+		if status == "completed" {
+			job.Conclusion = fr.run.Conclusion
+		}
+	}
+}
+
+// findRun returns the registered run matching the request's owner, repo and run_id.
+// Must be called with f.mu held.
+func (f *fakeGitHubServer) findRun(r *http.Request) *fakeWorkflowRun {
+	runID, err := strconv.ParseInt(r.PathValue("run_id"), 10, 64)
+	if err != nil {
+		return nil
+	}
+	for _, fr := range f.runs {
+		if fr.owner == r.PathValue("owner") && fr.repo == r.PathValue("repo") && fr.run.GetID() == runID {
+			return fr
+		}
+	}
+	return nil
+}
+
+func (f *fakeGitHubServer) handleListWorkflowRuns(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	event := r.URL.Query().Get("event")
+	var runs []*github.WorkflowRun
+	for _, fr := range f.runs {
+		if fr.owner != r.PathValue("owner") || fr.repo != r.PathValue("repo") || fr.workflowFile != r.PathValue("workflow") {
+			continue
+		}
+		if event != "" && fr.run.GetEvent() != event {
+			continue
+		}
+		runs = append(runs, fr.run)
+	}
+
+	start, end := paginateFake(w, r, len(runs))
+	writeFakeJSON(w, http.StatusOK, &github.WorkflowRuns{
+		TotalCount:   github.Ptr(len(runs)),
+		WorkflowRuns: runs[start:end],
+	})
+}
+
+func (f *fakeGitHubServer) handleGetWorkflowRun(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fr := f.findRun(r)
+	if fr == nil {
+		writeFakeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		return
+	}
+	fr.advance()
+	writeFakeJSON(w, http.StatusOK, fr.run)
+}
+
+func (f *fakeGitHubServer) handleListWorkflowJobs(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fr := f.findRun(r)
+	if fr == nil {
+		writeFakeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		return
+	}
+	fr.advance()
+
+	start, end := paginateFake(w, r, len(fr.jobs))
+	writeFakeJSON(w, http.StatusOK, &github.Jobs{
+		TotalCount: github.Ptr(len(fr.jobs)),
+		Jobs:       fr.jobs[start:end],
+	})
+}
+
+// findJob returns the registered job with the request's job_id in the request's owner and repo.
+// Must be called with f.mu held.
+func (f *fakeGitHubServer) findJob(r *http.Request, owner, repo string) *github.WorkflowJob {
+	jobID, err := strconv.ParseInt(r.PathValue("job_id"), 10, 64)
+	if err != nil {
+		return nil
+	}
+	for _, fr := range f.runs {
+		if owner != "" && (fr.owner != owner || fr.repo != repo) {
+			continue
+		}
+		for _, job := range fr.jobs {
+			if job.GetID() == jobID {
+				return job
+			}
+		}
+	}
+	return nil
+}
+
+func (f *fakeGitHubServer) handleGetWorkflowJobLogs(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	job := f.findJob(r, r.PathValue("owner"), r.PathValue("repo"))
+	if job == nil {
+		writeFakeJSON(w, http.StatusNotFound, map[string]string{"message": "Not Found"})
+		return
+	}
+	// Like the real API, redirect to a short-lived download URL
+	w.Header().Set("Location", fmt.Sprintf("%s/_logs/%d", f.URL, job.GetID()))
+	w.WriteHeader(http.StatusFound)
+}
+
+func (f *fakeGitHubServer) handleDownloadJobLogs(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	job := f.findJob(r, "", "")
+	if job == nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	fmt.Fprintf(w, "2025-01-02T03:04:05.0000000Z Job %s ran on %s\n", job.GetName(), job.GetRunnerName())
+}
+
+func (f *fakeGitHubServer) handleDispatchWorkflow(w http.ResponseWriter, r *http.Request) {
+	var event github.CreateWorkflowDispatchEventRequest
+	if err := json.NewDecoder(r.Body).Decode(&event); err != nil || event.Ref == "" {
+		writeFakeJSON(w, http.StatusUnprocessableEntity, map[string]string{"message": "Invalid request"})
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.dispatches = append(f.dispatches, event)
+	f.nextRunID++
+	runID := f.nextRunID
+	now := github.Timestamp{Time: time.Now()}
+
+	f.runs = append(f.runs, &fakeWorkflowRun{
+		owner:        r.PathValue("owner"),
+		repo:         r.PathValue("repo"),
+		workflowFile: r.PathValue("workflow"),
+		run: &github.WorkflowRun{
+			ID:           github.Ptr(runID),
+			Name:         github.Ptr("RunsOn test"),
+			DisplayTitle: github.Ptr(fmt.Sprintf("RunsOn test %v", event.Inputs["test_id"])),
+			Event:        github.Ptr("workflow_dispatch"),
+			HeadBranch:   github.Ptr(event.Ref),
+			Status:       github.Ptr("queued"),
+			Conclusion:   github.Ptr("success"),
+			CreatedAt:    &now,
+		},
+		jobs: []*github.WorkflowJob{
+			{
+				ID:         github.Ptr(runID * 10),
+				RunID:      github.Ptr(runID),
+				Name:       github.Ptr("test"),
+				Status:     github.Ptr("queued"),
+				Labels:     []string{fmt.Sprintf("runs-on=%d/runner=2cpu-linux-x64", runID)},
+				RunnerName: github.Ptr(fmt.Sprintf("runs-on-%d", runID)),
+			},
+		},
+		statuses: []string{"queued", "in_progress", "completed"},
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// paginateFake returns the [start, end) slice bounds for the requested page of total items
+// and sets a Link header pointing to the next page if there is one.
+func paginateFake(w http.ResponseWriter, r *http.Request, total int) (int, int) {
+	perPage, err := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if err != nil || perPage <= 0 {
+		perPage = 30
+	}
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page <= 0 {
+		page = 1
+	}
+
+	start := min((page-1)*perPage, total)
+	end := min(start+perPage, total)
+
+	if end < total {
+		next := *r.URL
+		query := next.Query()
+		query.Set("page", strconv.Itoa(page+1))
+		query.Set("per_page", strconv.Itoa(perPage))
+		next.RawQuery = query.Encode()
+		w.Header().Set("Link", fmt.Sprintf(`<http://%s%s>; rel="next"`, r.Host, next.RequestURI()))
+	}
+
+	return start, end
+}
+
+// writeFakeFault writes an injected failure response.
+func writeFakeFault(w http.ResponseWriter, fault fakeFault) {
+	if !fault.rateLimitReset.IsZero() {
+		w.Header().Set("X-RateLimit-Limit", "5000")
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(fault.rateLimitReset.Unix(), 10))
+		writeFakeJSON(w, fault.status, map[string]string{"message": "API rate limit exceeded"})
+		return
+	}
+	writeFakeJSON(w, fault.status, map[string]string{"message": http.StatusText(fault.status)})
+}
+
+// writeFakeJSON writes v as a JSON response with the given status code.
+func writeFakeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
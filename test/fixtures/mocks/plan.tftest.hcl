@@ -0,0 +1,33 @@
+# Plans the root module against mock providers, so no AWS credentials are needed.
+# Copied into the tests/ directory of a temporary copy of the module by MockPlanModule;
+# variables are passed per case with -var-file.
+
+mock_provider "aws" {
+  mock_data "aws_caller_identity" {
+    defaults = {
+      account_id = "123456789012"
+      arn        = "arn:aws:iam::123456789012:user/mock"
+      user_id    = "AIDAMOCKUSER"
+    }
+  }
+
+  mock_data "aws_region" {
+    defaults = {
+      region = "us-east-1"
+    }
+  }
+
+  mock_data "aws_iam_policy_document" {
+    defaults = {
+      json = "{\"Version\":\"2012-10-17\",\"Statement\":[]}"
+    }
+  }
+}
+
+mock_provider "time" {}
+
+mock_provider "archive" {}
+
+run "plan" {
+  command = plan
+}
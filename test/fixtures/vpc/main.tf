@@ -45,3 +45,26 @@ module "vpc" {
     AutoCleanup = "true"
   }
 }
+
+# Custom security group passed to the module as security_group_ids
+resource "aws_security_group" "custom" {
+  count = var.create_security_group ? 1 : 0
+
+  name_prefix = "test-runs-on-custom-${var.test_id}-"
+  description = "Caller-supplied security group for terratest"
+  vpc_id      = module.vpc.vpc_id
+
+  egress {
+    description = "Allow all outbound traffic"
+    from_port   = 0
+    to_port     = 0
+    protocol    = "-1"
+    cidr_blocks = ["0.0.0.0/0"]
+  }
+
+  tags = {
+    Name        = "test-runs-on-custom-sg"
+    Purpose     = "terratest"
+    AutoCleanup = "true"
+  }
+}
@@ -12,3 +12,8 @@ output "private_subnets" {
   description = "List of private subnet IDs"
   value       = module.vpc.private_subnets
 }
+
+output "custom_security_group_id" {
+  description = "ID of the custom security group (empty if not created)"
+  value       = var.create_security_group ? aws_security_group.custom[0].id : ""
+}
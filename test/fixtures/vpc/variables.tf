@@ -14,3 +14,9 @@ variable "enable_nat" {
   type        = bool
   default     = false
 }
+
+variable "create_security_group" {
+  description = "Create a custom security group for bring-your-own security group scenarios"
+  type        = bool
+  default     = false
+}
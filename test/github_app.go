@@ -0,0 +1,548 @@
+package test
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/google/go-github/v68/github"
+)
+
+// =============================================================================
+// GITHUB APP REGISTRATION HELPERS
+// =============================================================================
+
+// ErrNoAppManifestForm is returned by FetchAppManifestForm when the page has no manifest form.
+// That alone does not mean an app is registered: error and login pages have no form either.
+var ErrNoAppManifestForm = errors.New("registration page has no manifest form")
+
+// GitHubAppCredentials holds the credentials of a GitHub App, in the shape returned by the
+// manifest conversion (POST /app-manifests/{code}/conversions).
+type GitHubAppCredentials struct {
+	ID            int64  `json:"id"`
+	Slug          string `json:"slug,omitempty"`
+	ClientID      string `json:"client_id,omitempty"`
+	ClientSecret  string `json:"client_secret,omitempty"`
+	WebhookSecret string `json:"webhook_secret"`
+	PEM           string `json:"pem"`
+}
+
+// GitHubAppManifest is the subset of a GitHub App manifest the helpers need.
+type GitHubAppManifest struct {
+	Name           string `json:"name"`
+	URL            string `json:"url"`
+	RedirectURL    string `json:"redirect_url"`
+	HookAttributes struct {
+		URL string `json:"url"`
+	} `json:"hook_attributes"`
+}
+
+// AppManifestForm is the registration form served by the RunsOn App Runner service.
+type AppManifestForm struct {
+	// Action is the GitHub URL the form posts the manifest to
+	Action string
+
+	// State is the anti-forgery token GitHub echoes back to the redirect URL
+	State string
+
+	// RawManifest is the manifest JSON exactly as served by the app
+	RawManifest string
+
+	Manifest GitHubAppManifest
+}
+
+var (
+	formActionPattern    = regexp.MustCompile(`(?is)<form[^>]*\saction\s*=\s*("[^"]*"|'[^']*')`)
+	manifestInputPattern = regexp.MustCompile(`(?is)<input[^>]*\sname\s*=\s*["']manifest["'][^>]*>`)
+	inputValuePattern    = regexp.MustCompile(`(?is)\svalue\s*=\s*("[^"]*"|'[^']*')`)
+	pageTitlePattern     = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	htmlTagPattern       = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// appCredentialsKey is the config bucket key of the app credentials, which must match where the
+// deployed RunsOn version keeps them.
+func appCredentialsKey() string {
+	return GetOptionalEnv("RUNS_ON_TEST_APP_CREDENTIALS_KEY", "runs-on/db/github-app.json")
+}
+
+// pageSummary returns the title of a page, or the start of its text, to tell pages apart in errors.
+func pageSummary(page string) string {
+	if match := pageTitlePattern.FindStringSubmatch(page); match != nil {
+		return strings.TrimSpace(html.UnescapeString(match[1]))
+	}
+	return truncateString(strings.Join(strings.Fields(html.UnescapeString(htmlTagPattern.ReplaceAllString(page, " "))), " "), 200)
+}
+
+// appBaseURL returns the app URL with an https:// scheme unless one is already present.
+// Scenario outputs expose the App Runner URL without a scheme.
+func appBaseURL(appURL string) string {
+	if strings.Contains(appURL, "://") {
+		return strings.TrimSuffix(appURL, "/")
+	}
+	return "https://" + strings.TrimSuffix(appURL, "/")
+}
+
+// FetchAppManifestForm fetches the registration page of the App Runner service and extracts the
+// GitHub App manifest form. Returns ErrNoAppManifestForm if the page has no manifest form.
+func FetchAppManifestForm(appURL string) (*AppManifestForm, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	resp, err := client.Get(appBaseURL(appURL) + "/")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch registration page: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read registration page: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("registration page returned status %d", resp.StatusCode)
+	}
+
+	return parseAppManifestForm(string(body))
+}
+
+// parseAppManifestForm extracts the manifest form from a registration page.
+func parseAppManifestForm(page string) (*AppManifestForm, error) {
+	input := manifestInputPattern.FindString(page)
+	if input == "" {
+		return nil, fmt.Errorf("%w (page: %q)", ErrNoAppManifestForm, pageSummary(page))
+	}
+
+	valueMatch := inputValuePattern.FindStringSubmatch(input)
+	if valueMatch == nil {
+		return nil, fmt.Errorf("manifest input has no value")
+	}
+	actionMatch := formActionPattern.FindStringSubmatch(page)
+	if actionMatch == nil {
+		return nil, fmt.Errorf("registration page has no form action")
+	}
+
+	form := &AppManifestForm{
+		Action:      html.UnescapeString(strings.Trim(actionMatch[1], `"'`)),
+		RawManifest: html.UnescapeString(strings.Trim(valueMatch[1], `"'`)),
+	}
+	if err := json.Unmarshal([]byte(form.RawManifest), &form.Manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest JSON: %w", err)
+	}
+
+	action, err := url.Parse(form.Action)
+	if err != nil || !action.IsAbs() {
+		return nil, fmt.Errorf("form action %q is not an absolute URL", form.Action)
+	}
+	form.State = action.Query().Get("state")
+	if form.Manifest.RedirectURL == "" {
+		return nil, fmt.Errorf("manifest has no redirect_url")
+	}
+
+	return form, nil
+}
+
+// SubmitAppManifest posts the manifest to GitHub as the browser would and returns the code from
+// GitHub's redirect to the manifest redirect_url.
+// github.com asks a signed-in person to confirm the app first, so outside of a fake API this only
+// succeeds when GitHub redirects straight back - use pre-created app credentials otherwise.
+func SubmitAppManifest(form *AppManifestForm) (string, error) {
+	client := &http.Client{
+		Timeout: 30 * time.Second,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	resp, err := client.PostForm(form.Action, url.Values{"manifest": {form.RawManifest}})
+	if err != nil {
+		return "", fmt.Errorf("failed to submit manifest: %w", err)
+	}
+	defer resp.Body.Close()
+
+	location, err := resp.Location()
+	if err != nil {
+		return "", fmt.Errorf("GitHub did not redirect after manifest submission (status %d)", resp.StatusCode)
+	}
+
+	code := location.Query().Get("code")
+	if code == "" {
+		return "", fmt.Errorf("GitHub did not issue a manifest code (redirected to %s) - confirm the app in a browser or use pre-created app credentials", location.Redacted())
+	}
+	if state := location.Query().Get("state"); state != form.State {
+		return "", fmt.Errorf("manifest redirect state %q does not match form state %q", state, form.State)
+	}
+
+	return code, nil
+}
+
+// CompleteAppManifestCallback delivers the manifest code to the app's redirect_url, where the app
+// exchanges it for its credentials (POST /app-manifests/{code}/conversions).
+func CompleteAppManifestCallback(form *AppManifestForm, code string) error {
+	callback, err := url.Parse(form.Manifest.RedirectURL)
+	if err != nil {
+		return fmt.Errorf("invalid redirect_url %q: %w", form.Manifest.RedirectURL, err)
+	}
+
+	query := callback.Query()
+	query.Set("code", code)
+	query.Set("state", form.State)
+	callback.RawQuery = query.Encode()
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Get(callback.String())
+	if err != nil {
+		return fmt.Errorf("failed to call app redirect_url: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		body, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("app redirect_url returned status %d: %s", resp.StatusCode, truncateString(string(body), 200))
+	}
+	return nil
+}
+
+// ConvertAppManifest exchanges a manifest code for the app credentials
+// (POST /app-manifests/{code}/conversions). The endpoint needs no authentication and each code
+// can only be converted once.
+func ConvertAppManifest(opts GitHubOptions, code string) (*GitHubAppCredentials, error) {
+	client, err := newGitHubClient(nil, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, _, err := client.Apps.CompleteAppManifest(context.Background(), code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert app manifest code: %w", err)
+	}
+
+	return &GitHubAppCredentials{
+		ID:            cfg.GetID(),
+		Slug:          cfg.GetSlug(),
+		ClientID:      cfg.GetClientID(),
+		ClientSecret:  cfg.GetClientSecret(),
+		WebhookSecret: cfg.GetWebhookSecret(),
+		PEM:           cfg.GetPEM(),
+	}, nil
+}
+
+// GetGitHubAppCredentialsFromEnv loads pre-created app credentials from RUNS_ON_TEST_APP_ID,
+// RUNS_ON_TEST_APP_PRIVATE_KEY (PEM contents or a path to the PEM file) and
+// RUNS_ON_TEST_APP_WEBHOOK_SECRET. Returns nil if RUNS_ON_TEST_APP_ID is not set.
+func GetGitHubAppCredentialsFromEnv() (*GitHubAppCredentials, error) {
+	appID := os.Getenv("RUNS_ON_TEST_APP_ID")
+	if appID == "" {
+		return nil, nil
+	}
+
+	id, err := strconv.ParseInt(appID, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid RUNS_ON_TEST_APP_ID %q: %w", appID, err)
+	}
+
+	privateKey := os.Getenv("RUNS_ON_TEST_APP_PRIVATE_KEY")
+	if privateKey == "" {
+		return nil, fmt.Errorf("RUNS_ON_TEST_APP_PRIVATE_KEY is required with RUNS_ON_TEST_APP_ID")
+	}
+	if !strings.HasPrefix(strings.TrimSpace(privateKey), "-----BEGIN") {
+		data, err := os.ReadFile(privateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read RUNS_ON_TEST_APP_PRIVATE_KEY file: %w", err)
+		}
+		privateKey = string(data)
+	}
+
+	webhookSecret := os.Getenv("RUNS_ON_TEST_APP_WEBHOOK_SECRET")
+	if webhookSecret == "" {
+		return nil, fmt.Errorf("RUNS_ON_TEST_APP_WEBHOOK_SECRET is required with RUNS_ON_TEST_APP_ID")
+	}
+
+	return &GitHubAppCredentials{
+		ID:            id,
+		ClientID:      os.Getenv("RUNS_ON_TEST_APP_CLIENT_ID"),
+		ClientSecret:  os.Getenv("RUNS_ON_TEST_APP_CLIENT_SECRET"),
+		WebhookSecret: webhookSecret,
+		PEM:           privateKey,
+	}, nil
+}
+
+// githubAppJWT signs the short-lived RS256 JWT a GitHub App authenticates app-level calls with.
+func githubAppJWT(creds *GitHubAppCredentials, now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(creds.PEM))
+	if block == nil {
+		return "", fmt.Errorf("app private key is not PEM encoded")
+	}
+
+	var key *rsa.PrivateKey
+	if parsed, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		key = parsed
+	} else {
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse app private key: %w", err)
+		}
+		rsaKey, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return "", fmt.Errorf("app private key is not an RSA key")
+		}
+		key = rsaKey
+	}
+
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	// Backdated to allow for clock drift, GitHub caps the lifetime at 10 minutes
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-60 * time.Second).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": strconv.FormatInt(creds.ID, 10),
+	})
+
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign app JWT: %w", err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// UpdateGitHubAppWebhook points a pre-created app's webhook at a freshly deployed stack
+// (PATCH /app/hook/config, authenticated as the app).
+func UpdateGitHubAppWebhook(opts GitHubOptions, creds *GitHubAppCredentials, webhookURL string) error {
+	token, err := githubAppJWT(creds, time.Now())
+	if err != nil {
+		return err
+	}
+
+	client, err := newGitHubClient(nil, opts)
+	if err != nil {
+		return err
+	}
+	client = client.WithAuthToken(token)
+
+	_, _, err = client.Apps.UpdateHookConfig(context.Background(), &github.HookConfig{
+		URL:         github.Ptr(webhookURL),
+		ContentType: github.Ptr("json"),
+		Secret:      github.Ptr(creds.WebhookSecret),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to update app webhook: %w", err)
+	}
+	return nil
+}
+
+// InstallGitHubAppCredentials writes app credentials to the stack's config bucket under
+// RUNS_ON_TEST_APP_CREDENTIALS_KEY (default: runs-on/db/github-app.json), the key must match
+// where the deployed RunsOn version reads its app credentials from.
+func InstallGitHubAppCredentials(configBucket string, creds *GitHubAppCredentials) error {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := s3.NewFromConfig(cfg)
+
+	key := appCredentialsKey()
+	body, err := json.Marshal(creds)
+	if err != nil {
+		return fmt.Errorf("failed to encode app credentials: %w", err)
+	}
+
+	_, err = client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(configBucket),
+		Key:         aws.String(key),
+		Body:        strings.NewReader(string(body)),
+		ContentType: aws.String("application/json"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write app credentials to s3://%s/%s: %w", configBucket, key, err)
+	}
+	return nil
+}
+
+// GitHubAppCredentialsInstalled reports whether the stack's config bucket holds app credentials
+// under RUNS_ON_TEST_APP_CREDENTIALS_KEY, which is where a registered app keeps them.
+func GitHubAppCredentialsInstalled(configBucket string) (bool, error) {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := s3.NewFromConfig(cfg)
+
+	key := appCredentialsKey()
+	_, err := client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(configBucket),
+		Key:    aws.String(key),
+	})
+	var notFound *s3types.NotFound
+	if errors.As(err, &notFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check for app credentials at s3://%s/%s: %w", configBucket, key, err)
+	}
+	return true, nil
+}
+
+// GetStackAppCredentials returns the app credentials in the stack's config bucket under
+// RUNS_ON_TEST_APP_CREDENTIALS_KEY, or nil if no app is registered for the stack.
+func GetStackAppCredentials(configBucket string) (*GitHubAppCredentials, error) {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := s3.NewFromConfig(cfg)
+
+	key := appCredentialsKey()
+	result, err := client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(configBucket),
+		Key:    aws.String(key),
+	})
+	var noSuchKey *s3types.NoSuchKey
+	if errors.As(err, &noSuchKey) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read app credentials at s3://%s/%s: %w", configBucket, key, err)
+	}
+	defer result.Body.Close()
+
+	var creds GitHubAppCredentials
+	if err := json.NewDecoder(result.Body).Decode(&creds); err != nil {
+		return nil, fmt.Errorf("failed to decode app credentials at s3://%s/%s: %w", configBucket, key, err)
+	}
+	return &creds, nil
+}
+
+// appRegistered reports whether the stack has a GitHub App registered, with opts.AppRegistered or
+// else from the app credentials in configBucket. Without either, registration cannot be confirmed.
+func appRegistered(opts GitHubOptions, configBucket string) (bool, error) {
+	if opts.AppRegistered != nil {
+		return opts.AppRegistered()
+	}
+	if configBucket == "" {
+		return false, fmt.Errorf("no config bucket to confirm the GitHub App registration in")
+	}
+	return GitHubAppCredentialsInstalled(configBucket)
+}
+
+// sharedAppMu is held by the scenario currently using the pre-created app, see LockSharedGitHubApp.
+var sharedAppMu sync.Mutex
+
+// LockSharedGitHubApp reserves the pre-created app (RUNS_ON_TEST_APP_ID) for the calling test until
+// it ends. The app has one webhook, which RegisterGitHubApp points at the registering stack, so
+// parallel scenarios must not overlap from registration until their dispatched run is observed.
+// Does nothing without a pre-created app: the manifest flow creates an app per stack.
+// Call it at most once per test, before RegisterGitHubApp.
+func LockSharedGitHubApp(t *testing.T) {
+	if os.Getenv("RUNS_ON_TEST_APP_ID") == "" {
+		return
+	}
+	waitingSince := time.Now()
+	sharedAppMu.Lock()
+	t.Cleanup(sharedAppMu.Unlock)
+	t.Logf("✓ Pre-created GitHub App reserved for %s (waited %s)", t.Name(), time.Since(waitingSince).Round(time.Second))
+}
+
+// RegisterGitHubApp connects a deployed stack to GitHub without a browser.
+//
+// With pre-created app credentials (RUNS_ON_TEST_APP_ID etc.) the app's webhook is pointed at the
+// stack and the credentials are written to configBucket (skipped if configBucket is empty).
+// Otherwise the manifest flow is driven end to end: fetch the stack's registration form, submit
+// the manifest to GitHub and deliver the returned code to the app, which performs the conversion.
+// Does nothing if the stack already has an app registered, i.e. its app credentials are in
+// configBucket (see appRegistered), except that a pre-created app's webhook is pointed back at the
+// stack (StackWebhookURL), since other stacks may have taken it since. A page without a manifest
+// form is an error otherwise. Callers sharing a pre-created app hold LockSharedGitHubApp.
+func RegisterGitHubApp(t *testing.T, opts GitHubOptions, appURL, configBucket string) error {
+	creds, err := GetGitHubAppCredentialsFromEnv()
+	if err != nil {
+		return err
+	}
+
+	if configBucket != "" || opts.AppRegistered != nil {
+		registered, err := appRegistered(opts, configBucket)
+		if err != nil {
+			return err
+		}
+		if registered && creds != nil {
+			webhookURL := StackWebhookURL(appURL)
+			if err := UpdateGitHubAppWebhook(opts, creds, webhookURL); err != nil {
+				return err
+			}
+			t.Logf("✓ GitHub App already registered, app %d webhook points at %s", creds.ID, webhookURL)
+			return nil
+		}
+		if registered {
+			t.Log("✓ GitHub App already registered")
+			return nil
+		}
+	}
+
+	form, err := FetchAppManifestForm(appURL)
+	if err != nil {
+		return fmt.Errorf("stack has no GitHub App registered: %w", err)
+	}
+	t.Logf("Registration form for app '%s' (webhook: %s)", form.Manifest.Name, form.Manifest.HookAttributes.URL)
+
+	if creds != nil {
+		t.Logf("Using pre-created GitHub App %d", creds.ID)
+		if err := UpdateGitHubAppWebhook(opts, creds, form.Manifest.HookAttributes.URL); err != nil {
+			return err
+		}
+		t.Logf("✓ App %d webhook points at %s", creds.ID, form.Manifest.HookAttributes.URL)
+
+		if configBucket == "" {
+			t.Log("No config bucket given - skipping credentials upload")
+			return nil
+		}
+		if err := InstallGitHubAppCredentials(configBucket, creds); err != nil {
+			return err
+		}
+		t.Logf("✓ App %d credentials written to s3://%s/%s", creds.ID, configBucket, appCredentialsKey())
+		return nil
+	}
+
+	if configBucket == "" && opts.AppRegistered == nil {
+		return fmt.Errorf("no config bucket to confirm the manifest flow registered the app in")
+	}
+	code, err := SubmitAppManifest(form)
+	if err != nil {
+		return err
+	}
+	if err := CompleteAppManifestCallback(form, code); err != nil {
+		return err
+	}
+
+	// The app performs the conversion itself and stores the credentials it gets back
+	deadline := time.Now().Add(2 * time.Minute)
+	pollInterval := opts.pollIntervalOr(5 * time.Second)
+	for {
+		registered, err := appRegistered(opts, configBucket)
+		if err != nil {
+			return err
+		}
+		if registered {
+			t.Logf("✓ GitHub App '%s' registered via manifest flow", form.Manifest.Name)
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("app holds no credentials 2m after the manifest callback")
+		}
+		sleepUntilRetry(pollInterval, deadline)
+	}
+}
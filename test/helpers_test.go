@@ -0,0 +1,406 @@
+package test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v68/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// These tests exercise the integration helpers offline against a fake GitHub API.
+// They do not deploy any infrastructure and need no credentials.
+
+const (
+	fakeTestRepo     = "test-org/test-repo"
+	fakeTestWorkflow = "test.yml"
+)
+
+// newFakeCompletedRun returns a completed workflow_dispatch run with a single completed job.
+func newFakeCompletedRun(runID int64) (*github.WorkflowRun, *github.WorkflowJob) {
+	now := github.Timestamp{Time: time.Now()}
+	run := &github.WorkflowRun{
+		ID:         github.Ptr(runID),
+		Event:      github.Ptr("workflow_dispatch"),
+		Status:     github.Ptr("completed"),
+		Conclusion: github.Ptr("success"),
+		CreatedAt:  &now,
+	}
+	job := &github.WorkflowJob{
+		ID:         github.Ptr(runID * 10),
+		RunID:      github.Ptr(runID),
+		Name:       github.Ptr("test"),
+		Status:     github.Ptr("completed"),
+		Conclusion: github.Ptr("success"),
+		RunnerName: github.Ptr("runs-on-test-runner"),
+	}
+	return run, job
+}
+
+// assertEnterpriseLayout checks every request the fake received used the GHES /api/v3/ layout.
+func assertEnterpriseLayout(t *testing.T, server *fakeGitHubServer) {
+	uris := server.requestURIs()
+	require.NotEmpty(t, uris, "Fake GHES API should have received requests")
+	for _, uri := range uris {
+		assert.True(t, strings.HasPrefix(uri, "/api/v3/repos/"), "Request %s should use the GHES API layout", uri)
+	}
+}
+
+func TestGetGitHubClientDefaultURL(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "test-token")
+	t.Setenv("GITHUB_ENTERPRISE_URL", "https://ghes.example.com")
+
+	client, err := getGitHubClient(GitHubOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, "https://api.github.com/", client.BaseURL.String(), "GITHUB_ENTERPRISE_URL is only read by the GHES scenario")
+}
+
+func TestGetGitHubClientEnterpriseURL(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "test-token")
+
+	client, err := getGitHubClient(GitHubOptions{EnterpriseURL: "https://ghes.example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://ghes.example.com/api/v3/", client.BaseURL.String())
+	assert.Equal(t, "https://ghes.example.com/api/uploads/", client.UploadURL.String())
+}
+
+func TestGetGitHubClientRequiresToken(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "")
+
+	_, err := getGitHubClient(GitHubOptions{})
+	assert.Error(t, err)
+}
+
+func TestWatchForWorkflowRunEnterprise(t *testing.T) {
+	server := newFakeGHESServer(t)
+	t.Setenv("GITHUB_TOKEN", "test-token")
+	opts := GitHubOptions{EnterpriseURL: server.URL}
+
+	testID := GetTestID()
+	run, job := newFakeCompletedRun(1001)
+	run.DisplayTitle = github.Ptr("RunsOn test " + testID)
+	server.addRun(fakeTestRepo, fakeTestWorkflow, run, job)
+
+	runID, err := WatchForWorkflowRunWithOptions(t, opts, fakeTestRepo, fakeTestWorkflow, testID, time.Now(), time.Minute)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1001), runID)
+	assertEnterpriseLayout(t, server)
+}
+
+func TestMonitorWorkflowJobStatesEnterprise(t *testing.T) {
+	server := newFakeGHESServer(t)
+	t.Setenv("GITHUB_TOKEN", "test-token")
+	opts := GitHubOptions{EnterpriseURL: server.URL}
+
+	run, job := newFakeCompletedRun(1002)
+	server.addRun(fakeTestRepo, fakeTestWorkflow, run, job)
+
+	err := MonitorWorkflowJobStatesWithOptions(t, opts, fakeTestRepo, 1002, time.Minute)
+	require.NoError(t, err)
+	assertEnterpriseLayout(t, server)
+}
+
+func TestWaitForWorkflowCompletionEnterprise(t *testing.T) {
+	server := newFakeGHESServer(t)
+	t.Setenv("GITHUB_TOKEN", "test-token")
+	opts := GitHubOptions{EnterpriseURL: server.URL}
+
+	run, job := newFakeCompletedRun(1003)
+	run.Conclusion = github.Ptr("failure")
+	server.addRun(fakeTestRepo, fakeTestWorkflow, run, job)
+
+	conclusion := WaitForWorkflowCompletionWithOptions(t, opts, fakeTestRepo, 1003, time.Minute)
+	assert.Equal(t, "failure", conclusion)
+	assertEnterpriseLayout(t, server)
+}
+
+// newFakeGitHubTarget starts a fake api.github.com-layout API and returns helper options
+// pointing at it with a fast poll interval.
+func newFakeGitHubTarget(t *testing.T) (*fakeGitHubServer, GitHubOptions) {
+	server := newFakeGitHubServer(t, "")
+	t.Setenv("GITHUB_TOKEN", "test-token")
+	return server, GitHubOptions{BaseURL: server.URL, PollInterval: 10 * time.Millisecond}
+}
+
+// countRequests returns how many requests the fake received for URIs containing substr.
+func countRequests(server *fakeGitHubServer, substr string) int {
+	count := 0
+	for _, uri := range server.requestURIs() {
+		if strings.Contains(uri, substr) {
+			count++
+		}
+	}
+	return count
+}
+
+func TestGetGitHubClientBaseURL(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "test-token")
+
+	client, err := getGitHubClient(GitHubOptions{BaseURL: "http://127.0.0.1:8080", EnterpriseURL: "https://ghes.example.com"})
+	require.NoError(t, err)
+	assert.Equal(t, "http://127.0.0.1:8080/", client.BaseURL.String(), "BaseURL should take precedence over EnterpriseURL")
+}
+
+func TestGitHubRetryDelay(t *testing.T) {
+	pollInterval := time.Second
+
+	assert.Equal(t, pollInterval, githubRetryDelay(errors.New("boom"), pollInterval))
+
+	rateLimitErr := &github.RateLimitError{Rate: github.Rate{Reset: github.Timestamp{Time: time.Now().Add(time.Minute)}}}
+	delay := githubRetryDelay(rateLimitErr, pollInterval)
+	assert.Greater(t, delay, 55*time.Second, "Primary rate limit should wait until reset")
+	assert.LessOrEqual(t, delay, time.Minute)
+
+	expiredErr := &github.RateLimitError{Rate: github.Rate{Reset: github.Timestamp{Time: time.Now().Add(-time.Minute)}}}
+	assert.Equal(t, pollInterval, githubRetryDelay(expiredErr, pollInterval), "Expired reset should use poll interval")
+
+	abuseErr := &github.AbuseRateLimitError{RetryAfter: github.Ptr(30 * time.Second)}
+	assert.Equal(t, 30*time.Second, githubRetryDelay(abuseErr, pollInterval), "Secondary rate limit should honour Retry-After")
+}
+
+func TestWaitForWorkflowCompletionTransitions(t *testing.T) {
+	server, opts := newFakeGitHubTarget(t)
+
+	run, job := newFakeCompletedRun(2001)
+	fr := server.addRun(fakeTestRepo, fakeTestWorkflow, run, job)
+	fr.statuses = []string{"queued", "queued", "in_progress", "in_progress", "completed"}
+
+	conclusion := WaitForWorkflowCompletionWithOptions(t, opts, fakeTestRepo, 2001, 5*time.Second)
+	assert.Equal(t, "success", conclusion)
+	assert.Equal(t, 5, countRequests(server, "/actions/runs/2001"), "Should poll until the run completes")
+}
+
+func TestWaitForWorkflowCompletionTimeout(t *testing.T) {
+	server, opts := newFakeGitHubTarget(t)
+
+	run, job := newFakeCompletedRun(2002)
+	fr := server.addRun(fakeTestRepo, fakeTestWorkflow, run, job)
+	fr.statuses = []string{"queued", "in_progress"}
+
+	conclusion := WaitForWorkflowCompletionWithOptions(t, opts, fakeTestRepo, 2002, 200*time.Millisecond)
+	assert.Empty(t, conclusion, "Should return empty conclusion on timeout")
+}
+
+func TestWaitForWorkflowCompletionTransientErrors(t *testing.T) {
+	server, opts := newFakeGitHubTarget(t)
+
+	run, job := newFakeCompletedRun(2003)
+	server.addRun(fakeTestRepo, fakeTestWorkflow, run, job)
+	server.failNext(2, http.StatusBadGateway)
+	server.failNext(1, http.StatusServiceUnavailable)
+
+	conclusion := WaitForWorkflowCompletionWithOptions(t, opts, fakeTestRepo, 2003, 5*time.Second)
+	assert.Equal(t, "success", conclusion, "Should retry through transient 5xx errors")
+	assert.Equal(t, 4, countRequests(server, "/actions/runs/2003"))
+}
+
+func TestWaitForWorkflowCompletionRateLimited(t *testing.T) {
+	server, opts := newFakeGitHubTarget(t)
+
+	run, job := newFakeCompletedRun(2004)
+	server.addRun(fakeTestRepo, fakeTestWorkflow, run, job)
+
+	// X-RateLimit-Reset has one-second resolution, so this resets 1-2s from now
+	server.rateLimitNext(1, time.Now().Add(2*time.Second))
+
+	start := time.Now()
+	conclusion := WaitForWorkflowCompletionWithOptions(t, opts, fakeTestRepo, 2004, 10*time.Second)
+	assert.Equal(t, "success", conclusion)
+	assert.GreaterOrEqual(t, time.Since(start), 900*time.Millisecond, "Should wait for the rate limit to reset")
+	assert.Equal(t, 2, countRequests(server, "/actions/runs/2004"), "Should not poll while rate limited")
+}
+
+func TestMonitorWorkflowJobStatesPickedUp(t *testing.T) {
+	server, opts := newFakeGitHubTarget(t)
+
+	run, job := newFakeCompletedRun(2005)
+	fr := server.addRun(fakeTestRepo, fakeTestWorkflow, run, job)
+	fr.statuses = []string{"queued", "queued", "in_progress"}
+
+	err := MonitorWorkflowJobStatesWithOptions(t, opts, fakeTestRepo, 2005, 5*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, 3, countRequests(server, "/actions/runs/2005/jobs"))
+}
+
+func TestMonitorWorkflowJobStatesStuckQueued(t *testing.T) {
+	server, opts := newFakeGitHubTarget(t)
+
+	run, job := newFakeCompletedRun(2006)
+	fr := server.addRun(fakeTestRepo, fakeTestWorkflow, run, job)
+	fr.statuses = []string{"queued"}
+
+	err := MonitorWorkflowJobStatesWithOptions(t, opts, fakeTestRepo, 2006, 200*time.Millisecond)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "stuck in 'queued' state")
+}
+
+func TestMonitorWorkflowJobStatesPagination(t *testing.T) {
+	server, opts := newFakeGitHubTarget(t)
+
+	// 150 queued jobs and one in progress on the second page (per_page is 100)
+	run, _ := newFakeCompletedRun(2007)
+	var jobs []*github.WorkflowJob
+	for i := 0; i < 150; i++ {
+		jobs = append(jobs, &github.WorkflowJob{
+			ID:     github.Ptr(int64(i)),
+			Name:   github.Ptr(fmt.Sprintf("matrix-%d", i)),
+			Status: github.Ptr("queued"),
+		})
+	}
+	jobs[120].Status = github.Ptr("in_progress")
+	server.addRun(fakeTestRepo, fakeTestWorkflow, run, jobs...)
+
+	err := MonitorWorkflowJobStatesWithOptions(t, opts, fakeTestRepo, 2007, time.Second)
+	require.NoError(t, err, "Should find the in-progress job on the second page")
+	assert.Equal(t, 2, countRequests(server, "/actions/runs/2007/jobs"))
+}
+
+func TestWatchForWorkflowRunPagination(t *testing.T) {
+	server, opts := newFakeGitHubTarget(t)
+	startTime := time.Now()
+
+	// 25 runs from before the test started, then the new run on the third page (per_page is 10)
+	for i := int64(0); i < 25; i++ {
+		run, job := newFakeCompletedRun(3000 + i)
+		run.CreatedAt = &github.Timestamp{Time: startTime.Add(-time.Hour)}
+		server.addRun(fakeTestRepo, fakeTestWorkflow, run, job)
+	}
+	pushRun, _ := newFakeCompletedRun(3100)
+	pushRun.Event = github.Ptr("push")
+	server.addRun(fakeTestRepo, fakeTestWorkflow, pushRun)
+	testID := GetTestID()
+	newRun, newJob := newFakeCompletedRun(3200)
+	newRun.DisplayTitle = github.Ptr("RunsOn test " + testID)
+	server.addRun(fakeTestRepo, fakeTestWorkflow, newRun, newJob)
+
+	runID, err := WatchForWorkflowRunWithOptions(t, opts, fakeTestRepo, fakeTestWorkflow, testID, startTime, 5*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3200), runID, "Should find the new workflow_dispatch run on a later page")
+	assert.Equal(t, 3, countRequests(server, "/actions/workflows/"+fakeTestWorkflow+"/runs"))
+}
+
+func TestWatchForWorkflowRunTimeout(t *testing.T) {
+	_, opts := newFakeGitHubTarget(t)
+
+	_, err := WatchForWorkflowRunWithOptions(t, opts, fakeTestRepo, fakeTestWorkflow, GetTestID(), time.Now(), 200*time.Millisecond)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timeout waiting for workflow run")
+}
+
+func TestWatchForWorkflowRunCorrelatesTestID(t *testing.T) {
+	server, opts := newFakeGitHubTarget(t)
+
+	// A concurrent test's run, created after ours started, must be ignored
+	otherRun, otherJob := newFakeCompletedRun(4001)
+	otherRun.DisplayTitle = github.Ptr("RunsOn test test-other-123")
+	server.addRun(fakeTestRepo, fakeTestWorkflow, otherRun, otherJob)
+
+	ownRun, ownJob := newFakeCompletedRun(4002)
+	ownRun.DisplayTitle = github.Ptr("RunsOn test test-own-456")
+	server.addRun(fakeTestRepo, fakeTestWorkflow, ownRun, ownJob)
+
+	runID, err := WatchForWorkflowRunWithOptions(t, opts, fakeTestRepo, fakeTestWorkflow, "test-own-456", time.Now(), 5*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4002), runID)
+}
+
+func TestWatchForWorkflowRunCorrelatesByJobName(t *testing.T) {
+	server, opts := newFakeGitHubTarget(t)
+
+	// Workflows without a run-name can surface the test_id input in a job or step name
+	run, job := newFakeCompletedRun(4003)
+	run.DisplayTitle = github.Ptr("RunsOn test")
+	job.Steps = []*github.TaskStep{{Name: github.Ptr("Test ID test-step-789")}}
+	server.addRun(fakeTestRepo, fakeTestWorkflow, run, job)
+
+	runID, err := WatchForWorkflowRunWithOptions(t, opts, fakeTestRepo, fakeTestWorkflow, "test-step-789", time.Now(), 5*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, int64(4003), runID)
+
+	_, err = WatchForWorkflowRunWithOptions(t, opts, fakeTestRepo, fakeTestWorkflow, "test-unknown-000", time.Now(), 100*time.Millisecond)
+	assert.Error(t, err, "Runs not correlated with the test ID should never match")
+}
+
+func TestDispatchWorkflow(t *testing.T) {
+	server, opts := newFakeGitHubTarget(t)
+
+	err := DispatchWorkflow(t, opts, fakeTestRepo, fakeTestWorkflow, "main", "test-dispatch-1")
+	require.NoError(t, err)
+
+	dispatches := server.dispatchRequests()
+	require.Len(t, dispatches, 1)
+	assert.Equal(t, "main", dispatches[0].Ref)
+	assert.Equal(t, "test-dispatch-1", dispatches[0].Inputs["test_id"])
+}
+
+func TestAutomatedModeEndToEnd(t *testing.T) {
+	server, opts := newFakeGitHubTarget(t)
+	startTime := time.Now()
+
+	// A concurrent test dispatches the same workflow first
+	require.NoError(t, DispatchWorkflow(t, opts, fakeTestRepo, fakeTestWorkflow, "main", "test-concurrent-1"))
+	require.NoError(t, DispatchWorkflow(t, opts, fakeTestRepo, fakeTestWorkflow, "main", "test-automated-1"))
+	require.Len(t, server.dispatchRequests(), 2)
+
+	runID, err := WatchForWorkflowRunWithOptions(t, opts, fakeTestRepo, fakeTestWorkflow, "test-automated-1", startTime, 5*time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, int64(9002), runID, "Should correlate the run dispatched with our test ID")
+
+	err = MonitorWorkflowJobStatesWithOptions(t, opts, fakeTestRepo, runID, 5*time.Second)
+	require.NoError(t, err)
+
+	conclusion := WaitForWorkflowCompletionWithOptions(t, opts, fakeTestRepo, runID, 5*time.Second)
+	assert.Equal(t, "success", conclusion)
+
+	ValidateWorkflowRunnerLabels(t, opts, fakeTestRepo, runID, []string{"runs-on=", "runner=2cpu-linux-x64"})
+}
+
+func TestGetIntegrationMode(t *testing.T) {
+	t.Setenv("RUNS_ON_TEST_MODE", "")
+	assert.Equal(t, IntegrationModeObserver, GetIntegrationMode())
+
+	t.Setenv("RUNS_ON_TEST_MODE", "automated")
+	assert.Equal(t, IntegrationModeAutomated, GetIntegrationMode())
+}
+
+func TestInstanceOSCommands(t *testing.T) {
+	t.Run("Linux", func(t *testing.T) {
+		assert.Equal(t, "aws sts get-caller-identity --query 'UserId' --output text", OSLinux.callerUserIDCommand("us-east-1"))
+		assert.Equal(t, "echo 'hello' | aws s3 cp - s3://bucket/cache/key --region us-east-1 2>&1",
+			OSLinux.s3WriteCommand("bucket", "cache/key", "hello", "us-east-1"))
+		assert.Equal(t, "aws s3 cp s3://bucket/cache/key - --region us-east-1 2>&1",
+			OSLinux.s3ReadCommand("bucket", "cache/key", "us-east-1"))
+		assert.Equal(t, "logger -t terratest 'entry from i-123'", OSLinux.logCommand("terratest", "entry from i-123"))
+	})
+
+	t.Run("Windows", func(t *testing.T) {
+		write := OSWindows.s3WriteCommand("bucket", "cache/key", "it's here", "us-east-1")
+		assert.Contains(t, write, "Write-S3Object -BucketName 'bucket' -Key 'cache/key' -Content 'it''s here' -Region 'us-east-1'")
+		assert.True(t, strings.HasPrefix(write, "try { $ErrorActionPreference = 'Stop'; "), write)
+		assert.True(t, strings.HasSuffix(write, "catch { Write-Output $_.Exception.Message; exit 1 }"), write)
+
+		read := OSWindows.s3ReadCommand("bucket", "cache/key", "us-east-1")
+		assert.Contains(t, read, "Read-S3Object -BucketName 'bucket' -Key 'cache/key' -File $f -Region 'us-east-1'")
+		assert.Contains(t, read, "Get-Content -Raw $f")
+
+		assert.Contains(t, OSWindows.callerUserIDCommand("eu-west-1"), "(Get-STSCallerIdentity -Region 'eu-west-1').UserId")
+		assert.Equal(t, "eventcreate /T INFORMATION /ID 100 /L APPLICATION /SO 'terratest' /D 'entry from i-123'",
+			OSWindows.logCommand("terratest", "entry from i-123"))
+	})
+
+	assert.Equal(t, "'plain'", psQuote("plain"))
+	assert.Equal(t, "'a''b'''", psQuote("a'b'"))
+}
+
+func TestTestInstanceArchitectures(t *testing.T) {
+	assert.Equal(t, []string{ArchX86_64, ArchARM64}, TestInstanceArchitectures)
+	assert.Equal(t, "t3.medium", testInstanceType(ArchX86_64))
+	assert.Equal(t, "t4g.medium", testInstanceType(ArchARM64))
+	assert.Equal(t, "x86_64", unameMachine(ArchX86_64))
+	assert.Equal(t, "aarch64", unameMachine(ArchARM64))
+}
@@ -0,0 +1,218 @@
+package test
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	cloudwatchlogstypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// =============================================================================
+// INSTANCE LOG PARSING
+// =============================================================================
+
+// userDataLogGroupPattern matches the RUNS_ON_LOG_GROUP_NAME export of user-data-linux.sh and
+// its $env: assignment in user-data-windows.ps1.
+var userDataLogGroupPattern = regexp.MustCompile(`(?m)^\s*(?:export\s+|\$env:)RUNS_ON_LOG_GROUP_NAME\s*=\s*"([^"]*)"`)
+
+// UserDataLogGroupName returns the log group the instance's user data hands to the agent in
+// RUNS_ON_LOG_GROUP_NAME.
+func UserDataLogGroupName(userData string) (string, error) {
+	matches := userDataLogGroupPattern.FindAllStringSubmatch(userData, -1)
+	switch len(matches) {
+	case 0:
+		return "", fmt.Errorf("user data does not set RUNS_ON_LOG_GROUP_NAME")
+	case 1:
+		return matches[0][1], nil
+	default:
+		return "", fmt.Errorf("user data sets RUNS_ON_LOG_GROUP_NAME %d times", len(matches))
+	}
+}
+
+// NewLogMarker returns a string unique to this run that is safe to pass to logger and eventcreate
+// unquoted and to use as a filter pattern term.
+func NewLogMarker(instanceID string) string {
+	return fmt.Sprintf("terratest-log-%s-%d", instanceID, time.Now().UnixNano())
+}
+
+// IsInstanceLogStream reports whether a log stream is named after the instance: the instance ID
+// itself, or the instance ID followed by a / and the source (e.g. i-0123/syslog).
+func IsInstanceLogStream(streamName, instanceID string) bool {
+	return streamName == instanceID || strings.HasPrefix(streamName, instanceID+"/")
+}
+
+// MarkerStream returns the stream named after the instance that holds an event containing
+// marker. The error lists the streams the marker arrived in otherwise, so a naming change of the
+// agent shows up as such rather than as missing logs.
+func MarkerStream(events []cloudwatchlogstypes.FilteredLogEvent, instanceID, marker string) (string, error) {
+	var others []string
+	for _, event := range events {
+		if !strings.Contains(aws.ToString(event.Message), marker) {
+			continue
+		}
+		stream := aws.ToString(event.LogStreamName)
+		if IsInstanceLogStream(stream, instanceID) {
+			return stream, nil
+		}
+		if !slices.Contains(others, stream) {
+			others = append(others, stream)
+		}
+	}
+	if len(others) > 0 {
+		return "", fmt.Errorf("marker %s arrived in %s, not in a stream named after %s", marker, strings.Join(others, ", "), instanceID)
+	}
+	return "", fmt.Errorf("marker %s has not arrived", marker)
+}
+
+// =============================================================================
+// INSTANCE LOG SOURCES
+// =============================================================================
+
+// GetInstanceUserData returns the decoded user data an instance was launched with.
+func GetInstanceUserData(t *testing.T, instanceID string) string {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := ec2.NewFromConfig(cfg)
+
+	result, err := client.DescribeInstanceAttribute(ctx, &ec2.DescribeInstanceAttributeInput{
+		InstanceId: aws.String(instanceID),
+		Attribute:  ec2types.InstanceAttributeNameUserData,
+	})
+	require.NoError(t, err, "Failed to describe user data of %s", instanceID)
+	require.NotNil(t, result.UserData, "Instance %s has no user data", instanceID)
+
+	userData, err := base64.StdEncoding.DecodeString(aws.ToString(result.UserData.Value))
+	require.NoError(t, err, "Instance %s user data is not base64", instanceID)
+	return string(userData)
+}
+
+// getInstanceState returns the EC2 state name of an instance, e.g. running or shutting-down.
+func getInstanceState(t *testing.T, instanceID string) string {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := ec2.NewFromConfig(cfg)
+
+	result, err := client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{InstanceIds: []string{instanceID}})
+	require.NoError(t, err, "Failed to describe instance %s", instanceID)
+	for _, reservation := range result.Reservations {
+		for _, instance := range reservation.Instances {
+			if instance.State != nil {
+				return string(instance.State.Name)
+			}
+		}
+	}
+	return "unknown"
+}
+
+// describeLogGroup returns the log group with exactly this name.
+func describeLogGroup(t *testing.T, client *cloudwatchlogs.Client, name string) (cloudwatchlogstypes.LogGroup, bool) {
+	output, err := client.DescribeLogGroups(context.Background(), &cloudwatchlogs.DescribeLogGroupsInput{
+		LogGroupNamePrefix: aws.String(name),
+	})
+	require.NoError(t, err, "Failed to describe log group %s", name)
+	for _, group := range output.LogGroups {
+		if aws.ToString(group.LogGroupName) == name {
+			return group, true
+		}
+	}
+	return cloudwatchlogstypes.LogGroup{}, false
+}
+
+// WaitForLogMarker polls the log group with FilterLogEvents, backing off from 2s to 30s, until
+// marker shows up in a stream named after the instance. Returns that stream, or the reason it
+// was not found when timeout passes.
+func WaitForLogMarker(t *testing.T, logGroupName, instanceID, marker string, since time.Time, timeout time.Duration) (string, error) {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := cloudwatchlogs.NewFromConfig(cfg)
+
+	backoff := 2 * time.Second
+	deadline := time.Now().Add(timeout)
+	for {
+		// The whole group is searched, so a marker in a misnamed stream is reported as such
+		var events []cloudwatchlogstypes.FilteredLogEvent
+		paginator := cloudwatchlogs.NewFilterLogEventsPaginator(client, &cloudwatchlogs.FilterLogEventsInput{
+			LogGroupName:  aws.String(logGroupName),
+			FilterPattern: aws.String(`"` + marker + `"`),
+			StartTime:     aws.Int64(since.Add(-time.Minute).UnixMilli()), // clock skew
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			require.NoError(t, err, "Failed to filter log events of %s", logGroupName)
+			events = append(events, page.Events...)
+		}
+
+		stream, err := MarkerStream(events, instanceID, marker)
+		if err == nil || time.Now().After(deadline) {
+			return stream, err
+		}
+		sleepUntilRetry(backoff, deadline)
+		backoff = min(2*backoff, 30*time.Second)
+	}
+}
+
+// =============================================================================
+// VALIDATORS
+// =============================================================================
+
+// ValidateEC2CloudWatchLogs verifies that an EC2 instance delivers its logs to CloudWatch: a unique
+// marker written to syslog must arrive in a stream named after the instance, in the log group its
+// user data sets as RUNS_ON_LOG_GROUP_NAME, which keeps logs for the configured retention.
+//
+// A stock AL2023 AMI has journald only, with no rsyslog and no CloudWatch agent. The journal is
+// shipped by the RunsOn agent that user-data-linux.sh starts through runs-on-bootstrap, so the marker
+// only arrives while that agent runs: call this as soon as the instance is SSM-ready. The instance
+// state is reported with a missing marker, to tell an agent that does not ship from an instance that
+// is gone.
+func ValidateEC2CloudWatchLogs(t *testing.T, instanceID, logGroupName string) {
+	validateCloudWatchLogsFromInstance(t, OSLinux, instanceID, logGroupName)
+}
+
+// ValidateWindowsEC2CloudWatchLogs runs the ValidateEC2CloudWatchLogs check on a Windows instance,
+// writing the marker to the Application event log.
+func ValidateWindowsEC2CloudWatchLogs(t *testing.T, instanceID, logGroupName string) {
+	validateCloudWatchLogsFromInstance(t, OSWindows, instanceID, logGroupName)
+}
+
+// validateCloudWatchLogsFromInstance writes a marker with the instance's OS tooling and waits for
+// it in the log group.
+func validateCloudWatchLogsFromInstance(t *testing.T, instanceOS InstanceOS, instanceID, logGroupName string) {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := cloudwatchlogs.NewFromConfig(cfg)
+
+	// The agent ships to the group named in user data, which must be the stack's group
+	userDataGroup, err := UserDataLogGroupName(GetInstanceUserData(t, instanceID))
+	require.NoError(t, err, "Instance %s", instanceID)
+	require.Equal(t, logGroupName, userDataGroup, "Instance %s user data RUNS_ON_LOG_GROUP_NAME", instanceID)
+
+	group, ok := describeLogGroup(t, client, logGroupName)
+	require.True(t, ok, "Log group %s not found", logGroupName)
+	require.NotNil(t, group.RetentionInDays, "Log group %s should have a retention policy", logGroupName)
+	assert.Equal(t, int32(testLogRetentionDays), *group.RetentionInDays, "Log group %s retention (log_retention_days)", logGroupName)
+	t.Logf("✓ Log group %s from user data keeps logs %d day(s)", logGroupName, *group.RetentionInDays)
+
+	marker := NewLogMarker(instanceID)
+	sentAt := time.Now()
+	stdout, stderr, err := instanceOS.RunCommand(t, instanceID, []string{instanceOS.logCommand("terratest", marker)})
+	require.NoError(t, err, "Failed to write log marker on %s. stdout: %s stderr: %s", instanceID, stdout, stderr)
+
+	stream, err := WaitForLogMarker(t, logGroupName, instanceID, marker, sentAt, 3*time.Minute)
+	if err != nil {
+		require.FailNowf(t, "Log marker not found", "Log group %s (instance %s is %s): %v",
+			logGroupName, instanceID, getInstanceState(t, instanceID), err)
+	}
+	t.Logf("✓ Marker from %s arrived in %s:%s after %s", instanceID, logGroupName, stream, time.Since(sentAt).Round(time.Second))
+}
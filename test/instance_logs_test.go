@@ -0,0 +1,79 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cloudwatchlogstypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testInstanceID = "i-0123456789abcdef0"
+
+func TestUserDataLogGroupName(t *testing.T) {
+	// Both templates of modules/compute, with the log group filled in like templatefile does
+	for _, name := range []string{"user-data-linux.sh", "user-data-windows.ps1"} {
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("..", "modules", "compute", name))
+			require.NoError(t, err)
+			userData := strings.ReplaceAll(string(data), "${log_group}", "test-logs1/ec2/instances")
+
+			group, err := UserDataLogGroupName(userData)
+			require.NoError(t, err)
+			assert.Equal(t, "test-logs1/ec2/instances", group)
+		})
+	}
+
+	_, err := UserDataLogGroupName("#!/bin/bash\nexport RUNS_ON_DEBUG=\"false\"\n")
+	assert.ErrorContains(t, err, "does not set RUNS_ON_LOG_GROUP_NAME")
+	_, err = UserDataLogGroupName("export RUNS_ON_LOG_GROUP_NAME=\"a\"\nexport RUNS_ON_LOG_GROUP_NAME=\"b\"\n")
+	assert.ErrorContains(t, err, "sets RUNS_ON_LOG_GROUP_NAME 2 times")
+}
+
+func TestNewLogMarker(t *testing.T) {
+	marker := NewLogMarker(testInstanceID)
+	assert.Regexp(t, regexp.MustCompile(`^terratest-log-i-0123456789abcdef0-\d+$`), marker)
+	assert.NotEqual(t, marker, NewLogMarker(testInstanceID))
+
+	// Nothing for logger, eventcreate or the filter pattern to interpret
+	assert.Equal(t, "logger -t terratest '"+marker+"'", OSLinux.logCommand("terratest", marker))
+	assert.Contains(t, OSWindows.logCommand("terratest", marker), "/D '"+marker+"'")
+}
+
+func TestIsInstanceLogStream(t *testing.T) {
+	assert.True(t, IsInstanceLogStream(testInstanceID, testInstanceID))
+	assert.True(t, IsInstanceLogStream(testInstanceID+"/syslog", testInstanceID))
+	assert.False(t, IsInstanceLogStream(testInstanceID+"1", testInstanceID))
+	assert.False(t, IsInstanceLogStream("runner/"+testInstanceID, testInstanceID))
+	assert.False(t, IsInstanceLogStream("i-0fedcba9876543210", testInstanceID))
+}
+
+func TestMarkerStream(t *testing.T) {
+	marker := "terratest-log-i-0123456789abcdef0-1735787045000000000"
+	event := func(stream, message string) cloudwatchlogstypes.FilteredLogEvent {
+		return cloudwatchlogstypes.FilteredLogEvent{LogStreamName: aws.String(stream), Message: aws.String(message)}
+	}
+	syslogLine := "Jan  2 03:04:05 ip-10-0-1-23 terratest: " + marker
+
+	stream, err := MarkerStream([]cloudwatchlogstypes.FilteredLogEvent{
+		event("i-0fedcba9876543210/syslog", "Jan  2 03:04:05 ip-10-0-1-24 terratest: other"),
+		event(testInstanceID+"/syslog", syslogLine),
+	}, testInstanceID, marker)
+	require.NoError(t, err)
+	assert.Equal(t, testInstanceID+"/syslog", stream)
+
+	// Arrived, but not in a stream named after the instance
+	_, err = MarkerStream([]cloudwatchlogstypes.FilteredLogEvent{
+		event("ip-10-0-1-23", syslogLine),
+		event("ip-10-0-1-23", syslogLine),
+	}, testInstanceID, marker)
+	assert.EqualError(t, err, "marker "+marker+" arrived in ip-10-0-1-23, not in a stream named after "+testInstanceID)
+
+	_, err = MarkerStream(nil, testInstanceID, marker)
+	assert.EqualError(t, err, "marker "+marker+" has not arrived")
+}
@@ -0,0 +1,695 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// =============================================================================
+// STACK RESOURCES
+// =============================================================================
+
+// StackResource is a managed resource of a deployed or planned stack.
+type StackResource struct {
+	Address string
+	Type    string
+	Values  map[string]interface{}
+}
+
+// StackResources reads the managed resources from `tofu show -json` output, either of the state
+// (values) or of a plan file (planned_values), sorted by address.
+func StackResources(showJSON []byte) ([]StackResource, error) {
+	var show struct {
+		Values *struct {
+			RootModule plannedModule `json:"root_module"`
+		} `json:"values"`
+		PlannedValues *struct {
+			RootModule plannedModule `json:"root_module"`
+		} `json:"planned_values"`
+	}
+	if err := json.Unmarshal(showJSON, &show); err != nil {
+		return nil, fmt.Errorf("failed to parse show JSON: %w", err)
+	}
+
+	var root plannedModule
+	switch {
+	case show.Values != nil:
+		root = show.Values.RootModule
+	case show.PlannedValues != nil:
+		root = show.PlannedValues.RootModule
+	default:
+		return nil, fmt.Errorf("show JSON has neither values nor planned_values")
+	}
+
+	var resources []StackResource
+	var walk func(module plannedModule)
+	walk = func(module plannedModule) {
+		for _, resource := range module.Resources {
+			if resource.Mode != "managed" {
+				continue
+			}
+			resources = append(resources, StackResource{Address: resource.Address, Type: resource.Type, Values: resource.Values})
+		}
+		for _, child := range module.ChildModules {
+			walk(child)
+		}
+	}
+	walk(root)
+
+	sort.Slice(resources, func(i, j int) bool { return resources[i].Address < resources[j].Address })
+	return resources, nil
+}
+
+// stringValue returns a string attribute of the resource, or "" if it is unset or unknown.
+func (r StackResource) stringValue(attribute string) string {
+	value, _ := r.Values[attribute].(string)
+	return value
+}
+
+// =============================================================================
+// NAME COLLISIONS
+// =============================================================================
+
+// sharedNameAttributes are the name attributes of the resource types whose names must be unique in
+// an account and region (or, for security groups, in a VPC), so two stacks sharing an account
+// must not derive the same value.
+var sharedNameAttributes = map[string]string{
+	"aws_apprunner_auto_scaling_configuration_version": "auto_scaling_configuration_name",
+	"aws_apprunner_service":                            "service_name",
+	"aws_apprunner_vpc_connector":                      "vpc_connector_name",
+	"aws_cloudwatch_dashboard":                         "dashboard_name",
+	"aws_cloudwatch_event_rule":                        "name",
+	"aws_cloudwatch_log_group":                         "name",
+	"aws_cloudwatch_metric_alarm":                      "alarm_name",
+	"aws_dynamodb_table":                               "name",
+	"aws_ecr_repository":                               "name",
+	"aws_efs_file_system":                              "creation_token",
+	"aws_iam_instance_profile":                         "name",
+	"aws_iam_role":                                     "name",
+	"aws_lambda_function":                              "function_name",
+	"aws_launch_template":                              "name",
+	"aws_resourcegroups_group":                         "name",
+	"aws_s3_bucket":                                    "bucket",
+	"aws_scheduler_schedule":                           "name",
+	"aws_security_group":                               "name",
+	"aws_sns_topic":                                    "name",
+	"aws_sqs_queue":                                    "name",
+	"aws_ssm_parameter":                                "name",
+}
+
+// SharedName is a name of a stack resource that must be unique across stacks.
+type SharedName struct {
+	Type    string
+	Name    string
+	Address string
+}
+
+// SharedNames returns the names of the resources covered by sharedNameAttributes, sorted by type
+// and name. Resources whose name is not known (e.g. in a plan) are skipped.
+func SharedNames(resources []StackResource) []SharedName {
+	var names []SharedName
+	for _, resource := range resources {
+		attribute, found := sharedNameAttributes[resource.Type]
+		if !found {
+			continue
+		}
+		if name := resource.stringValue(attribute); name != "" {
+			names = append(names, SharedName{Type: resource.Type, Name: name, Address: resource.Address})
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if names[i].Type != names[j].Type {
+			return names[i].Type < names[j].Type
+		}
+		return names[i].Name < names[j].Name
+	})
+	return names
+}
+
+// NameCollision is a name used by a resource of both stacks.
+type NameCollision struct {
+	Type     string
+	Name     string
+	AddressA string
+	AddressB string
+}
+
+func (c NameCollision) String() string {
+	return fmt.Sprintf("%s %q (%s and %s)", c.Type, c.Name, c.AddressA, c.AddressB)
+}
+
+// NameCollisions returns the shared names that stacks a and b both use for the same resource type.
+func NameCollisions(a, b []StackResource) []NameCollision {
+	namesB := map[string]SharedName{}
+	for _, name := range SharedNames(b) {
+		namesB[name.Type+"\x00"+name.Name] = name
+	}
+
+	var collisions []NameCollision
+	for _, name := range SharedNames(a) {
+		if other, found := namesB[name.Type+"\x00"+name.Name]; found {
+			collisions = append(collisions, NameCollision{Type: name.Type, Name: name.Name, AddressA: name.Address, AddressB: other.Address})
+		}
+	}
+	return collisions
+}
+
+// =============================================================================
+// IAM POLICY EVALUATION
+// =============================================================================
+
+// Decisions of EvaluateAccess, following the IAM evaluation logic for identity-based policies.
+const (
+	AccessAllowed      = "allowed"
+	AccessImplicitDeny = "implicit deny"
+	AccessExplicitDeny = "explicit deny"
+)
+
+// PolicyDocument is an IAM policy document.
+type PolicyDocument struct {
+	Version   string            `json:"Version"`
+	Statement []PolicyStatement `json:"Statement"`
+}
+
+// PolicyStatement is a statement of an IAM policy document.
+type PolicyStatement struct {
+	Sid         string                             `json:"Sid,omitempty"`
+	Effect      string                             `json:"Effect"`
+	Action      policyValues                       `json:"Action,omitempty"`
+	NotAction   policyValues                       `json:"NotAction,omitempty"`
+	Resource    policyValues                       `json:"Resource,omitempty"`
+	NotResource policyValues                       `json:"NotResource,omitempty"`
+	Condition   map[string]map[string]policyValues `json:"Condition,omitempty"`
+}
+
+// policyValues is a policy element that is either a single string or a list of strings.
+type policyValues []string
+
+func (v *policyValues) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*v = policyValues{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("policy element must be a string or a list of strings: %w", err)
+	}
+	*v = list
+	return nil
+}
+
+// ParsePolicyDocument parses an IAM policy document, e.g. the policy attribute of aws_iam_role_policy.
+// Statement may be a single statement or a list of statements.
+func ParsePolicyDocument(document string) (PolicyDocument, error) {
+	var raw struct {
+		Version   string          `json:"Version"`
+		Statement json.RawMessage `json:"Statement"`
+	}
+	if err := json.Unmarshal([]byte(document), &raw); err != nil {
+		return PolicyDocument{}, fmt.Errorf("failed to parse policy document: %w", err)
+	}
+
+	policy := PolicyDocument{Version: raw.Version}
+	if err := json.Unmarshal(raw.Statement, &policy.Statement); err != nil {
+		var statement PolicyStatement
+		if err := json.Unmarshal(raw.Statement, &statement); err != nil {
+			return policy, fmt.Errorf("failed to parse policy statements: %w", err)
+		}
+		policy.Statement = []PolicyStatement{statement}
+	}
+	return policy, nil
+}
+
+// AccessRequest is an API request to evaluate against policies. Context holds the condition keys
+// of the request, e.g. aws:userid or aws:ResourceTag/runs-on-stack-name.
+type AccessRequest struct {
+	Action   string
+	Resource string
+	Context  map[string]string
+}
+
+// EvaluateAccess decides whether identity-based policies allow a request: an explicit deny wins,
+// otherwise any matching allow grants access. Condition operators that are not modeled are assumed
+// to hold for Allow statements and not to hold for Deny statements, so the result errs on the side
+// of reporting access.
+func EvaluateAccess(policies []PolicyDocument, request AccessRequest) string {
+	decision := AccessImplicitDeny
+	for _, policy := range policies {
+		for _, statement := range policy.Statement {
+			if !statement.matches(request) {
+				continue
+			}
+			if strings.EqualFold(statement.Effect, "Deny") {
+				return AccessExplicitDeny
+			}
+			decision = AccessAllowed
+		}
+	}
+	return decision
+}
+
+// matches reports whether the statement applies to the request.
+func (s PolicyStatement) matches(request AccessRequest) bool {
+	allow := !strings.EqualFold(s.Effect, "Deny")
+
+	actionMatches := func(patterns policyValues) bool {
+		for _, pattern := range patterns {
+			if wildcardMatch(strings.ToLower(pattern), strings.ToLower(request.Action)) {
+				return true
+			}
+		}
+		return false
+	}
+	resourceMatches := func(patterns policyValues) bool {
+		for _, pattern := range patterns {
+			if wildcardMatch(substitutePolicyVariables(pattern, request.Context, allow), request.Resource) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch {
+	case len(s.Action) > 0 && !actionMatches(s.Action):
+		return false
+	case len(s.NotAction) > 0 && actionMatches(s.NotAction):
+		return false
+	case len(s.Resource) > 0 && !resourceMatches(s.Resource):
+		return false
+	case len(s.NotResource) > 0 && resourceMatches(s.NotResource):
+		return false
+	}
+
+	for operator, conditions := range s.Condition {
+		for key, values := range conditions {
+			if !evaluateCondition(operator, key, values, request.Context, allow) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+var policyVariablePattern = regexp.MustCompile(`\$\{([^}]+)\}`)
+
+// substitutePolicyVariables replaces ${key} policy variables with their value from the request
+// context. Variables missing from the context match anything in Allow statements and nothing in
+// Deny statements.
+func substitutePolicyVariables(pattern string, context map[string]string, allow bool) string {
+	return policyVariablePattern.ReplaceAllStringFunc(pattern, func(variable string) string {
+		key := policyVariablePattern.FindStringSubmatch(variable)[1]
+		if value, found := context[key]; found {
+			return value
+		}
+		if allow {
+			return "*"
+		}
+		return "\x00"
+	})
+}
+
+// evaluateCondition evaluates one condition key of a statement.
+func evaluateCondition(operator, key string, values policyValues, context map[string]string, allow bool) bool {
+	value, present := lookupConditionKey(context, key)
+
+	ifExists := strings.HasSuffix(operator, "IfExists")
+	operator = strings.TrimSuffix(operator, "IfExists")
+	if ifExists && !present && operator != "Null" {
+		return true
+	}
+
+	anyValue := func(match func(expected string) bool) bool {
+		for _, expected := range values {
+			if match(expected) {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch operator {
+	case "StringEquals", "ArnEquals":
+		return present && anyValue(func(expected string) bool { return value == expected })
+	case "StringNotEquals", "ArnNotEquals":
+		return !present || !anyValue(func(expected string) bool { return value == expected })
+	case "StringEqualsIgnoreCase":
+		return present && anyValue(func(expected string) bool { return strings.EqualFold(value, expected) })
+	case "StringLike", "ArnLike":
+		return present && anyValue(func(expected string) bool { return wildcardMatch(expected, value) })
+	case "StringNotLike", "ArnNotLike":
+		return !present || !anyValue(func(expected string) bool { return wildcardMatch(expected, value) })
+	case "Bool":
+		return present && anyValue(func(expected string) bool { return strings.EqualFold(value, expected) })
+	case "Null":
+		return anyValue(func(expected string) bool { return strings.EqualFold(expected, "true") != present })
+	default:
+		return allow
+	}
+}
+
+// lookupConditionKey returns a condition key from the request context. Condition key names are
+// case-insensitive, tag keys are not.
+func lookupConditionKey(context map[string]string, key string) (string, bool) {
+	if value, found := context[key]; found {
+		return value, true
+	}
+	name, tag, hasTag := strings.Cut(key, "/")
+	for candidate, value := range context {
+		candidateName, candidateTag, candidateHasTag := strings.Cut(candidate, "/")
+		if strings.EqualFold(name, candidateName) && hasTag == candidateHasTag && tag == candidateTag {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// wildcardMatch matches value against an IAM pattern, where * matches any sequence of characters
+// and ? matches any single character.
+func wildcardMatch(pattern, value string) bool {
+	var expression strings.Builder
+	expression.WriteString("^")
+	for _, r := range pattern {
+		switch r {
+		case '*':
+			expression.WriteString(".*")
+		case '?':
+			expression.WriteString(".")
+		default:
+			expression.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	expression.WriteString("$")
+	return regexp.MustCompile(expression.String()).MatchString(value)
+}
+
+// managedPoliciesDir holds the documents of the AWS managed policies the module attaches, named
+// after the policy (e.g. AmazonSSMManagedInstanceCore.json).
+const managedPoliciesDir = "testdata/iam"
+
+// LoadManagedPolicies reads the AWS managed policy documents in dir, keyed by policy ARN.
+func LoadManagedPolicies(dir string) (map[string]PolicyDocument, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	policies := map[string]PolicyDocument{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		policy, err := ParsePolicyDocument(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		policies["arn:aws:iam::aws:policy/"+name] = policy
+	}
+	return policies, nil
+}
+
+// RolePolicies returns the inline and attached policies of a role of the stack. Attached policies
+// are looked up in managed; an attachment without a known document is an error, since leaving it
+// out could hide access.
+func RolePolicies(resources []StackResource, roleName string, managed map[string]PolicyDocument) ([]PolicyDocument, error) {
+	var policies []PolicyDocument
+	for _, resource := range resources {
+		if resource.stringValue("role") != roleName {
+			continue
+		}
+		switch resource.Type {
+		case "aws_iam_role_policy":
+			policy, err := ParsePolicyDocument(resource.stringValue("policy"))
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", resource.Address, err)
+			}
+			policies = append(policies, policy)
+		case "aws_iam_role_policy_attachment":
+			arn := resource.stringValue("policy_arn")
+			policy, found := managed[arn]
+			if !found {
+				return nil, fmt.Errorf("%s: no document for attached policy %s", resource.Address, arn)
+			}
+			policies = append(policies, policy)
+		}
+	}
+	if len(policies) == 0 {
+		return nil, fmt.Errorf("no policies found for role %s", roleName)
+	}
+	return policies, nil
+}
+
+// =============================================================================
+// STACK ISOLATION
+// =============================================================================
+
+// isolationProbeKey is the object key the isolation probes read under agents/ and cache/.
+const isolationProbeKey = "isolation-probe"
+
+// denyOtherStackParametersAddress is the compute module's policy denying runners the SSM parameters
+// of other stacks, which AmazonSSMManagedInstanceCore otherwise allows.
+const denyOtherStackParametersAddress = "module.compute.aws_iam_role_policy.ec2_deny_other_stack_parameters"
+
+// StackIdentity identifies the resources of a stack that its runners need and other stacks' runners
+// must not reach.
+type StackIdentity struct {
+	StackName        string
+	Region           string
+	AccountID        string
+	RoleName         string
+	ConfigBucket     string
+	CacheBucket      string
+	SecretParameters []string // Names of the /<stack>/secrets/* parameters
+}
+
+// StackSecretParameters returns the names of the stack's SSM parameters under /<stack>/secrets/.
+func StackSecretParameters(resources []StackResource, stackName string) []string {
+	var names []string
+	for _, resource := range resources {
+		name := resource.stringValue("name")
+		if resource.Type == "aws_ssm_parameter" && strings.HasPrefix(name, "/"+stackName+"/secrets/") {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsolationProbe is a read of a stack resource by the runners of a stack.
+type IsolationProbe struct {
+	Name    string
+	Request AccessRequest
+}
+
+// IsolationProbes returns the reads of target's config bucket agents/, cache bucket and secrets
+// that the runners of their own stack need, as made by a runner with the given aws:userid.
+func IsolationProbes(target StackIdentity, userID string) []IsolationProbe {
+	partition := awsPartition(target.Region)
+	objectARN := func(bucket, key string) string {
+		return fmt.Sprintf("arn:%s:s3:::%s/%s", partition, bucket, key)
+	}
+	context := map[string]string{"aws:userid": userID}
+
+	probes := []IsolationProbe{
+		{Name: "config/agents/GetObject", Request: AccessRequest{Action: "s3:GetObject",
+			Resource: objectARN(target.ConfigBucket, "agents/"+isolationProbeKey), Context: context}},
+		{Name: "cache/cache/GetObject", Request: AccessRequest{Action: "s3:GetObject",
+			Resource: objectARN(target.CacheBucket, "cache/"+isolationProbeKey), Context: context}},
+		{Name: "cache/cache/PutObject", Request: AccessRequest{Action: "s3:PutObject",
+			Resource: objectARN(target.CacheBucket, "cache/"+isolationProbeKey), Context: context}},
+		{Name: "cache/runners/GetObject", Request: AccessRequest{Action: "s3:GetObject",
+			Resource: objectARN(target.CacheBucket, "runners/"+userID+"/"+isolationProbeKey), Context: context}},
+		{Name: "cache/ListBucket", Request: AccessRequest{Action: "s3:ListBucket",
+			Resource: fmt.Sprintf("arn:%s:s3:::%s", partition, target.CacheBucket), Context: context}},
+	}
+	for _, parameter := range target.SecretParameters {
+		resource := fmt.Sprintf("arn:%s:ssm:%s:%s:parameter%s", partition, target.Region, target.AccountID, parameter)
+		parameterContext := map[string]string{
+			"aws:userid":                         userID,
+			"aws:ResourceTag/runs-on-stack-name": target.StackName,
+		}
+		for _, action := range []string{"ssm:GetParameter", "ssm:GetParameters"} {
+			probes = append(probes, IsolationProbe{
+				Name:    fmt.Sprintf("ssm%s/%s", parameter, strings.TrimPrefix(action, "ssm:")),
+				Request: AccessRequest{Action: action, Resource: resource, Context: parameterContext},
+			})
+		}
+	}
+	return probes
+}
+
+// GetStackIdentity reads the identity of a deployed stack from its outputs and state.
+func GetStackIdentity(t *testing.T, options *terraform.Options) (StackIdentity, []StackResource) {
+	showOptions := *options
+	showOptions.PlanFilePath = ""
+	resources, err := StackResources([]byte(terraform.Show(t, &showOptions)))
+	require.NoError(t, err, "Failed to read state of %s", options.TerraformDir)
+
+	stackName := terraform.Output(t, options, "stack_name")
+	identity := StackIdentity{
+		StackName:        stackName,
+		Region:           terraform.Output(t, options, "aws_region"),
+		AccountID:        terraform.Output(t, options, "aws_account_id"),
+		RoleName:         terraform.Output(t, options, "ec2_instance_role_name"),
+		ConfigBucket:     terraform.Output(t, options, "config_bucket_name"),
+		CacheBucket:      terraform.Output(t, options, "cache_bucket_name"),
+		SecretParameters: StackSecretParameters(resources, stackName),
+	}
+	return identity, resources
+}
+
+// ValidateStackIsolationPolicies evaluates the EC2 instance role policies of stack own offline: its
+// runners must be allowed to read their own stack's config, cache and secrets, and denied the
+// same reads of stack other.
+func ValidateStackIsolationPolicies(t *testing.T, policies []PolicyDocument, own, other StackIdentity) {
+	// aws:userid of an instance role session is <role id>:<instance id>
+	userID := "AROAEXAMPLEROLEID:i-0123456789abcdef0"
+
+	for _, probe := range IsolationProbes(own, userID) {
+		decision := EvaluateAccess(policies, probe.Request)
+		assert.Equal(t, AccessAllowed, decision, "%s runners should be able to %s %s",
+			own.StackName, probe.Request.Action, probe.Request.Resource)
+	}
+	t.Logf("✓ %s runners can read their own config, cache and secrets", own.StackName)
+
+	for _, probe := range IsolationProbes(other, userID) {
+		decision := EvaluateAccess(policies, probe.Request)
+		assert.NotEqual(t, AccessAllowed, decision, "%s runners should NOT be able to %s %s",
+			own.StackName, probe.Request.Action, probe.Request.Resource)
+		if decision != AccessAllowed {
+			t.Logf("✓ %s: %s (%s)", probe.Name, decision, probe.Request.Resource)
+		}
+	}
+}
+
+// DenyOtherStackParametersPolicy returns the DenyOtherStackParameters policy of the stack's role.
+func DenyOtherStackParametersPolicy(resources []StackResource, roleName string) (PolicyDocument, error) {
+	for _, resource := range resources {
+		if resource.Address == denyOtherStackParametersAddress && resource.stringValue("role") == roleName {
+			return ParsePolicyDocument(resource.stringValue("policy"))
+		}
+	}
+	return PolicyDocument{}, fmt.Errorf("no %s on role %s", denyOtherStackParametersAddress, roleName)
+}
+
+// ValidateDenyOtherStackParameters verifies that the EC2 instance role of stack own has the
+// DenyOtherStackParameters policy, and that this policy alone explicitly denies reading the secrets
+// of stack other without denying own's.
+func ValidateDenyOtherStackParameters(t *testing.T, resources []StackResource, own, other StackIdentity) {
+	policy, err := DenyOtherStackParametersPolicy(resources, own.RoleName)
+	require.NoError(t, err, "Stack %s should deny its runners other stacks' SSM parameters", own.StackName)
+	policies := []PolicyDocument{policy}
+	userID := "AROAEXAMPLEROLEID:i-0123456789abcdef0"
+
+	for _, probe := range IsolationProbes(other, userID) {
+		if strings.HasPrefix(probe.Request.Action, "ssm:") {
+			assert.Equal(t, AccessExplicitDeny, EvaluateAccess(policies, probe.Request), "%s DenyOtherStackParameters should deny %s %s",
+				own.StackName, probe.Request.Action, probe.Request.Resource)
+		}
+	}
+	for _, probe := range IsolationProbes(own, userID) {
+		if strings.HasPrefix(probe.Request.Action, "ssm:") {
+			assert.NotEqual(t, AccessExplicitDeny, EvaluateAccess(policies, probe.Request), "%s DenyOtherStackParameters should not deny %s %s",
+				own.StackName, probe.Request.Action, probe.Request.Resource)
+		}
+	}
+	t.Logf("✓ %s role has DenyOtherStackParameters, denying the secrets of %s", own.StackName, other.StackName)
+}
+
+// ValidateStackIsolationFromEC2 checks stack isolation live from an instance of stack own: it uploads
+// probe objects to the agents/ and cache/ prefixes of both stacks, then reads them and the secrets
+// of both stacks with the instance role. Reads of own resources must succeed, reads of other's must
+// be denied. Secret values are never printed.
+func ValidateStackIsolationFromEC2(t *testing.T, instanceID string, own, other StackIdentity) {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	s3Client := s3.NewFromConfig(cfg)
+
+	content := fmt.Sprintf("isolation-probe-%d", time.Now().UnixNano())
+	type probeObject struct{ bucket, key string }
+	objects := []probeObject{
+		{own.ConfigBucket, "agents/" + isolationProbeKey},
+		{other.ConfigBucket, "agents/" + isolationProbeKey},
+		{other.CacheBucket, "cache/" + isolationProbeKey},
+	}
+	for _, object := range objects {
+		_, err := s3Client.PutObject(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(object.bucket),
+			Key:    aws.String(object.key),
+			Body:   strings.NewReader(content),
+		})
+		require.NoError(t, err, "Admin failed to upload s3://%s/%s", object.bucket, object.key)
+	}
+	defer func() {
+		for _, object := range objects {
+			_, _ = s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(object.bucket), Key: aws.String(object.key)})
+		}
+	}()
+
+	region := GetAWSRegion()
+	getParameter := func(name string) string {
+		return fmt.Sprintf("aws ssm get-parameter --name %s --with-decryption --query Parameter.Name --output text --region %s 2>&1", name, region)
+	}
+
+	// Own reads prove the instance can reach S3 and SSM at all, so denials below are meaningful
+	steps := []SSMStep{
+		{Name: "own-agents", Command: OSLinux.s3ReadCommand(own.ConfigBucket, "agents/"+isolationProbeKey, region)},
+		{Name: "other-agents", Command: OSLinux.s3ReadCommand(other.ConfigBucket, "agents/"+isolationProbeKey, region)},
+		{Name: "other-cache-read", Command: OSLinux.s3ReadCommand(other.CacheBucket, "cache/"+isolationProbeKey, region)},
+		{Name: "other-cache-write", Command: OSLinux.s3WriteCommand(other.CacheBucket, "cache/"+isolationProbeKey+"-write", content, region)},
+	}
+	for i, name := range own.SecretParameters {
+		steps = append(steps, SSMStep{Name: fmt.Sprintf("own-secret-%d", i), Command: getParameter(name)})
+	}
+	for i, name := range other.SecretParameters {
+		steps = append(steps, SSMStep{Name: fmt.Sprintf("other-secret-%d", i), Command: getParameter(name)})
+	}
+	for i := range steps {
+		steps[i].AlwaysRun = true
+		steps[i].IgnoreFailure = true
+	}
+
+	result, err := RunSSMScript(t, instanceID, steps, SSMOutput{})
+	require.NoError(t, err, "Failed to run isolation script")
+	_, _ = s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{Bucket: aws.String(other.CacheBucket), Key: aws.String("cache/" + isolationProbeKey + "-write")})
+
+	ownAgents := requireSSMStep(t, result, "own-agents", "Should be able to read own agents/*")
+	assert.Contains(t, ownAgents.Output, content, "Content mismatch reading own agents/*")
+	t.Logf("✓ %s CAN read s3://%s/agents/*", own.StackName, own.ConfigBucket)
+	for i, name := range own.SecretParameters {
+		step := requireSSMStep(t, result, fmt.Sprintf("own-secret-%d", i), "Should be able to read own secret "+name)
+		assert.Equal(t, name, strings.TrimSpace(step.Output))
+		t.Logf("✓ %s CAN read %s", own.StackName, name)
+	}
+
+	denied := func(stepName, description string) {
+		step := result.Step(stepName)
+		require.True(t, step.Finished, "Step %s did not finish", stepName)
+		assert.NotEqual(t, 0, step.ExitCode, "%s should fail, got: %s", description, step.Output)
+		assert.True(t, isAccessDenied(step.Output), "%s should be denied, got: %s", description, truncateString(step.Output, 500))
+		if step.ExitCode != 0 && isAccessDenied(step.Output) {
+			t.Logf("✓ %s CANNOT %s", own.StackName, description)
+		}
+	}
+	denied("other-agents", fmt.Sprintf("read s3://%s/agents/*", other.ConfigBucket))
+	denied("other-cache-read", fmt.Sprintf("read s3://%s/cache/*", other.CacheBucket))
+	denied("other-cache-write", fmt.Sprintf("write s3://%s/cache/*", other.CacheBucket))
+	for i, name := range other.SecretParameters {
+		denied(fmt.Sprintf("other-secret-%d", i), "read "+name)
+	}
+}
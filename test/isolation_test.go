@@ -0,0 +1,195 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loadStackState reads a recorded `tofu show -json` state of a stack from testdata/state and
+// returns its identity and resources.
+func loadStackState(t *testing.T, name string) (StackIdentity, []StackResource) {
+	data, err := os.ReadFile(filepath.Join("testdata", "state", name))
+	require.NoError(t, err)
+	resources, err := StackResources(data)
+	require.NoError(t, err)
+
+	identity := StackIdentity{Region: "us-east-1", AccountID: "123456789012"}
+	for _, resource := range resources {
+		switch resource.Address {
+		case "module.compute.aws_iam_role.ec2_instance":
+			identity.RoleName = resource.stringValue("name")
+			identity.StackName = resource.Values["tags"].(map[string]interface{})["runs-on-stack-name"].(string)
+		case "module.storage.aws_s3_bucket.config":
+			identity.ConfigBucket = resource.stringValue("bucket")
+		case "module.storage.aws_s3_bucket.cache":
+			identity.CacheBucket = resource.stringValue("bucket")
+		}
+	}
+	identity.SecretParameters = StackSecretParameters(resources, identity.StackName)
+	return identity, resources
+}
+
+func TestStackResources(t *testing.T) {
+	identity, resources := loadStackState(t, "stack-prod.json")
+	assert.Equal(t, "test-prod", identity.StackName)
+	assert.Equal(t, "test-prod-ec2-instance-role", identity.RoleName)
+	assert.Equal(t, []string{"/test-prod/secrets/license-key"}, identity.SecretParameters)
+
+	for _, resource := range resources {
+		assert.NotContains(t, resource.Address, ".data.", "Data sources are skipped")
+	}
+
+	// Plans are read from planned_values
+	plan, err := os.ReadFile(filepath.Join("testdata", "plan", "naming.json"))
+	require.NoError(t, err)
+	planned, err := StackResources(plan)
+	require.NoError(t, err)
+	assert.NotEmpty(t, planned)
+
+	_, err = StackResources([]byte(`{"format_version": "1.0"}`))
+	assert.ErrorContains(t, err, "neither values nor planned_values")
+	_, err = StackResources([]byte(`not json`))
+	assert.Error(t, err)
+}
+
+func TestNameCollisions(t *testing.T) {
+	_, prod := loadStackState(t, "stack-prod.json")
+	_, staging := loadStackState(t, "stack-staging.json")
+
+	names := map[string]string{}
+	for _, name := range SharedNames(prod) {
+		names[name.Type] = name.Name
+	}
+	assert.Equal(t, "test-prod-ec2-instance-role", names["aws_iam_role"])
+	assert.Equal(t, "test-prod-ec2-instances", names["aws_resourcegroups_group"])
+	assert.Equal(t, "/test-prod/secrets/license-key", names["aws_ssm_parameter"])
+	assert.Equal(t, "test-prod-Dashboard", names["aws_cloudwatch_dashboard"])
+
+	assert.Empty(t, NameCollisions(prod, staging))
+
+	// A stack deployed twice with the same stack_name collides on every shared name
+	collisions := NameCollisions(prod, prod)
+	assert.Len(t, collisions, len(SharedNames(prod)))
+	assert.Contains(t, collisions, NameCollision{
+		Type:     "aws_resourcegroups_group",
+		Name:     "test-prod-ec2-instances",
+		AddressA: "module.compute.aws_resourcegroups_group.ec2_instances",
+		AddressB: "module.compute.aws_resourcegroups_group.ec2_instances",
+	})
+}
+
+func TestEvaluateAccess(t *testing.T) {
+	policy := func(document string) []PolicyDocument {
+		parsed, err := ParsePolicyDocument(document)
+		require.NoError(t, err)
+		return []PolicyDocument{parsed}
+	}
+
+	cases := []struct {
+		name     string
+		policies []PolicyDocument
+		request  AccessRequest
+		want     string
+	}{
+		{"NoPolicies", nil,
+			AccessRequest{Action: "s3:GetObject", Resource: "arn:aws:s3:::bucket/key"}, AccessImplicitDeny},
+		{"SingleValues", policy(`{"Statement": {"Effect": "Allow", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::bucket/*"}}`),
+			AccessRequest{Action: "s3:GetObject", Resource: "arn:aws:s3:::bucket/key"}, AccessAllowed},
+		{"ActionCaseInsensitive", policy(`{"Statement": [{"Effect": "Allow", "Action": ["S3:Get*"], "Resource": ["*"]}]}`),
+			AccessRequest{Action: "s3:GetObject", Resource: "arn:aws:s3:::bucket/key"}, AccessAllowed},
+		{"ResourceMismatch", policy(`{"Statement": [{"Effect": "Allow", "Action": ["s3:GetObject"], "Resource": ["arn:aws:s3:::bucket/cache/*"]}]}`),
+			AccessRequest{Action: "s3:GetObject", Resource: "arn:aws:s3:::bucket/runners/key"}, AccessImplicitDeny},
+		{"SingleCharacterWildcard", policy(`{"Statement": [{"Effect": "Allow", "Action": ["s3:GetObject"], "Resource": ["arn:aws:s3:::bucket-?/*"]}]}`),
+			AccessRequest{Action: "s3:GetObject", Resource: "arn:aws:s3:::bucket-ab/key"}, AccessImplicitDeny},
+		{"NotAction", policy(`{"Statement": [{"Effect": "Allow", "NotAction": ["s3:PutObject"], "Resource": ["*"]}]}`),
+			AccessRequest{Action: "s3:PutObject", Resource: "arn:aws:s3:::bucket/key"}, AccessImplicitDeny},
+		{"ExplicitDenyWins", policy(`{"Statement": [
+			{"Effect": "Allow", "Action": ["s3:*"], "Resource": ["*"]},
+			{"Effect": "Deny", "Action": ["s3:GetObject"], "NotResource": ["arn:aws:s3:::own/*"]}]}`),
+			AccessRequest{Action: "s3:GetObject", Resource: "arn:aws:s3:::other/key"}, AccessExplicitDeny},
+		{"PolicyVariable", policy(`{"Statement": [{"Effect": "Allow", "Action": ["s3:GetObject"], "Resource": ["arn:aws:s3:::bucket/runners/${aws:userid}/*"]}]}`),
+			AccessRequest{Action: "s3:GetObject", Resource: "arn:aws:s3:::bucket/runners/other/key", Context: map[string]string{"aws:userid": "own"}}, AccessImplicitDeny},
+		{"PolicyVariableUnknownInAllow", policy(`{"Statement": [{"Effect": "Allow", "Action": ["s3:GetObject"], "Resource": ["arn:aws:s3:::bucket/runners/${aws:userid}/*"]}]}`),
+			AccessRequest{Action: "s3:GetObject", Resource: "arn:aws:s3:::bucket/runners/other/key"}, AccessAllowed},
+		{"ConditionTagMismatch", policy(`{"Statement": [{"Effect": "Allow", "Action": ["ec2:DeleteVolume"], "Resource": ["*"],
+			"Condition": {"StringEquals": {"aws:ResourceTag/runs-on-stack-name": "own"}}}]}`),
+			AccessRequest{Action: "ec2:DeleteVolume", Resource: "*", Context: map[string]string{"aws:resourcetag/runs-on-stack-name": "other"}}, AccessImplicitDeny},
+		{"ConditionKeyMissing", policy(`{"Statement": [{"Effect": "Allow", "Action": ["ec2:DeleteVolume"], "Resource": ["*"],
+			"Condition": {"StringEquals": {"aws:ResourceTag/runs-on-stack-name": "own"}}}]}`),
+			AccessRequest{Action: "ec2:DeleteVolume", Resource: "*"}, AccessImplicitDeny},
+		{"ConditionIfExists", policy(`{"Statement": [{"Effect": "Allow", "Action": ["ec2:DeleteVolume"], "Resource": ["*"],
+			"Condition": {"StringEqualsIfExists": {"aws:ResourceTag/runs-on-stack-name": "own"}}}]}`),
+			AccessRequest{Action: "ec2:DeleteVolume", Resource: "*"}, AccessAllowed},
+		{"UnknownOperatorInAllow", policy(`{"Statement": [{"Effect": "Allow", "Action": ["s3:GetObject"], "Resource": ["*"],
+			"Condition": {"IpAddress": {"aws:SourceIp": "203.0.113.0/24"}}}]}`),
+			AccessRequest{Action: "s3:GetObject", Resource: "arn:aws:s3:::bucket/key"}, AccessAllowed},
+		{"UnknownOperatorInDeny", policy(`{"Statement": [
+			{"Effect": "Allow", "Action": ["s3:GetObject"], "Resource": ["*"]},
+			{"Effect": "Deny", "Action": ["s3:GetObject"], "Resource": ["*"], "Condition": {"IpAddress": {"aws:SourceIp": "203.0.113.0/24"}}}]}`),
+			AccessRequest{Action: "s3:GetObject", Resource: "arn:aws:s3:::bucket/key"}, AccessAllowed},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.want, EvaluateAccess(tc.policies, tc.request))
+		})
+	}
+}
+
+func TestRolePolicies(t *testing.T) {
+	identity, resources := loadStackState(t, "stack-prod.json")
+	managed, err := LoadManagedPolicies(managedPoliciesDir)
+	require.NoError(t, err)
+	require.Contains(t, managed, "arn:aws:iam::aws:policy/AmazonSSMManagedInstanceCore")
+
+	policies, err := RolePolicies(resources, identity.RoleName, managed)
+	require.NoError(t, err)
+	assert.Len(t, policies, 6, "4 inline policies and 2 managed policies")
+
+	_, err = RolePolicies(resources, identity.RoleName, nil)
+	assert.ErrorContains(t, err, "no document for attached policy")
+	_, err = RolePolicies(resources, "unknown-role", managed)
+	assert.ErrorContains(t, err, "no policies found")
+}
+
+func TestStackIsolationPolicies(t *testing.T) {
+	prod, prodResources := loadStackState(t, "stack-prod.json")
+	staging, stagingResources := loadStackState(t, "stack-staging.json")
+	managed, err := LoadManagedPolicies(managedPoliciesDir)
+	require.NoError(t, err)
+
+	prodPolicies, err := RolePolicies(prodResources, prod.RoleName, managed)
+	require.NoError(t, err)
+	stagingPolicies, err := RolePolicies(stagingResources, staging.RoleName, managed)
+	require.NoError(t, err)
+
+	ValidateStackIsolationPolicies(t, prodPolicies, prod, staging)
+	ValidateStackIsolationPolicies(t, stagingPolicies, staging, prod)
+
+	ValidateDenyOtherStackParameters(t, prodResources, prod, staging)
+	ValidateDenyOtherStackParameters(t, stagingResources, staging, prod)
+
+	// AmazonSSMManagedInstanceCore allows ssm:GetParameter on *, only the deny policy keeps secrets apart
+	var withoutDeny []StackResource
+	for _, resource := range prodResources {
+		if resource.Address != denyOtherStackParametersAddress {
+			withoutDeny = append(withoutDeny, resource)
+		}
+	}
+	_, err = DenyOtherStackParametersPolicy(withoutDeny, prod.RoleName)
+	assert.ErrorContains(t, err, "no "+denyOtherStackParametersAddress+" on role "+prod.RoleName)
+	policies, err := RolePolicies(withoutDeny, prod.RoleName, managed)
+	require.NoError(t, err)
+	for _, probe := range IsolationProbes(staging, "AROAEXAMPLEROLEID:i-0123456789abcdef0") {
+		want := AccessImplicitDeny
+		if strings.HasPrefix(probe.Name, "ssm/") {
+			want = AccessAllowed
+		}
+		assert.Equal(t, want, EvaluateAccess(policies, probe.Request), probe.Name)
+	}
+}
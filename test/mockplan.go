@@ -0,0 +1,65 @@
+package test
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/files"
+	"github.com/gruntwork-io/terratest/modules/logger"
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/require"
+)
+
+// =============================================================================
+// OFFLINE PLANS (MOCK PROVIDERS)
+// =============================================================================
+
+// mockPlanTestFile is the `tofu test` file planning the root module against mock providers.
+const mockPlanTestFile = "fixtures/mocks/plan.tftest.hcl"
+
+// MockPlanModule copies the root module to a temporary directory, adds the mock provider test file
+// and initializes it, so MockPlan can plan it without AWS credentials. Skips the test if tofu is
+// not installed.
+func MockPlanModule(t *testing.T) *terraform.Options {
+	if _, err := exec.LookPath("tofu"); err != nil {
+		t.Skip("Skipping offline plan: tofu not installed")
+	}
+
+	dir, err := files.CopyTerraformFolderToDest("..", t.TempDir(), "mockplan")
+	require.NoError(t, err, "Failed to copy the root module")
+
+	testFile, err := os.ReadFile(mockPlanTestFile)
+	require.NoError(t, err, "Failed to read %s", mockPlanTestFile)
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "tests"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "tests", "plan.tftest.hcl"), testFile, 0o644))
+
+	options := &terraform.Options{
+		TerraformDir:    dir,
+		TerraformBinary: "tofu",
+		NoColor:         true,
+		Logger:          logger.Discard,
+	}
+	_, err = terraform.InitE(t, options)
+	require.NoError(t, err, "Failed to initialize %s", dir)
+	return options
+}
+
+// MockPlan plans the module prepared by MockPlanModule with the given variables. It returns the
+// `tofu test` output, and an error if planning failed (e.g. a variable validation failed).
+func MockPlan(t *testing.T, options *terraform.Options, vars map[string]interface{}) (string, error) {
+	data, err := json.Marshal(vars)
+	require.NoError(t, err, "Failed to encode variables")
+	varFile := filepath.Join(t.TempDir(), "vars.tfvars.json")
+	require.NoError(t, os.WriteFile(varFile, data, 0o600))
+
+	return terraform.RunTerraformCommandE(t, options, "test", "-no-color", "-var-file="+varFile)
+}
+
+// normalizeWhitespace collapses runs of whitespace, so messages wrapped across lines can be matched.
+func normalizeWhitespace(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
@@ -0,0 +1,243 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gruntwork-io/terratest/modules/terraform"
+	"github.com/stretchr/testify/require"
+)
+
+// =============================================================================
+// NAMING RULES
+// =============================================================================
+
+// uniqueSuffixLength is the length of the unique ID the AWS provider appends to name prefixes
+// (bucket_prefix, name_prefix).
+const uniqueSuffixLength = 26
+
+// NameRule is an AWS naming constraint on an attribute of a resource type.
+type NameRule struct {
+	Type            string
+	Attribute       string
+	PrefixAttribute string // Set if the name can come from a prefix plus a unique suffix
+	MinLength       int
+	MaxLength       int
+	Pattern         *regexp.Regexp
+}
+
+// NameRules are the constraints of the names the module derives from stack_name.
+var NameRules = []NameRule{
+	{Type: "aws_iam_role", Attribute: "name", MinLength: 1, MaxLength: 64,
+		Pattern: regexp.MustCompile(`^[\w+=,.@-]+$`)},
+	{Type: "aws_iam_instance_profile", Attribute: "name", MinLength: 1, MaxLength: 128,
+		Pattern: regexp.MustCompile(`^[\w+=,.@-]+$`)},
+	{Type: "aws_sqs_queue", Attribute: "name", MinLength: 1, MaxLength: 80,
+		Pattern: regexp.MustCompile(`^[A-Za-z0-9_-]+(\.fifo)?$`)},
+	{Type: "aws_apprunner_service", Attribute: "service_name", MinLength: 4, MaxLength: 40,
+		Pattern: regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)},
+	{Type: "aws_apprunner_auto_scaling_configuration_version", Attribute: "auto_scaling_configuration_name", MinLength: 4, MaxLength: 32,
+		Pattern: regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)},
+	{Type: "aws_apprunner_vpc_connector", Attribute: "vpc_connector_name", MinLength: 4, MaxLength: 40,
+		Pattern: regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)},
+	{Type: "aws_s3_bucket", Attribute: "bucket", PrefixAttribute: "bucket_prefix", MinLength: 3, MaxLength: 63,
+		Pattern: regexp.MustCompile(`^[a-z0-9][a-z0-9.-]*[a-z0-9]$`)},
+	{Type: "aws_resourcegroups_group", Attribute: "name", MinLength: 1, MaxLength: 128,
+		Pattern: regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)},
+	{Type: "aws_lambda_function", Attribute: "function_name", MinLength: 1, MaxLength: 64,
+		Pattern: regexp.MustCompile(`^[A-Za-z0-9_-]+$`)},
+	{Type: "aws_cloudwatch_dashboard", Attribute: "dashboard_name", MinLength: 1, MaxLength: 255,
+		Pattern: regexp.MustCompile(`^[A-Za-z0-9_-]+$`)},
+}
+
+// PlannedName is a name of a planned resource, checked against its rule.
+type PlannedName struct {
+	Address  string
+	Rule     NameRule
+	Value    string // Prefix names end with a placeholder for the unique suffix
+	Prefixed bool
+}
+
+// Violations returns the ways the name breaks its rule.
+func (n PlannedName) Violations() []string {
+	var violations []string
+	if len(n.Value) > n.Rule.MaxLength {
+		violations = append(violations, fmt.Sprintf("%s is %d characters (max %d)", n.Rule.Attribute, len(n.Value), n.Rule.MaxLength))
+	}
+	if len(n.Value) < n.Rule.MinLength {
+		violations = append(violations, fmt.Sprintf("%s is %d characters (min %d)", n.Rule.Attribute, len(n.Value), n.Rule.MinLength))
+	}
+	if n.Rule.Pattern != nil && !n.Rule.Pattern.MatchString(n.Value) {
+		violations = append(violations, fmt.Sprintf("%s %q does not match %s", n.Rule.Attribute, n.Value, n.Rule.Pattern))
+	}
+	return violations
+}
+
+// StackNameLengthRange returns the shortest and longest stack name for which the name stays within
+// its length limits, assuming it was derived from stackName. ok is false if it does not contain
+// stackName.
+func (n PlannedName) StackNameLengthRange(stackName string) (min, max int, ok bool) {
+	occurrences := strings.Count(n.Value, stackName)
+	if stackName == "" || occurrences == 0 {
+		return 0, 0, false
+	}
+	fixed := len(n.Value) - occurrences*len(stackName)
+	max = (n.Rule.MaxLength - fixed) / occurrences
+	min = 1
+	if n.Rule.MinLength > fixed {
+		min = (n.Rule.MinLength - fixed + occurrences - 1) / occurrences
+	}
+	return min, max, true
+}
+
+// PlannedNames extracts the names covered by NameRules from the planned_values of
+// `tofu show -json <planfile>` output, sorted by address.
+func PlannedNames(planJSON []byte) ([]PlannedName, error) {
+	var plan struct {
+		PlannedValues struct {
+			RootModule plannedModule `json:"root_module"`
+		} `json:"planned_values"`
+	}
+	if err := json.Unmarshal(planJSON, &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan JSON: %w", err)
+	}
+
+	rules := map[string]NameRule{}
+	for _, rule := range NameRules {
+		rules[rule.Type] = rule
+	}
+
+	var names []PlannedName
+	var walk func(module plannedModule)
+	walk = func(module plannedModule) {
+		for _, resource := range module.Resources {
+			rule, found := rules[resource.Type]
+			if !found || resource.Mode != "managed" {
+				continue
+			}
+			if value, ok := resource.Values[rule.Attribute].(string); ok && value != "" {
+				names = append(names, PlannedName{Address: resource.Address, Rule: rule, Value: value})
+			} else if prefix, ok := resource.Values[rule.PrefixAttribute].(string); ok && rule.PrefixAttribute != "" && prefix != "" {
+				names = append(names, PlannedName{
+					Address:  resource.Address,
+					Rule:     rule,
+					Value:    prefix + strings.Repeat("0", uniqueSuffixLength),
+					Prefixed: true,
+				})
+			}
+		}
+		for _, child := range module.ChildModules {
+			walk(child)
+		}
+	}
+	walk(plan.PlannedValues.RootModule)
+
+	sort.Slice(names, func(i, j int) bool { return names[i].Address < names[j].Address })
+	return names, nil
+}
+
+// plannedModule is a module of planned_values in plan JSON.
+type plannedModule struct {
+	Resources []struct {
+		Address string                 `json:"address"`
+		Mode    string                 `json:"mode"`
+		Type    string                 `json:"type"`
+		Values  map[string]interface{} `json:"values"`
+	} `json:"resources"`
+	ChildModules []plannedModule `json:"child_modules"`
+}
+
+// StackNameLimits is the range of stack_name lengths for which every derived name is valid.
+type StackNameLimits struct {
+	MinLength    int
+	MaxLength    int
+	MinLimitedBy PlannedName
+	MaxLimitedBy PlannedName
+}
+
+// ComputeStackNameLimits returns the stack_name length range allowed by the names planned for
+// stackName.
+func ComputeStackNameLimits(names []PlannedName, stackName string) (StackNameLimits, error) {
+	limits := StackNameLimits{MinLength: 1, MaxLength: -1}
+	for _, name := range names {
+		min, max, ok := name.StackNameLengthRange(stackName)
+		if !ok {
+			continue
+		}
+		if limits.MaxLength < 0 || max < limits.MaxLength {
+			limits.MaxLength = max
+			limits.MaxLimitedBy = name
+		}
+		if min > limits.MinLength {
+			limits.MinLength = min
+			limits.MinLimitedBy = name
+		}
+	}
+	if limits.MaxLength < 0 {
+		return limits, fmt.Errorf("no planned name contains stack name %q", stackName)
+	}
+	return limits, nil
+}
+
+// =============================================================================
+// STACK NAME FUZZING
+// =============================================================================
+
+// stackNameAlphabet are the characters the stack_name validation allows.
+const stackNameAlphabet = "abcdefghijklmnopqrstuvwxyz0123456789-"
+
+// FuzzStackNames returns a random stack name of each length. Names start with a letter and contain
+// letters, digits and hyphens, so they pass the stack_name validation. The same seed returns the same
+// names.
+func FuzzStackNames(seed int64, lengths []int) []string {
+	random := rand.New(rand.NewSource(seed))
+	var names []string
+	for _, length := range lengths {
+		if length < 1 {
+			continue
+		}
+		name := make([]byte, length)
+		name[0] = stackNameAlphabet[random.Intn(26)]
+		for i := 1; i < length; i++ {
+			name[i] = stackNameAlphabet[random.Intn(len(stackNameAlphabet))]
+		}
+		names = append(names, string(name))
+	}
+	return names
+}
+
+// PlanStackNames plans the initialized module with stack_name set to stackName and returns the names
+// of the planned resources. Nothing is created; the plan only needs credentials for data sources.
+func PlanStackNames(t *testing.T, options *terraform.Options, stackName string) []PlannedName {
+	names, err := PlanStackNamesE(t, options, stackName)
+	require.NoError(t, err, "Failed to plan names with stack_name %q", stackName)
+	return names
+}
+
+// PlanStackNamesE is PlanStackNames, returning the error instead of failing the test. The AWS
+// provider rejects some names at plan time (e.g. App Runner names outside 4-40 characters), in which
+// case the error is the plan's.
+func PlanStackNamesE(t *testing.T, options *terraform.Options, stackName string) ([]PlannedName, error) {
+	planOptions := *options
+	planOptions.PlanFilePath = filepath.Join(t.TempDir(), "naming.tfplan")
+	planOptions.Vars = map[string]interface{}{}
+	for name, value := range options.Vars {
+		planOptions.Vars[name] = value
+	}
+	planOptions.Vars["stack_name"] = stackName
+
+	if _, err := terraform.PlanE(t, &planOptions); err != nil {
+		return nil, fmt.Errorf("plan with stack_name %q failed: %w", stackName, err)
+	}
+	planJSON, err := terraform.ShowE(t, &planOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to show plan: %w", err)
+	}
+	return PlannedNames([]byte(planJSON))
+}
@@ -0,0 +1,98 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadPlannedNames(t *testing.T) []PlannedName {
+	data, err := os.ReadFile(filepath.Join("testdata", "plan", "naming.json"))
+	require.NoError(t, err)
+	names, err := PlannedNames(data)
+	require.NoError(t, err)
+	return names
+}
+
+func TestPlannedNames(t *testing.T) {
+	names := loadPlannedNames(t)
+
+	values := map[string]string{}
+	for _, name := range names {
+		values[name.Address] = name.Value
+	}
+	assert.Equal(t, "test-naming1-ec2-instance-role", values["module.compute.aws_iam_role.ec2_instance"])
+	assert.Equal(t, "test-naming1-slack-webhook-role", values["module.core.aws_iam_role.slack_webhook[0]"])
+	assert.Equal(t, "test-naming1-main-dlq.fifo", values["module.core.aws_sqs_queue.main_dead_letter"])
+	assert.Equal(t, "test-naming1", values["module.core.aws_apprunner_service.this"])
+	assert.Equal(t, "test-naming1-ec2-instances", values["module.compute.aws_resourcegroups_group.ec2_instances"])
+	assert.NotContains(t, values, "module.core.aws_dynamodb_table.locks", "Resource types without a rule are skipped")
+	assert.NotContains(t, values, "module.core.data.aws_iam_policy_document.apprunner")
+
+	// Buckets are planned with a prefix, the provider appends a unique suffix
+	bucket := values["module.storage.aws_s3_bucket.logging"]
+	assert.Equal(t, "test-naming1-logging-"+strings.Repeat("0", uniqueSuffixLength), bucket)
+
+	for _, name := range names {
+		assert.Empty(t, name.Violations(), "%s should be valid for a 12 character stack name", name.Address)
+	}
+}
+
+func TestPlannedNameViolations(t *testing.T) {
+	rule := NameRule{Type: "aws_apprunner_service", Attribute: "service_name", MinLength: 4, MaxLength: 10,
+		Pattern: regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)}
+
+	assert.Empty(t, PlannedName{Rule: rule, Value: "abcd"}.Violations())
+	assert.Equal(t, []string{"service_name is 11 characters (max 10)"},
+		PlannedName{Rule: rule, Value: "abcdefghijk"}.Violations())
+	assert.Equal(t, []string{"service_name is 3 characters (min 4)"},
+		PlannedName{Rule: rule, Value: "abc"}.Violations())
+	assert.Equal(t, []string{`service_name "-abcd" does not match ^[A-Za-z0-9][A-Za-z0-9_-]*$`},
+		PlannedName{Rule: rule, Value: "-abcd"}.Violations())
+}
+
+func TestComputeStackNameLimits(t *testing.T) {
+	names := loadPlannedNames(t)
+
+	limits, err := ComputeStackNameLimits(names, "test-naming1")
+	require.NoError(t, err)
+	assert.Equal(t, 20, limits.MaxLength, "32 character auto scaling configuration name minus -autoscaling")
+	assert.Equal(t, "module.core.aws_apprunner_auto_scaling_configuration_version.this", limits.MaxLimitedBy.Address)
+	assert.Equal(t, 4, limits.MinLength, "The App Runner service is named after the stack")
+	assert.Equal(t, "module.core.aws_apprunner_service.this", limits.MinLimitedBy.Address)
+
+	for _, name := range names {
+		switch name.Address {
+		case "module.compute.aws_iam_role.ec2_instance":
+			_, max, ok := name.StackNameLengthRange("test-naming1")
+			assert.True(t, ok)
+			assert.Equal(t, 64-len("-ec2-instance-role"), max)
+		case "module.storage.aws_s3_bucket.logging":
+			_, max, ok := name.StackNameLengthRange("test-naming1")
+			assert.True(t, ok)
+			assert.Equal(t, 63-len("-logging-")-uniqueSuffixLength, max)
+		}
+	}
+
+	_, err = ComputeStackNameLimits(names, "other-stack")
+	assert.ErrorContains(t, err, "no planned name contains stack name")
+}
+
+func TestFuzzStackNames(t *testing.T) {
+	lengths := []int{1, 4, 20, 21, 40, 0}
+	names := FuzzStackNames(42, lengths)
+	require.Len(t, names, 5, "Non-positive lengths are skipped")
+	assert.Equal(t, names, FuzzStackNames(42, lengths), "Names are reproducible from the seed")
+	assert.NotEqual(t, names, FuzzStackNames(43, lengths))
+
+	stackNamePattern := regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+	for i, name := range names {
+		assert.Len(t, name, lengths[i])
+		assert.Regexp(t, stackNamePattern, name)
+	}
+}
@@ -0,0 +1,358 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+// =============================================================================
+// RUNNER POOL DEFINITIONS
+// =============================================================================
+
+// RunnerPool is a pre-warmed runner pool: Stopped instances are kept stopped (or hibernated) and
+// Hot instances running, ready to be started for jobs labelled pool=<Name>.
+type RunnerPool struct {
+	Name     string
+	Runner   string // Runner spec, e.g. "2cpu-linux-x64"
+	Stopped  int
+	Hot      int
+	Timezone string // Optional - defaults to UTC
+}
+
+type poolSchedule struct {
+	Name    string `yaml:"name"`
+	Stopped int    `yaml:"stopped"`
+	Hot     int    `yaml:"hot"`
+}
+
+type poolDefinition struct {
+	Env      string         `yaml:"env,omitempty"`
+	Runner   string         `yaml:"runner"`
+	Timezone string         `yaml:"timezone"`
+	Schedule []poolSchedule `yaml:"schedule"`
+}
+
+// BuildPoolDefinition renders pools as a RunsOn configuration document with a single, always-on
+// "default" schedule per pool.
+func BuildPoolDefinition(env string, pools ...RunnerPool) ([]byte, error) {
+	if len(pools) == 0 {
+		return nil, fmt.Errorf("at least one pool is required")
+	}
+
+	definitions := map[string]poolDefinition{}
+	for _, pool := range pools {
+		if pool.Name == "" || pool.Runner == "" {
+			return nil, fmt.Errorf("pool name and runner are required, got: %+v", pool)
+		}
+		if pool.Stopped < 0 || pool.Hot < 0 || pool.Stopped+pool.Hot == 0 {
+			return nil, fmt.Errorf("pool %s should keep at least one instance", pool.Name)
+		}
+		if _, ok := definitions[pool.Name]; ok {
+			return nil, fmt.Errorf("duplicate pool %s", pool.Name)
+		}
+
+		timezone := pool.Timezone
+		if timezone == "" {
+			timezone = "UTC"
+		}
+		definitions[pool.Name] = poolDefinition{
+			Env:      env,
+			Runner:   pool.Runner,
+			Timezone: timezone,
+			Schedule: []poolSchedule{{Name: "default", Stopped: pool.Stopped, Hot: pool.Hot}},
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(map[string]interface{}{"pools": definitions}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// UploadPoolDefinition writes a pool definition to the config bucket under
+// RUNS_ON_TEST_POOL_CONFIG_KEY (default runs-on.yml) and returns the key.
+func UploadPoolDefinition(t *testing.T, configBucket string, definition []byte) string {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := s3.NewFromConfig(cfg)
+
+	key := GetOptionalEnv("RUNS_ON_TEST_POOL_CONFIG_KEY", "runs-on.yml")
+	_, err := client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(configBucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(definition),
+		ContentType: aws.String("application/yaml"),
+	})
+	require.NoError(t, err, "Failed to write pool definition to s3://%s/%s", configBucket, key)
+
+	t.Logf("✓ Pool definition written to s3://%s/%s", configBucket, key)
+	return key
+}
+
+// DeletePoolDefinition removes a pool definition from the config bucket, so the app stops keeping
+// (and refilling) its pools.
+func DeletePoolDefinition(t *testing.T, configBucket, key string) {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := s3.NewFromConfig(cfg)
+
+	_, err := client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(configBucket),
+		Key:    aws.String(key),
+	})
+	require.NoError(t, err, "Failed to delete pool definition s3://%s/%s", configBucket, key)
+
+	t.Logf("✓ Pool definition s3://%s/%s deleted", configBucket, key)
+}
+
+// =============================================================================
+// RUNNER POOL VALIDATORS
+// =============================================================================
+
+// poolTagKey is the tag RunsOn sets on pool instances to the name of their pool.
+const poolTagKey = "runs-on-pool"
+
+// PoolInstance is a runner instance owned by a pool.
+type PoolInstance struct {
+	InstanceID string
+	Pool       string // Value of the instance's runs-on-pool tag
+	State      string // EC2 instance state name
+	Hibernated bool   // Stopped through hibernation rather than a plain stop
+	LaunchTime time.Time
+	Tags       map[string]string
+}
+
+// poolInstanceFromEC2 extracts pool details from a described instance. The pool name is read from
+// the runs-on-pool tag.
+func poolInstanceFromEC2(instance ec2types.Instance) PoolInstance {
+	pool := PoolInstance{
+		InstanceID: aws.ToString(instance.InstanceId),
+		LaunchTime: aws.ToTime(instance.LaunchTime),
+		Tags:       map[string]string{},
+	}
+	if instance.State != nil {
+		pool.State = string(instance.State.Name)
+	}
+	if instance.StateReason != nil {
+		pool.Hibernated = strings.Contains(aws.ToString(instance.StateReason.Code), "Hibernate")
+	}
+
+	for _, tag := range instance.Tags {
+		pool.Tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	pool.Pool = pool.Tags[poolTagKey]
+	return pool
+}
+
+// ListPoolInstances returns the stack's instances belonging to poolName, in any state but terminated.
+func ListPoolInstances(t *testing.T, stackName, poolName string) []PoolInstance {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := ec2.NewFromConfig(cfg)
+
+	var instances []PoolInstance
+	paginator := ec2.NewDescribeInstancesPaginator(client, &ec2.DescribeInstancesInput{
+		Filters: []ec2types.Filter{
+			{
+				Name:   aws.String("tag:runs-on-stack-name"),
+				Values: []string{stackName},
+			},
+			{
+				Name:   aws.String("instance-state-name"),
+				Values: []string{"pending", "running", "stopping", "stopped"},
+			},
+		},
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		require.NoError(t, err, "Failed to describe instances")
+		for _, reservation := range page.Reservations {
+			for _, instance := range reservation.Instances {
+				if pool := poolInstanceFromEC2(instance); pool.Pool == poolName {
+					instances = append(instances, pool)
+				}
+			}
+		}
+	}
+	return instances
+}
+
+// WaitForPoolInstances waits until poolName has at least count stopped (or hibernated) instances
+// and returns them, or whatever was found at the timeout.
+func WaitForPoolInstances(t *testing.T, stackName, poolName string, count int, timeout time.Duration) []PoolInstance {
+	deadline := time.Now().Add(timeout)
+	for {
+		var stopped []PoolInstance
+		instances := ListPoolInstances(t, stackName, poolName)
+		for _, instance := range instances {
+			if instance.State == string(ec2types.InstanceStateNameStopped) {
+				stopped = append(stopped, instance)
+			}
+		}
+
+		if len(stopped) >= count {
+			t.Logf("✓ Pool %s has %d stopped instance(s)", poolName, len(stopped))
+			return stopped
+		}
+		if time.Now().After(deadline) {
+			t.Logf("Pool %s has %d stopped instance(s) out of %d, expected %d", poolName, len(stopped), len(instances), count)
+			return stopped
+		}
+		t.Logf("Pool %s has %d/%d stopped instance(s) (%d total), waiting...", poolName, len(stopped), count, len(instances))
+		sleepUntilRetry(15*time.Second, deadline)
+	}
+}
+
+// TerminatePoolInstances terminates poolName's instances until none is left, terminating any the
+// app launches meanwhile, and fails if some remain at the timeout. Delete the pool definition
+// first, otherwise the app keeps refilling the pool.
+func TerminatePoolInstances(t *testing.T, stackName, poolName string, timeout time.Duration) {
+	terminating := map[string]bool{}
+	deadline := time.Now().Add(timeout)
+	for {
+		instances := ListPoolInstances(t, stackName, poolName)
+		if len(instances) == 0 {
+			t.Logf("✓ Pool %s has no instances left (%d terminated)", poolName, len(terminating))
+			return
+		}
+		if time.Now().After(deadline) {
+			assert.Empty(t, instances, "Pool %s should have no instances left", poolName)
+			return
+		}
+		for _, instance := range instances {
+			if !terminating[instance.InstanceID] {
+				TerminateTestInstance(t, instance.InstanceID)
+				terminating[instance.InstanceID] = true
+			}
+		}
+		sleepUntilRetry(15*time.Second, deadline)
+	}
+}
+
+// ValidatePoolInstance verifies a pool instance is stopped and tagged with the stack and pool names.
+func ValidatePoolInstance(t *testing.T, instance PoolInstance, stackName, poolName string) {
+	assert.Equal(t, stackName, instance.Tags["runs-on-stack-name"], "Pool instance %s should be tagged with the stack name", instance.InstanceID)
+	assert.Equal(t, poolName, instance.Pool, "Pool instance %s should be tagged with the pool name", instance.InstanceID)
+	assert.Equal(t, string(ec2types.InstanceStateNameStopped), instance.State, "Pool instance %s should be stopped", instance.InstanceID)
+
+	mode := "stopped"
+	if instance.Hibernated {
+		mode = "hibernated"
+	}
+	t.Logf("✓ Pool instance %s (%s, launched %s) is %s and tagged for pool %s",
+		instance.InstanceID, instance.State, instance.LaunchTime.Format(time.RFC3339), mode, poolName)
+}
+
+// WaitForPoolPickup waits for one of the given pool instances to be started and returns its ID and
+// the time it was seen running, or "" if none starts before the timeout.
+func WaitForPoolPickup(t *testing.T, stackName, poolName string, pool []PoolInstance, timeout time.Duration) (string, time.Time) {
+	candidates := map[string]bool{}
+	for _, instance := range pool {
+		candidates[instance.InstanceID] = true
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		for _, instance := range ListPoolInstances(t, stackName, poolName) {
+			if candidates[instance.InstanceID] && instance.State == string(ec2types.InstanceStateNameRunning) {
+				return instance.InstanceID, time.Now()
+			}
+		}
+		if time.Now().After(deadline) {
+			return "", time.Time{}
+		}
+		sleepUntilRetry(5*time.Second, deadline)
+	}
+}
+
+// WaitForPoolRefill waits until poolName has size instances again besides the one that picked up
+// a job, and returns them, or whatever was found at the timeout.
+func WaitForPoolRefill(t *testing.T, stackName, poolName string, size int, pickedUp string, timeout time.Duration) []PoolInstance {
+	deadline := time.Now().Add(timeout)
+	for {
+		var ready []PoolInstance
+		for _, instance := range ListPoolInstances(t, stackName, poolName) {
+			if instance.InstanceID != pickedUp {
+				ready = append(ready, instance)
+			}
+		}
+		if len(ready) >= size || time.Now().After(deadline) {
+			return ready
+		}
+		t.Logf("Pool %s has %d/%d instance(s) besides %s, waiting...", poolName, len(ready), size, pickedUp)
+		sleepUntilRetry(15*time.Second, deadline)
+	}
+}
+
+// RunRunnerPoolPickup replays a synthetic job labelled pool=<pool.Name> and verifies that one of the
+// stopped pool instances is started for it instead of a fresh launch, and that the pool is refilled
+// to its configured size. Returns the pickup latency, from the queued webhook to the pool instance
+// running. The job goes to the stack's own app (see stackWebhookTarget), which skips the test
+// without one.
+func RunRunnerPoolPickup(t *testing.T, stackName, appRunnerURL, configBucket string, pool RunnerPool, stopped []PoolInstance) time.Duration {
+	poolName := pool.Name
+	require.NotEmpty(t, stopped, "Pool %s has no stopped instances to pick up", poolName)
+
+	ValidateAppRunnerHealth(t, appRunnerURL, 20)
+	webhookURL, secret := stackWebhookTarget(t, appRunnerURL, configBucket)
+
+	installationID, err := strconv.ParseInt(GetOptionalEnv("RUNS_ON_TEST_APP_INSTALLATION_ID", "0"), 10, 64)
+	require.NoError(t, err, "Invalid RUNS_ON_TEST_APP_INSTALLATION_ID")
+	repo := GetOptionalEnv("RUNS_ON_TEST_REPO", "test-org/test-repo")
+
+	job := NewSyntheticWorkflowJob(repo, installationID, "pool="+poolName)
+	queuedAt := time.Now()
+	t.Logf("Requesting pool runner with labels %s", job.Labels[0])
+	ReplayWorkflowJob(t, webhookURL, secret, job, 0, WorkflowJobQueued)
+
+	instanceID, runningAt := WaitForPoolPickup(t, stackName, poolName, stopped, 5*time.Minute)
+	require.NotEmpty(t, instanceID, "No stopped instance of pool %s was started for the job", poolName)
+	latency := runningAt.Sub(queuedAt)
+	t.Logf("✓ Pool instance %s picked up the job in %s", instanceID, latency.Round(time.Second))
+
+	// The pool goes back to its configured size with instances tagged runs-on-pool
+	size := pool.Stopped + pool.Hot
+	ready := WaitForPoolRefill(t, stackName, poolName, size, instanceID, 15*time.Minute)
+	assert.Len(t, ready, size, "Pool %s should be refilled to %d instance(s) besides %s", poolName, size, instanceID)
+	for _, instance := range ready {
+		if instance.LaunchTime.After(queuedAt) {
+			t.Logf("Pool %s refilled with %s (%s)", poolName, instance.InstanceID, instance.State)
+		}
+	}
+	if len(ready) == size {
+		t.Logf("✓ Pool %s is back to %d instance(s)", poolName, size)
+	}
+
+	ReplayWorkflowJob(t, webhookURL, secret, job, 5*time.Second, WorkflowJobInProgress, WorkflowJobCompleted)
+	return latency
+}
+
+// ValidatePoolDeadLetterQueueEmpty verifies nothing from the pool queue was dead-lettered.
+func ValidatePoolDeadLetterQueueEmpty(t *testing.T, stackName string) {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := sqs.NewFromConfig(cfg)
+
+	queueName := stackName + "-pool-dlq"
+	result, err := client.GetQueueUrl(ctx, &sqs.GetQueueUrlInput{QueueName: aws.String(queueName)})
+	require.NoError(t, err, "Failed to get URL of %s", queueName)
+
+	assert.True(t, WaitForQueueDrained(t, aws.ToString(result.QueueUrl), 0), "Pool DLQ %s should be empty", queueName)
+}
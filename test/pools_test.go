@@ -0,0 +1,99 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestBuildPoolDefinition(t *testing.T) {
+	definition, err := BuildPoolDefinition("test",
+		RunnerPool{Name: "small-x64", Runner: "2cpu-linux-x64", Stopped: 2},
+		RunnerPool{Name: "large-arm64", Runner: "8cpu-linux-arm64", Stopped: 1, Hot: 1, Timezone: "Europe/Paris"},
+	)
+	require.NoError(t, err)
+
+	var parsed struct {
+		Pools map[string]struct {
+			Env      string `yaml:"env"`
+			Runner   string `yaml:"runner"`
+			Timezone string `yaml:"timezone"`
+			Schedule []struct {
+				Name    string `yaml:"name"`
+				Stopped int    `yaml:"stopped"`
+				Hot     int    `yaml:"hot"`
+			} `yaml:"schedule"`
+		} `yaml:"pools"`
+	}
+	require.NoError(t, yaml.Unmarshal(definition, &parsed))
+	require.Len(t, parsed.Pools, 2)
+
+	small := parsed.Pools["small-x64"]
+	assert.Equal(t, "test", small.Env)
+	assert.Equal(t, "2cpu-linux-x64", small.Runner)
+	assert.Equal(t, "UTC", small.Timezone)
+	require.Len(t, small.Schedule, 1)
+	assert.Equal(t, "default", small.Schedule[0].Name)
+	assert.Equal(t, 2, small.Schedule[0].Stopped)
+	assert.Equal(t, 0, small.Schedule[0].Hot)
+
+	large := parsed.Pools["large-arm64"]
+	assert.Equal(t, "Europe/Paris", large.Timezone)
+	assert.Equal(t, 1, large.Schedule[0].Hot)
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := BuildPoolDefinition("test")
+		assert.Error(t, err)
+		_, err = BuildPoolDefinition("test", RunnerPool{Name: "empty", Runner: "2cpu-linux-x64"})
+		assert.ErrorContains(t, err, "at least one instance")
+		_, err = BuildPoolDefinition("test", RunnerPool{Name: "no-runner", Stopped: 1})
+		assert.Error(t, err)
+		_, err = BuildPoolDefinition("test",
+			RunnerPool{Name: "dup", Runner: "2cpu-linux-x64", Stopped: 1},
+			RunnerPool{Name: "dup", Runner: "2cpu-linux-x64", Stopped: 1})
+		assert.ErrorContains(t, err, "duplicate")
+	})
+}
+
+func TestPoolInstanceFromEC2(t *testing.T) {
+	launched := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	instance := ec2types.Instance{
+		InstanceId: aws.String("i-0123456789abcdef0"),
+		LaunchTime: aws.Time(launched),
+		State:      &ec2types.InstanceState{Name: ec2types.InstanceStateNameStopped},
+		StateReason: &ec2types.StateReason{
+			Code:    aws.String("Client.UserInitiatedHibernate"),
+			Message: aws.String("Client.UserInitiatedHibernate: User initiated hibernate"),
+		},
+		Tags: []ec2types.Tag{
+			{Key: aws.String("runs-on-stack-name"), Value: aws.String("runs-on-test")},
+			{Key: aws.String("runs-on-pool"), Value: aws.String("small-x64")},
+			{Key: aws.String("Name"), Value: aws.String("runs-on-test-pool")},
+			{Key: aws.String("Pool-Owner"), Value: aws.String("platform")}, // Other keys containing "pool" are not the pool
+		},
+	}
+
+	pool := poolInstanceFromEC2(instance)
+	assert.Equal(t, "i-0123456789abcdef0", pool.InstanceID)
+	assert.Equal(t, "small-x64", pool.Pool)
+	assert.Equal(t, "stopped", pool.State)
+	assert.True(t, pool.Hibernated)
+	assert.Equal(t, launched, pool.LaunchTime)
+	assert.Equal(t, "runs-on-test", pool.Tags["runs-on-stack-name"])
+
+	instance.StateReason.Code = aws.String("Client.UserInitiatedShutdown")
+	assert.False(t, poolInstanceFromEC2(instance).Hibernated)
+
+	instance.Tags = []ec2types.Tag{instance.Tags[0], instance.Tags[3]}
+	instance.StateReason = nil
+	instance.State = nil
+	pool = poolInstanceFromEC2(instance)
+	assert.Empty(t, pool.Pool, "Instances without a pool tag are not pool instances")
+	assert.Empty(t, pool.State)
+	assert.False(t, pool.Hibernated)
+}
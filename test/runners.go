@@ -0,0 +1,576 @@
+package test
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	ec2types "github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// =============================================================================
+// RUNNER INSTANCE VALIDATORS
+// =============================================================================
+
+// RunnerInstanceFacts are the properties of a launched runner instance that its labels control.
+type RunnerInstanceFacts struct {
+	InstanceID           string
+	InstanceType         string
+	VCPUs                int32
+	MemoryMiB            int64
+	Lifecycle            string // "spot" or "on-demand"
+	Architecture         string // "x86_64" or "arm64"
+	RootVolumeSize       int32  // GiB
+	RootVolumeThroughput int32  // MiB/s
+	ImageID              string
+	ImageName            string
+}
+
+// RunnerExpectation is what a runner launched for a set of labels should look like.
+// Zero-valued fields are not checked.
+type RunnerExpectation struct {
+	VCPUs                int32
+	MinMemoryGiB         int64
+	FamilyPrefix         string // Instance type prefix, e.g. "m7a"
+	Lifecycle            string // "spot" or "on-demand"
+	Architecture         string
+	RootVolumeSize       int32
+	RootVolumeThroughput int32
+	ImageName            string // Substring of the AMI name, e.g. "ubuntu24-full-arm64"
+}
+
+// RunnerLabelCase is a runs-on label spec and the runner it should produce.
+type RunnerLabelCase struct {
+	Name   string
+	Spec   string // Label spec after "runs-on=<id>/", e.g. "cpu=4/family=m7a"
+	Expect RunnerExpectation
+}
+
+// Mismatches returns a description of every property that does not meet the expectation.
+func (f RunnerInstanceFacts) Mismatches(expect RunnerExpectation) []string {
+	var mismatches []string
+
+	if expect.VCPUs != 0 && f.VCPUs != expect.VCPUs {
+		mismatches = append(mismatches, fmt.Sprintf("vCPUs: expected %d, got %d (%s)", expect.VCPUs, f.VCPUs, f.InstanceType))
+	}
+	if expect.MinMemoryGiB != 0 && f.MemoryMiB < expect.MinMemoryGiB*1024 {
+		mismatches = append(mismatches, fmt.Sprintf("memory: expected at least %d GiB, got %d MiB (%s)", expect.MinMemoryGiB, f.MemoryMiB, f.InstanceType))
+	}
+	if expect.FamilyPrefix != "" && !strings.HasPrefix(f.InstanceType, expect.FamilyPrefix) {
+		mismatches = append(mismatches, fmt.Sprintf("instance type: expected family %s, got %s", expect.FamilyPrefix, f.InstanceType))
+	}
+	if expect.Lifecycle != "" && f.Lifecycle != expect.Lifecycle {
+		mismatches = append(mismatches, fmt.Sprintf("lifecycle: expected %s, got %s", expect.Lifecycle, f.Lifecycle))
+	}
+	if expect.Architecture != "" && f.Architecture != expect.Architecture {
+		mismatches = append(mismatches, fmt.Sprintf("architecture: expected %s, got %s", expect.Architecture, f.Architecture))
+	}
+	if expect.RootVolumeSize != 0 && f.RootVolumeSize != expect.RootVolumeSize {
+		mismatches = append(mismatches, fmt.Sprintf("root volume size: expected %d GiB, got %d GiB", expect.RootVolumeSize, f.RootVolumeSize))
+	}
+	if expect.RootVolumeThroughput != 0 && f.RootVolumeThroughput != expect.RootVolumeThroughput {
+		mismatches = append(mismatches, fmt.Sprintf("root volume throughput: expected %d MiB/s, got %d MiB/s", expect.RootVolumeThroughput, f.RootVolumeThroughput))
+	}
+	if expect.ImageName != "" && !strings.Contains(f.ImageName, expect.ImageName) {
+		mismatches = append(mismatches, fmt.Sprintf("AMI: expected name containing %s, got %s (%s)", expect.ImageName, f.ImageName, f.ImageID))
+	}
+
+	return mismatches
+}
+
+// RunnerLabelMatrix returns the label cases exercised by the runner label matrix test.
+// Disk expectations come from the stack's App Runner environment
+// (RUNS_ON_RUNNER_{DEFAULT,LARGE}_{DISK_SIZE,VOLUME_THROUGHPUT}).
+func RunnerLabelMatrix(env map[string]string) ([]RunnerLabelCase, error) {
+	disk := map[string]int32{}
+	for _, key := range []string{
+		"RUNS_ON_RUNNER_DEFAULT_DISK_SIZE",
+		"RUNS_ON_RUNNER_DEFAULT_VOLUME_THROUGHPUT",
+		"RUNS_ON_RUNNER_LARGE_DISK_SIZE",
+		"RUNS_ON_RUNNER_LARGE_VOLUME_THROUGHPUT",
+	} {
+		value, err := strconv.ParseInt(env[key], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s %q: %w", key, env[key], err)
+		}
+		disk[key] = int32(value)
+	}
+
+	defaultDisk := func(expect RunnerExpectation) RunnerExpectation {
+		expect.RootVolumeSize = disk["RUNS_ON_RUNNER_DEFAULT_DISK_SIZE"]
+		expect.RootVolumeThroughput = disk["RUNS_ON_RUNNER_DEFAULT_VOLUME_THROUGHPUT"]
+		return expect
+	}
+
+	return []RunnerLabelCase{
+		{
+			Name:   "Default",
+			Spec:   "runner=2cpu-linux-x64",
+			Expect: defaultDisk(RunnerExpectation{VCPUs: 2, Architecture: "x86_64"}),
+		},
+		{
+			Name:   "CPU",
+			Spec:   "cpu=4",
+			Expect: defaultDisk(RunnerExpectation{VCPUs: 4, Architecture: "x86_64"}),
+		},
+		{
+			Name:   "RAM",
+			Spec:   "cpu=2/ram=16",
+			Expect: defaultDisk(RunnerExpectation{VCPUs: 2, MinMemoryGiB: 16, Architecture: "x86_64"}),
+		},
+		{
+			Name:   "Family",
+			Spec:   "cpu=2/family=m7a",
+			Expect: defaultDisk(RunnerExpectation{VCPUs: 2, FamilyPrefix: "m7a", Architecture: "x86_64"}),
+		},
+		{
+			// The app launches spot capacity unless the spot circuit breaker is open
+			Name:   "Spot",
+			Spec:   "runner=2cpu-linux-x64/spot=true",
+			Expect: defaultDisk(RunnerExpectation{VCPUs: 2, Lifecycle: "spot"}),
+		},
+		{
+			Name:   "OnDemand",
+			Spec:   "runner=2cpu-linux-x64/spot=false",
+			Expect: defaultDisk(RunnerExpectation{VCPUs: 2, Lifecycle: "on-demand"}),
+		},
+		{
+			Name: "LargeDisk",
+			Spec: "runner=2cpu-linux-x64/disk=large",
+			Expect: RunnerExpectation{
+				VCPUs:                2,
+				RootVolumeSize:       disk["RUNS_ON_RUNNER_LARGE_DISK_SIZE"],
+				RootVolumeThroughput: disk["RUNS_ON_RUNNER_LARGE_VOLUME_THROUGHPUT"],
+			},
+		},
+		{
+			Name:   "ImageArm64",
+			Spec:   "cpu=2/image=ubuntu24-full-arm64",
+			Expect: defaultDisk(RunnerExpectation{VCPUs: 2, Architecture: "arm64", ImageName: "ubuntu24-full-arm64"}),
+		},
+	}, nil
+}
+
+// FindRunnerInstance waits for a runner instance tagged with the stack name that was launched
+// after 'since' and returns the ID of the most recent one, or "" if none appears before the timeout.
+func FindRunnerInstance(t *testing.T, stackName string, since time.Time, timeout time.Duration) string {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := ec2.NewFromConfig(cfg)
+
+	deadline := time.Now().Add(timeout)
+	for {
+		var launched []ec2types.Instance
+		paginator := ec2.NewDescribeInstancesPaginator(client, &ec2.DescribeInstancesInput{
+			Filters: []ec2types.Filter{
+				{
+					Name:   aws.String("tag:runs-on-stack-name"),
+					Values: []string{stackName},
+				},
+				{
+					Name:   aws.String("instance-state-name"),
+					Values: []string{"pending", "running", "stopping", "stopped", "shutting-down", "terminated"},
+				},
+			},
+		})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(ctx)
+			if err != nil {
+				t.Logf("Error describing instances: %v", err)
+				break
+			}
+			for _, reservation := range page.Reservations {
+				for _, instance := range reservation.Instances {
+					if instance.LaunchTime != nil && instance.LaunchTime.After(since) {
+						launched = append(launched, instance)
+					}
+				}
+			}
+		}
+
+		if len(launched) > 0 {
+			sort.Slice(launched, func(i, j int) bool {
+				return launched[i].LaunchTime.After(*launched[j].LaunchTime)
+			})
+			instanceID := aws.ToString(launched[0].InstanceId)
+			t.Logf("Found runner instance %s (%s) launched at %s", instanceID, launched[0].InstanceType, launched[0].LaunchTime.Format(time.RFC3339))
+			return instanceID
+		}
+
+		if time.Now().After(deadline) {
+			t.Logf("No runner instance for stack %s launched after %s", stackName, since.Format(time.RFC3339))
+			return ""
+		}
+		sleepUntilRetry(10*time.Second, deadline)
+	}
+}
+
+// GetRunnerInstanceFacts describes a runner instance, its instance type, root volume and AMI.
+func GetRunnerInstanceFacts(t *testing.T, instanceID string) RunnerInstanceFacts {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := ec2.NewFromConfig(cfg)
+
+	result, err := client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
+		InstanceIds: []string{instanceID},
+	})
+	require.NoError(t, err, "Failed to describe instance %s", instanceID)
+	require.NotEmpty(t, result.Reservations, "Instance %s not found", instanceID)
+	require.NotEmpty(t, result.Reservations[0].Instances, "Instance %s not found", instanceID)
+	instance := result.Reservations[0].Instances[0]
+
+	facts := RunnerInstanceFacts{
+		InstanceID:   instanceID,
+		InstanceType: string(instance.InstanceType),
+		Lifecycle:    "on-demand",
+		Architecture: string(instance.Architecture),
+		ImageID:      aws.ToString(instance.ImageId),
+	}
+	if instance.InstanceLifecycle == ec2types.InstanceLifecycleTypeSpot {
+		facts.Lifecycle = "spot"
+	}
+
+	types, err := client.DescribeInstanceTypes(ctx, &ec2.DescribeInstanceTypesInput{
+		InstanceTypes: []ec2types.InstanceType{instance.InstanceType},
+	})
+	require.NoError(t, err, "Failed to describe instance type %s", instance.InstanceType)
+	if len(types.InstanceTypes) > 0 {
+		info := types.InstanceTypes[0]
+		if info.VCpuInfo != nil {
+			facts.VCPUs = aws.ToInt32(info.VCpuInfo.DefaultVCpus)
+		}
+		if info.MemoryInfo != nil {
+			facts.MemoryMiB = aws.ToInt64(info.MemoryInfo.SizeInMiB)
+		}
+	}
+
+	for _, mapping := range instance.BlockDeviceMappings {
+		if aws.ToString(mapping.DeviceName) != aws.ToString(instance.RootDeviceName) || mapping.Ebs == nil {
+			continue
+		}
+		volumes, err := client.DescribeVolumes(ctx, &ec2.DescribeVolumesInput{
+			VolumeIds: []string{aws.ToString(mapping.Ebs.VolumeId)},
+		})
+		require.NoError(t, err, "Failed to describe root volume of %s", instanceID)
+		if len(volumes.Volumes) > 0 {
+			facts.RootVolumeSize = aws.ToInt32(volumes.Volumes[0].Size)
+			facts.RootVolumeThroughput = aws.ToInt32(volumes.Volumes[0].Throughput)
+		}
+	}
+
+	images, err := client.DescribeImages(ctx, &ec2.DescribeImagesInput{
+		ImageIds: []string{facts.ImageID},
+	})
+	if err != nil {
+		t.Logf("Warning: failed to describe AMI %s: %v", facts.ImageID, err)
+	} else if len(images.Images) > 0 {
+		facts.ImageName = aws.ToString(images.Images[0].Name)
+	}
+
+	return facts
+}
+
+// ValidateRunnerInstance asserts a runner instance matches the expectation for its labels.
+func ValidateRunnerInstance(t *testing.T, instanceID string, expect RunnerExpectation) RunnerInstanceFacts {
+	facts := GetRunnerInstanceFacts(t, instanceID)
+	for _, mismatch := range facts.Mismatches(expect) {
+		assert.Fail(t, "Runner instance mismatch", "%s: %s", instanceID, mismatch)
+	}
+	t.Logf("✓ Runner %s: %s, %d vCPU, %d MiB, %s, %s, root %d GiB @ %d MiB/s, AMI %s",
+		instanceID, facts.InstanceType, facts.VCPUs, facts.MemoryMiB, facts.Lifecycle, facts.Architecture,
+		facts.RootVolumeSize, facts.RootVolumeThroughput, facts.ImageName)
+	return facts
+}
+
+// RunRunnerLabelMatrix replays a synthetic job for each label case (see RunWebhookReplay) and
+// validates the runner instance launched for it. Cases run one at a time so each launched
+// instance can be attributed to its labels; instances are terminated when the test ends.
+// The jobs go to the stack's own app (see stackWebhookTarget), which skips the test without one.
+func RunRunnerLabelMatrix(t *testing.T, stackName, appRunnerURL, configBucket, serviceARN string) {
+	cases, err := RunnerLabelMatrix(GetAppRunnerEnvironment(t, serviceARN))
+	require.NoError(t, err, "Failed to build runner label matrix")
+
+	ValidateAppRunnerHealth(t, appRunnerURL, 20)
+	webhookURL, secret := stackWebhookTarget(t, appRunnerURL, configBucket)
+
+	installationID, err := strconv.ParseInt(GetOptionalEnv("RUNS_ON_TEST_APP_INSTALLATION_ID", "0"), 10, 64)
+	require.NoError(t, err, "Invalid RUNS_ON_TEST_APP_INSTALLATION_ID")
+	repo := GetOptionalEnv("RUNS_ON_TEST_REPO", "test-org/test-repo")
+
+	for _, tc := range cases {
+		t.Run(tc.Name, func(t *testing.T) {
+			job := NewSyntheticWorkflowJob(repo, installationID, tc.Spec)
+			startTime := time.Now()
+			t.Logf("Requesting runner with labels %s", job.Labels[0])
+
+			ReplayWorkflowJob(t, webhookURL, secret, job, 0, WorkflowJobQueued)
+
+			instanceID := FindRunnerInstance(t, stackName, startTime, 5*time.Minute)
+			require.NotEmpty(t, instanceID, "No runner launched for %s", job.Labels[0])
+			t.Cleanup(func() { TerminateTestInstance(t, instanceID) })
+
+			ValidateRunnerInstance(t, instanceID, tc.Expect)
+			ReplayWorkflowJob(t, webhookURL, secret, job, 0, WorkflowJobInProgress, WorkflowJobCompleted)
+		})
+	}
+}
+
+// =============================================================================
+// RUNNER LIFECYCLE VALIDATORS
+// =============================================================================
+
+// RunnerTerminationBound is how long a runner may take to terminate once its job completed:
+// the bootstrap shuts down right after the job (--post-exec shutdown) and the _the_end trap
+// shuts down at the latest 3 minutes after the bootstrap exits.
+const RunnerTerminationBound = 6 * time.Minute
+
+// Termination kinds, classified from the EC2 state reason code
+const (
+	TerminationSelf  = "self"  // Client.InstanceInitiatedShutdown: the runner shut itself down
+	TerminationUser  = "user"  // Client.UserInitiatedShutdown: terminated through the EC2 API
+	TerminationSpot  = "spot"  // Server.SpotInstance*: reclaimed by EC2
+	TerminationOther = "other" // Anything else (e.g. Server.InternalError)
+)
+
+var stateTransitionTimePattern = regexp.MustCompile(`\((\d{4}-\d{2}-\d{2} \d{2}:\d{2}:\d{2}) GMT\)`)
+
+// RunnerTermination describes how and when a runner instance terminated.
+type RunnerTermination struct {
+	InstanceID   string
+	Kind         string
+	StateReason  string
+	LaunchTime   time.Time
+	TerminatedAt time.Time
+}
+
+// classifyTermination maps an EC2 state reason code to a termination kind.
+func classifyTermination(stateReasonCode string) string {
+	switch {
+	case stateReasonCode == "Client.InstanceInitiatedShutdown":
+		return TerminationSelf
+	case stateReasonCode == "Client.UserInitiatedShutdown":
+		return TerminationUser
+	case strings.HasPrefix(stateReasonCode, "Server.SpotInstance"):
+		return TerminationSpot
+	default:
+		return TerminationOther
+	}
+}
+
+// parseStateTransitionTime extracts the time from an EC2 state transition reason,
+// e.g. "User initiated (2025-01-02 03:04:05 GMT)".
+func parseStateTransitionTime(reason string) (time.Time, bool) {
+	match := stateTransitionTimePattern.FindStringSubmatch(reason)
+	if match == nil {
+		return time.Time{}, false
+	}
+	parsed, err := time.Parse("2006-01-02 15:04:05", match[1])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return parsed, true
+}
+
+// GetInstanceVolumeIDs returns the IDs of the EBS volumes attached to an instance.
+// Call it while the instance is running: terminated instances no longer list their volumes.
+func GetInstanceVolumeIDs(t *testing.T, instanceID string) []string {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := ec2.NewFromConfig(cfg)
+
+	result, err := client.DescribeVolumes(ctx, &ec2.DescribeVolumesInput{
+		Filters: []ec2types.Filter{
+			{
+				Name:   aws.String("attachment.instance-id"),
+				Values: []string{instanceID},
+			},
+		},
+	})
+	require.NoError(t, err, "Failed to describe volumes of %s", instanceID)
+
+	var volumeIDs []string
+	for _, volume := range result.Volumes {
+		volumeIDs = append(volumeIDs, aws.ToString(volume.VolumeId))
+	}
+	t.Logf("Instance %s has volumes %v", instanceID, volumeIDs)
+	return volumeIDs
+}
+
+// WaitForRunnerTermination waits for an instance to reach the terminated state.
+// Returns false if it is still alive when the timeout expires.
+func WaitForRunnerTermination(t *testing.T, instanceID string, timeout time.Duration) (RunnerTermination, bool) {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := ec2.NewFromConfig(cfg)
+
+	deadline := time.Now().Add(timeout)
+	for {
+		result, err := client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
+			InstanceIds: []string{instanceID},
+		})
+		if err != nil {
+			t.Logf("Error describing instance %s: %v", instanceID, err)
+		} else if len(result.Reservations) > 0 && len(result.Reservations[0].Instances) > 0 {
+			instance := result.Reservations[0].Instances[0]
+			if instance.State != nil && instance.State.Name == ec2types.InstanceStateNameTerminated {
+				termination := RunnerTermination{
+					InstanceID:   instanceID,
+					LaunchTime:   aws.ToTime(instance.LaunchTime),
+					TerminatedAt: time.Now(),
+				}
+				if instance.StateReason != nil {
+					termination.StateReason = aws.ToString(instance.StateReason.Code)
+				}
+				termination.Kind = classifyTermination(termination.StateReason)
+				if at, ok := parseStateTransitionTime(aws.ToString(instance.StateTransitionReason)); ok {
+					termination.TerminatedAt = at
+				}
+				return termination, true
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return RunnerTermination{InstanceID: instanceID}, false
+		}
+		sleepUntilRetry(15*time.Second, deadline)
+	}
+}
+
+// ValidateVolumesDeleted verifies the given EBS volumes are deleted (or being deleted).
+func ValidateVolumesDeleted(t *testing.T, volumeIDs []string, timeout time.Duration) {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := ec2.NewFromConfig(cfg)
+
+	deadline := time.Now().Add(timeout)
+	allDeleted := true
+	for _, volumeID := range volumeIDs {
+		for {
+			result, err := client.DescribeVolumes(ctx, &ec2.DescribeVolumesInput{
+				VolumeIds: []string{volumeID},
+			})
+			if err != nil && strings.Contains(err.Error(), "InvalidVolume.NotFound") {
+				break
+			}
+			if err == nil && (len(result.Volumes) == 0 ||
+				result.Volumes[0].State == ec2types.VolumeStateDeleted ||
+				result.Volumes[0].State == ec2types.VolumeStateDeleting) {
+				break
+			}
+			if time.Now().After(deadline) {
+				assert.Fail(t, "Volume not deleted", "Volume %s should be deleted with its runner", volumeID)
+				allDeleted = false
+				break
+			}
+			sleepUntilRetry(10*time.Second, deadline)
+		}
+	}
+	if allDeleted {
+		t.Logf("✓ Runner volumes deleted: %v", volumeIDs)
+	}
+}
+
+// ValidateRunnerSelfTerminated verifies a runner shut itself down (instance-initiated shutdown,
+// terminate behaviour) within bound of its job completing, and that its volumes were deleted.
+func ValidateRunnerSelfTerminated(t *testing.T, instanceID string, volumeIDs []string, jobCompletedAt time.Time, bound time.Duration) RunnerTermination {
+	termination, ok := WaitForRunnerTermination(t, instanceID, time.Until(jobCompletedAt.Add(bound))+time.Minute)
+	require.True(t, ok, "Runner %s should terminate within %s of its job completing", instanceID, bound)
+
+	selfShutdown := assert.Equal(t, TerminationSelf, termination.Kind,
+		"Runner %s should shut itself down (state reason %s)", instanceID, termination.StateReason)
+	withinBound := assert.WithinDuration(t, jobCompletedAt, termination.TerminatedAt, bound,
+		"Runner %s terminated at %s, job completed at %s", instanceID, termination.TerminatedAt, jobCompletedAt)
+	if selfShutdown && withinBound {
+		t.Logf("✓ Runner %s terminated (%s) %s after its job completed",
+			instanceID, termination.StateReason, termination.TerminatedAt.Sub(jobCompletedAt).Round(time.Second))
+	}
+
+	ValidateVolumesDeleted(t, volumeIDs, 5*time.Minute)
+	return termination
+}
+
+// ValidateLaunchTemplateUserData verifies the launch template's user data contains each of the
+// expected fragments (e.g. the max runtime export and the shutdown hooks).
+func ValidateLaunchTemplateUserData(t *testing.T, launchTemplateID string, expected []string) {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := ec2.NewFromConfig(cfg)
+
+	templateID, version := parseLaunchTemplateID(launchTemplateID)
+	result, err := client.DescribeLaunchTemplateVersions(ctx, &ec2.DescribeLaunchTemplateVersionsInput{
+		LaunchTemplateId: aws.String(templateID),
+		Versions:         []string{version},
+	})
+	require.NoError(t, err, "Failed to describe launch template %s", templateID)
+	require.NotEmpty(t, result.LaunchTemplateVersions, "Launch template %s has no version %s", templateID, version)
+
+	data := result.LaunchTemplateVersions[0].LaunchTemplateData
+	require.NotNil(t, data, "Launch template %s has no data", templateID)
+	userData, err := base64.StdEncoding.DecodeString(aws.ToString(data.UserData))
+	require.NoError(t, err, "Launch template %s user data is not base64", templateID)
+
+	for _, fragment := range expected {
+		assert.Contains(t, string(userData), fragment, "Launch template %s user data", templateID)
+	}
+	t.Logf("✓ Launch template %s user data contains %d expected fragment(s)", templateID, len(expected))
+}
+
+// RunRunnerMaxRuntime dispatches RUNS_ON_TEST_LONG_WORKFLOW, a workflow whose job outlives
+// maxRuntime, and verifies the runner is cut off: it terminates within maxRuntime (plus boot and
+// shutdown grace) of its launch, its volumes are deleted and the run does not succeed.
+// Skips unless the automated-mode environment and RUNS_ON_TEST_LONG_WORKFLOW are set.
+func RunRunnerMaxRuntime(t *testing.T, stackName, appRunnerURL, configBucket string, maxRuntime time.Duration) {
+	if os.Getenv("GITHUB_TOKEN") == "" {
+		t.Skip("GITHUB_TOKEN not set")
+	}
+	testRepo := GetOptionalEnv("RUNS_ON_TEST_REPO", os.Getenv("GITHUB_REPOSITORY"))
+	if testRepo == "" {
+		t.Skip("RUNS_ON_TEST_REPO or GITHUB_REPOSITORY not set")
+	}
+	longWorkflow := os.Getenv("RUNS_ON_TEST_LONG_WORKFLOW")
+	if longWorkflow == "" {
+		t.Skip("RUNS_ON_TEST_LONG_WORKFLOW not set")
+	}
+
+	opts := GitHubOptions{}
+	testID := fmt.Sprintf("%s-%s", stackName, GetTestID())
+	startTime := time.Now()
+	// Boot, bootstrap download and the _the_end trap delay on top of the max runtime
+	grace := 10 * time.Minute
+
+	ValidateAppRunnerHealth(t, appRunnerURL, 20)
+	// Held until the run is observed, the shared app's webhook must keep pointing at this stack
+	LockSharedGitHubApp(t)
+	require.NoError(t, RegisterGitHubApp(t, opts, appRunnerURL, configBucket), "Failed to register GitHub App")
+	require.NoError(t, DispatchWorkflow(t, opts, testRepo, longWorkflow, GetOptionalEnv("RUNS_ON_TEST_REF", "main"), testID))
+
+	runID, err := WatchForWorkflowRunWithOptions(t, opts, testRepo, longWorkflow, testID, startTime, 2*time.Minute)
+	require.NoError(t, err, "Workflow run not found")
+
+	instanceID := FindRunnerInstance(t, stackName, startTime, 5*time.Minute)
+	require.NotEmpty(t, instanceID, "Runner instance should have been launched")
+	volumeIDs := GetInstanceVolumeIDs(t, instanceID)
+
+	termination, ok := WaitForRunnerTermination(t, instanceID, maxRuntime+grace)
+	require.True(t, ok, "Runner %s should be cut off after the %s max runtime", instanceID, maxRuntime)
+	runtime := termination.TerminatedAt.Sub(termination.LaunchTime)
+	assert.LessOrEqual(t, runtime, maxRuntime+grace, "Runner %s ran for %s", instanceID, runtime)
+	t.Logf("✓ Runner %s terminated (%s) after %s (max runtime %s)",
+		instanceID, termination.StateReason, runtime.Round(time.Second), maxRuntime)
+
+	ValidateVolumesDeleted(t, volumeIDs, 5*time.Minute)
+
+	conclusion := WaitForWorkflowCompletionWithOptions(t, opts, testRepo, runID, 15*time.Minute)
+	assert.NotEqual(t, "success", conclusion, "Long job should not succeed once its runner is cut off")
+}
@@ -0,0 +1,122 @@
+package test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunnerInstanceFactsMismatches(t *testing.T) {
+	facts := RunnerInstanceFacts{
+		InstanceID:           "i-0123456789abcdef0",
+		InstanceType:         "m7g.large",
+		VCPUs:                2,
+		MemoryMiB:            8192,
+		Lifecycle:            "spot",
+		Architecture:         "arm64",
+		RootVolumeSize:       80,
+		RootVolumeThroughput: 750,
+		ImageID:              "ami-0123",
+		ImageName:            "runs-on-v2.8-ubuntu24-full-arm64-20250101",
+	}
+
+	tests := []struct {
+		name     string
+		expect   RunnerExpectation
+		mismatch string // Expected substring of the single mismatch, "" for a match
+	}{
+		{"Empty", RunnerExpectation{}, ""},
+		{"AllMatch", RunnerExpectation{
+			VCPUs: 2, MinMemoryGiB: 8, FamilyPrefix: "m7g", Lifecycle: "spot", Architecture: "arm64",
+			RootVolumeSize: 80, RootVolumeThroughput: 750, ImageName: "ubuntu24-full-arm64",
+		}, ""},
+		{"VCPUs", RunnerExpectation{VCPUs: 4}, "vCPUs"},
+		{"Memory", RunnerExpectation{MinMemoryGiB: 16}, "memory"},
+		{"Family", RunnerExpectation{FamilyPrefix: "m7a"}, "family m7a"},
+		{"Lifecycle", RunnerExpectation{Lifecycle: "on-demand"}, "lifecycle"},
+		{"Architecture", RunnerExpectation{Architecture: "x86_64"}, "architecture"},
+		{"RootVolumeSize", RunnerExpectation{RootVolumeSize: 40}, "root volume size"},
+		{"RootVolumeThroughput", RunnerExpectation{RootVolumeThroughput: 400}, "root volume throughput"},
+		{"Image", RunnerExpectation{ImageName: "ubuntu22-full-x64"}, "AMI"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mismatches := facts.Mismatches(tc.expect)
+			if tc.mismatch == "" {
+				assert.Empty(t, mismatches)
+				return
+			}
+			require.Len(t, mismatches, 1)
+			assert.Contains(t, mismatches[0], tc.mismatch)
+		})
+	}
+}
+
+func TestRunnerLabelMatrix(t *testing.T) {
+	env := map[string]string{
+		"RUNS_ON_RUNNER_DEFAULT_DISK_SIZE":         "40",
+		"RUNS_ON_RUNNER_DEFAULT_VOLUME_THROUGHPUT": "400",
+		"RUNS_ON_RUNNER_LARGE_DISK_SIZE":           "80",
+		"RUNS_ON_RUNNER_LARGE_VOLUME_THROUGHPUT":   "750",
+	}
+
+	cases, err := RunnerLabelMatrix(env)
+	require.NoError(t, err)
+
+	byName := map[string]RunnerLabelCase{}
+	for _, tc := range cases {
+		assert.NotContains(t, byName, tc.Name, "Case names should be unique")
+		byName[tc.Name] = tc
+	}
+
+	for _, name := range []string{"Default", "CPU", "RAM", "Family", "Spot", "OnDemand", "LargeDisk", "ImageArm64"} {
+		require.Contains(t, byName, name)
+	}
+	assert.Equal(t, int32(80), byName["LargeDisk"].Expect.RootVolumeSize)
+	assert.Equal(t, int32(750), byName["LargeDisk"].Expect.RootVolumeThroughput)
+	assert.Equal(t, int32(40), byName["CPU"].Expect.RootVolumeSize)
+	assert.Equal(t, int32(400), byName["CPU"].Expect.RootVolumeThroughput)
+	assert.Equal(t, "spot", byName["Spot"].Expect.Lifecycle)
+	assert.Contains(t, byName["Spot"].Spec, "spot=true")
+	assert.Equal(t, "on-demand", byName["OnDemand"].Expect.Lifecycle)
+	assert.Contains(t, byName["OnDemand"].Spec, "spot=false")
+	assert.Equal(t, "arm64", byName["ImageArm64"].Expect.Architecture)
+	assert.Contains(t, byName["ImageArm64"].Spec, "image=ubuntu24-full-arm64")
+
+	delete(env, "RUNS_ON_RUNNER_LARGE_DISK_SIZE")
+	_, err = RunnerLabelMatrix(env)
+	assert.ErrorContains(t, err, "RUNS_ON_RUNNER_LARGE_DISK_SIZE")
+}
+
+func TestClassifyTermination(t *testing.T) {
+	tests := map[string]string{
+		"Client.InstanceInitiatedShutdown": TerminationSelf,
+		"Client.UserInitiatedShutdown":     TerminationUser,
+		"Server.SpotInstanceTermination":   TerminationSpot,
+		"Server.SpotInstanceShutdown":      TerminationSpot,
+		"Server.InternalError":             TerminationOther,
+		"Client.VolumeLimitExceeded":       TerminationOther,
+		"":                                 TerminationOther,
+	}
+	for code, expected := range tests {
+		assert.Equal(t, expected, classifyTermination(code), code)
+	}
+}
+
+func TestParseStateTransitionTime(t *testing.T) {
+	at, ok := parseStateTransitionTime("User initiated (2025-01-02 03:04:05 GMT)")
+	require.True(t, ok)
+	assert.Equal(t, time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), at)
+
+	at, ok = parseStateTransitionTime("Service initiated (2025-12-31 23:59:59 GMT)")
+	require.True(t, ok)
+	assert.Equal(t, time.Date(2025, 12, 31, 23, 59, 59, 0, time.UTC), at)
+
+	_, ok = parseStateTransitionTime("")
+	assert.False(t, ok)
+	_, ok = parseStateTransitionTime("User initiated")
+	assert.False(t, ok)
+}
@@ -0,0 +1,364 @@
+package test
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/lambda"
+	lambdatypes "github.com/aws/aws-sdk-go-v2/service/lambda/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// =============================================================================
+// SLACK WEBHOOK LAMBDA
+// =============================================================================
+
+// slackIconURL is the icon every Slack message of the webhook Lambda carries.
+const slackIconURL = "https://runs-on.com/logo.png"
+
+// SlackWebhookFunctionName returns the name of the Lambda deployed when alert_slack_webhook_url is set.
+func SlackWebhookFunctionName(stackName string) string {
+	return stackName + "-slack-webhook"
+}
+
+// SlackWebhookSource extracts the inline Python source of the Slack webhook Lambda from
+// modules/core/sns.tf, so it can be run locally against a webhook stand-in.
+func SlackWebhookSource(snsFile string) (string, error) {
+	data, err := os.ReadFile(snsFile)
+	if err != nil {
+		return "", err
+	}
+	_, rest, found := strings.Cut(string(data), "content  = <<-EOF\n")
+	if !found {
+		return "", fmt.Errorf("no inline Lambda source in %s", snsFile)
+	}
+	source, _, found := strings.Cut(rest, "\nEOF\n")
+	if !found {
+		return "", fmt.Errorf("unterminated inline Lambda source in %s", snsFile)
+	}
+	return source + "\n", nil
+}
+
+// SlackPayload is the incoming webhook message the Lambda posts.
+type SlackPayload struct {
+	Username    string            `json:"username"`
+	IconURL     string            `json:"icon_url"`
+	Attachments []SlackAttachment `json:"attachments"`
+}
+
+// SlackAttachment is the single attachment of a SlackPayload.
+type SlackAttachment struct {
+	Color  string `json:"color"`
+	Title  string `json:"title"`
+	Text   string `json:"text"`
+	Footer string `json:"footer"`
+	TS     int64  `json:"ts"`
+}
+
+// SlackCase is an SNS message delivered to the Lambda and the attachment it should become.
+// Footer and TS are checked against the stack name and the time of delivery instead.
+type SlackCase struct {
+	Name     string
+	Marker   string // Unique text of the message, found in the attachment
+	Message  SNSMessage
+	Expected SlackAttachment
+}
+
+// SlackCases returns the contract of the Lambda: CloudWatch alarm and OK notifications, JSON
+// messages and plain text. Each case marks its message with marker and the case name, so its
+// payload can be told apart.
+func SlackCases(topicARN, marker string) []SlackCase {
+	notification := func(subject, message string) SNSMessage {
+		return SNSMessage{
+			Type:      "Notification",
+			MessageID: fmt.Sprintf("%s-%d", marker, time.Now().UnixNano()),
+			TopicArn:  topicARN,
+			Subject:   subject,
+			Message:   message,
+			Timestamp: time.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
+		}
+	}
+	alarm := func(state, reason string) string {
+		body, _ := json.Marshal(map[string]interface{}{
+			"AlarmName":      "terratest-alarm",
+			"NewStateValue":  state,
+			"OldStateValue":  "INSUFFICIENT_DATA",
+			"NewStateReason": reason,
+		})
+		return string(body)
+	}
+
+	return []SlackCase{
+		{
+			Name:    "Alarm",
+			Marker:  marker + "-alarm",
+			Message: notification(`ALARM: "terratest-alarm" in US East (N. Virginia)`, alarm("ALARM", marker+"-alarm")),
+			Expected: SlackAttachment{
+				Color: "danger",
+				Title: ":rotating_light: CloudWatch Alarm: ALARM",
+				Text:  "*Alarm:* terratest-alarm\n*Reason:* " + marker + "-alarm",
+			},
+		},
+		{
+			Name:    "OK",
+			Marker:  marker + "-ok",
+			Message: notification(`OK: "terratest-alarm" in US East (N. Virginia)`, alarm("OK", marker+"-ok")),
+			Expected: SlackAttachment{
+				Color: "good",
+				Title: ":white_check_mark: CloudWatch Alarm: OK",
+				Text:  "*Alarm:* terratest-alarm\n*Reason:* " + marker + "-ok",
+			},
+		},
+		{
+			Name:     "PlainText",
+			Marker:   marker + "-plain",
+			Message:  notification("Runner failed to start", marker+"-plain"),
+			Expected: SlackAttachment{Color: "danger", Title: "Runner failed to start", Text: marker + "-plain"},
+		},
+		{
+			Name:     "PlainTextWithoutSubject",
+			Marker:   marker + "-nosubject",
+			Message:  notification("", marker+"-nosubject"),
+			Expected: SlackAttachment{Color: "#439FE0", Title: "Alert", Text: marker + "-nosubject"},
+		},
+		{
+			Name:    "JSON",
+			Marker:  marker + "-json",
+			Message: notification("Runner warning", `{"marker": "`+marker+`-json"}`),
+			Expected: SlackAttachment{
+				Color: "warning",
+				Title: "Runner warning",
+				Text:  "```\n{\n  \"marker\": \"" + marker + "-json\"\n}\n```",
+			},
+		},
+		{
+			// A JSON array naming AlarmName is not an alarm, it used to crash the handler
+			Name:    "JSONArray",
+			Marker:  marker + "-array",
+			Message: notification("", `["AlarmName", "`+marker+`-array"]`),
+			Expected: SlackAttachment{
+				Color: "#439FE0",
+				Title: "JSON Message",
+				Text:  "```\n[\n  \"AlarmName\",\n  \"" + marker + "-array\"\n]\n```",
+			},
+		},
+	}
+}
+
+// MalformedSlackEvents returns Lambda events with missing or mistyped SNS fields. The handler must
+// process each without raising.
+func MalformedSlackEvents() map[string]string {
+	return map[string]string{
+		"Empty":              `{}`,
+		"RecordsNotAList":    `{"Records": "not a list"}`,
+		"RecordNotAnObject":  `{"Records": [null, "text", 42]}`,
+		"SnsNotAnObject":     `{"Records": [{"EventSource": "aws:sns", "Sns": "text"}]}`,
+		"NullFields":         `{"Records": [{"EventSource": "aws:sns", "Sns": {"Subject": null, "Message": null}}]}`,
+		"NonStringFields":    `{"Records": [{"EventSource": "aws:sns", "Sns": {"Subject": 42, "Message": {"AlarmName": "x"}}}]}`,
+		"AlarmWithOddState":  `{"Records": [{"EventSource": "aws:sns", "Sns": {"Message": "{\"AlarmName\": \"x\", \"NewStateValue\": 5}"}}]}`,
+		"EventNotAnObject":   `["Records"]`,
+		"TruncatedAlarmJSON": `{"Records": [{"EventSource": "aws:sns", "Sns": {"Message": "{\"AlarmName\": "}}]}`,
+	}
+}
+
+// SNSLambdaEvent wraps SNS messages into the event SNS invokes a Lambda subscriber with.
+func SNSLambdaEvent(messages ...SNSMessage) ([]byte, error) {
+	type record struct {
+		EventSource          string     `json:"EventSource"`
+		EventVersion         string     `json:"EventVersion"`
+		EventSubscriptionArn string     `json:"EventSubscriptionArn"`
+		Sns                  SNSMessage `json:"Sns"`
+	}
+	var event struct {
+		Records []record `json:"Records"`
+	}
+	for _, message := range messages {
+		event.Records = append(event.Records, record{
+			EventSource:          "aws:sns",
+			EventVersion:         "1.0",
+			EventSubscriptionArn: message.TopicArn + ":terratest",
+			Sns:                  message,
+		})
+	}
+	return json.Marshal(event)
+}
+
+// CompareSlackPayload returns the differences between a payload and the attachment expected
+// for a case, empty when the payload matches. sentAfter bounds the attachment timestamp.
+func CompareSlackPayload(expected SlackAttachment, stackName string, sentAfter time.Time, payload SlackPayload) []string {
+	var diffs []string
+	if payload.Username != stackName {
+		diffs = append(diffs, fmt.Sprintf("username: expected %s, got %s", stackName, payload.Username))
+	}
+	if payload.IconURL != slackIconURL {
+		diffs = append(diffs, fmt.Sprintf("icon_url: expected %s, got %s", slackIconURL, payload.IconURL))
+	}
+	if len(payload.Attachments) != 1 {
+		return append(diffs, fmt.Sprintf("attachments: expected 1, got %d", len(payload.Attachments)))
+	}
+
+	attachment := payload.Attachments[0]
+	if attachment.Color != expected.Color {
+		diffs = append(diffs, fmt.Sprintf("color: expected %s, got %s", expected.Color, attachment.Color))
+	}
+	if attachment.Title != expected.Title {
+		diffs = append(diffs, fmt.Sprintf("title: expected %q, got %q", expected.Title, attachment.Title))
+	}
+	if attachment.Text != expected.Text {
+		diffs = append(diffs, fmt.Sprintf("text: expected %q, got %q", expected.Text, attachment.Text))
+	}
+	if attachment.Footer != stackName {
+		diffs = append(diffs, fmt.Sprintf("footer: expected %s, got %s", stackName, attachment.Footer))
+	}
+	// ts is whole seconds, allow for the truncation and clock skew
+	if attachment.TS < sentAfter.Add(-time.Minute).Unix() || attachment.TS > time.Now().Add(time.Minute).Unix() {
+		diffs = append(diffs, fmt.Sprintf("ts: %d is not the time of delivery", attachment.TS))
+	}
+	return diffs
+}
+
+// SlackWebhook stands in for a Slack incoming webhook and records the payloads posted to it.
+type SlackWebhook struct {
+	mu       sync.Mutex
+	payloads []SlackPayload
+	invalid  []string
+}
+
+// NewSlackWebhook returns an empty Slack webhook stand-in.
+func NewSlackWebhook() *SlackWebhook {
+	return &SlackWebhook{}
+}
+
+func (s *SlackWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var payload SlackPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		s.mu.Lock()
+		s.invalid = append(s.invalid, err.Error())
+		s.mu.Unlock()
+		// Slack answers malformed payloads the same way
+		http.Error(w, "invalid_payload", http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	s.payloads = append(s.payloads, payload)
+	s.mu.Unlock()
+	fmt.Fprint(w, "ok")
+}
+
+// Payloads returns the payloads received so far.
+func (s *SlackWebhook) Payloads() []SlackPayload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SlackPayload(nil), s.payloads...)
+}
+
+// Invalid returns why each payload that is not a Slack message was refused.
+func (s *SlackWebhook) Invalid() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.invalid...)
+}
+
+// findPayload returns the payload whose attachment mentions marker.
+func (s *SlackWebhook) findPayload(marker string) (SlackPayload, bool) {
+	for _, payload := range s.Payloads() {
+		for _, attachment := range payload.Attachments {
+			if strings.Contains(attachment.Title, marker) || strings.Contains(attachment.Text, marker) {
+				return payload, true
+			}
+		}
+	}
+	return SlackPayload{}, false
+}
+
+// WaitForPayload waits until a payload whose attachment mentions marker arrives, and returns it.
+func (s *SlackWebhook) WaitForPayload(t *testing.T, marker string, timeout time.Duration) SlackPayload {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if payload, ok := s.findPayload(marker); ok {
+			return payload
+		}
+		time.Sleep(time.Second)
+	}
+	require.FailNow(t, "Slack payload not delivered", "No payload mentioning %s within %s (invalid: %v)", marker, timeout, s.Invalid())
+	return SlackPayload{}
+}
+
+// =============================================================================
+// VALIDATORS
+// =============================================================================
+
+// invokeSlackWebhook invokes the Lambda synchronously with event and fails the test if the
+// handler raised, showing the tail of its log.
+func invokeSlackWebhook(t *testing.T, client *lambda.Client, functionName string, event []byte) {
+	output, err := client.Invoke(context.Background(), &lambda.InvokeInput{
+		FunctionName: aws.String(functionName),
+		Payload:      event,
+		LogType:      lambdatypes.LogTypeTail,
+	})
+	require.NoError(t, err, "Failed to invoke %s", functionName)
+
+	if output.FunctionError != nil {
+		logs, _ := base64.StdEncoding.DecodeString(aws.ToString(output.LogResult))
+		require.FailNow(t, "Slack webhook Lambda raised", "%s: %s\n%s", aws.ToString(output.FunctionError), output.Payload, logs)
+	}
+	var response struct {
+		StatusCode int `json:"statusCode"`
+	}
+	require.NoError(t, json.Unmarshal(output.Payload, &response), "Unexpected response %s", output.Payload)
+	assert.Equal(t, http.StatusOK, response.StatusCode, "Handler should report the records processed")
+}
+
+// ValidateSlackWebhookLambda invokes the deployed Slack webhook Lambda with crafted SNS events and
+// checks the payloads the webhook stand-in at webhookURL receives, then checks that malformed
+// events do not make the handler raise.
+func ValidateSlackWebhookLambda(t *testing.T, inputs AlarmInputs, webhookURL string, webhook *SlackWebhook) {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := lambda.NewFromConfig(cfg)
+	functionName := SlackWebhookFunctionName(inputs.StackName)
+
+	function, err := client.GetFunctionConfiguration(ctx, &lambda.GetFunctionConfigurationInput{FunctionName: aws.String(functionName)})
+	require.NoError(t, err, "Slack webhook Lambda %s should exist", functionName)
+	require.NotNil(t, function.Environment, "Slack webhook Lambda should have environment variables")
+	assert.Equal(t, inputs.StackName, function.Environment.Variables["STACK_NAME"], "STACK_NAME should be the stack name")
+	assert.Equal(t, webhookURL, function.Environment.Variables["SLACK_WEBHOOK_URL"], "SLACK_WEBHOOK_URL should be alert_slack_webhook_url")
+
+	marker := fmt.Sprintf("terratest-slack-%d", time.Now().UnixNano())
+	for _, tc := range SlackCases(inputs.TopicARN, marker) {
+		t.Run(tc.Name, func(t *testing.T) {
+			sentAfter := time.Now()
+			event, err := SNSLambdaEvent(tc.Message)
+			require.NoError(t, err)
+			invokeSlackWebhook(t, client, functionName, event)
+
+			payload := webhook.WaitForPayload(t, tc.Marker, 30*time.Second)
+			assert.Empty(t, CompareSlackPayload(tc.Expected, inputs.StackName, sentAfter, payload), "Payload of %s", tc.Name)
+			t.Logf("✓ %s message posted as %q", tc.Name, payload.Attachments[0].Title)
+		})
+	}
+
+	malformed := MalformedSlackEvents()
+	for _, name := range slices.Sorted(maps.Keys(malformed)) {
+		t.Run("Malformed/"+name, func(t *testing.T) {
+			invokeSlackWebhook(t, client, functionName, []byte(malformed[name]))
+			t.Logf("✓ Handler survived %s", name)
+		})
+	}
+}
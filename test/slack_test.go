@@ -0,0 +1,126 @@
+package test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testSlackStack = "test-slack1"
+
+// runSlackWebhookLocally runs the handler of the Slack webhook Lambda, extracted from
+// modules/core/sns.tf, with python3 against webhookURL. It returns the handler's response, or
+// the traceback if it raised. Skips the test if python3 is not installed.
+func runSlackWebhookLocally(t *testing.T, webhookURL string, event []byte) (map[string]interface{}, error) {
+	python, err := exec.LookPath("python3")
+	if err != nil {
+		t.Skip("Skipping Slack webhook handler: python3 not installed")
+	}
+	source, err := SlackWebhookSource(filepath.Join("..", "modules", "core", "sns.tf"))
+	require.NoError(t, err)
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "index.py"), []byte(source), 0o644))
+
+	cmd := exec.Command(python, "-c", "import json, sys, index; print(json.dumps(index.handler(json.load(sys.stdin), None)))")
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "SLACK_WEBHOOK_URL="+webhookURL, "STACK_NAME="+testSlackStack)
+	cmd.Stdin = bytes.NewReader(event)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w\n%s", err, stderr.String())
+	}
+	var response map[string]interface{}
+	require.NoError(t, json.Unmarshal(out, &response), "Unexpected handler output %s", out)
+	return response, nil
+}
+
+func TestSlackWebhookSource(t *testing.T) {
+	source, err := SlackWebhookSource(filepath.Join("..", "modules", "core", "sns.tf"))
+	require.NoError(t, err)
+	assert.Contains(t, source, "def handler(event, context):")
+	assert.NotContains(t, source, "EOF")
+
+	_, err = SlackWebhookSource(filepath.Join("..", "modules", "core", "main.tf"))
+	assert.ErrorContains(t, err, "no inline Lambda source")
+}
+
+func TestSlackWebhookHandler(t *testing.T) {
+	webhook := NewSlackWebhook()
+	server := httptest.NewServer(webhook)
+	defer server.Close()
+
+	marker := "terratest-slack-1"
+	for _, tc := range SlackCases(testTopicARN, marker) {
+		t.Run(tc.Name, func(t *testing.T) {
+			sentAfter := time.Now()
+			event, err := SNSLambdaEvent(tc.Message)
+			require.NoError(t, err)
+			response, err := runSlackWebhookLocally(t, server.URL, event)
+			require.NoError(t, err)
+			assert.Equal(t, 200.0, response["statusCode"])
+
+			payload, ok := webhook.findPayload(tc.Marker)
+			require.True(t, ok, "No payload for %s", tc.Name)
+			assert.Empty(t, CompareSlackPayload(tc.Expected, testSlackStack, sentAfter, payload))
+		})
+	}
+	assert.Len(t, webhook.Payloads(), len(SlackCases(testTopicARN, marker)))
+	assert.Empty(t, webhook.Invalid())
+}
+
+func TestSlackWebhookHandlerMalformed(t *testing.T) {
+	webhook := NewSlackWebhook()
+	server := httptest.NewServer(webhook)
+	defer server.Close()
+
+	malformed := MalformedSlackEvents()
+	for _, name := range slices.Sorted(maps.Keys(malformed)) {
+		t.Run(name, func(t *testing.T) {
+			response, err := runSlackWebhookLocally(t, server.URL, []byte(malformed[name]))
+			require.NoError(t, err, "Handler raised: %v", err)
+			assert.Equal(t, 200.0, response["statusCode"])
+		})
+	}
+
+	// Records that still carry an SNS message are posted with the stack's username and icon
+	for _, payload := range webhook.Payloads() {
+		assert.Equal(t, testSlackStack, payload.Username)
+		assert.Equal(t, slackIconURL, payload.IconURL)
+	}
+}
+
+func TestCompareSlackPayload(t *testing.T) {
+	expected := SlackAttachment{Color: "good", Title: ":white_check_mark: CloudWatch Alarm: OK", Text: "text"}
+	now := time.Now()
+	payload := SlackPayload{
+		Username:    testSlackStack,
+		IconURL:     slackIconURL,
+		Attachments: []SlackAttachment{{Color: "good", Title: expected.Title, Text: "text", Footer: testSlackStack, TS: now.Unix()}},
+	}
+	assert.Empty(t, CompareSlackPayload(expected, testSlackStack, now, payload))
+
+	payload.Username = "RunsOn"
+	payload.Attachments[0].Color = "danger"
+	payload.Attachments[0].TS = now.Add(-time.Hour).Unix()
+	assert.Equal(t, []string{
+		"username: expected test-slack1, got RunsOn",
+		"color: expected good, got danger",
+		fmt.Sprintf("ts: %d is not the time of delivery", payload.Attachments[0].TS),
+	}, CompareSlackPayload(expected, testSlackStack, now, payload))
+
+	payload.Attachments = nil
+	assert.Contains(t, CompareSlackPayload(expected, testSlackStack, now, payload), "attachments: expected 1, got 0")
+}
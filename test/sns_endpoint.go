@@ -0,0 +1,464 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	cloudwatchtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// =============================================================================
+// SNS HTTPS ENDPOINT
+// =============================================================================
+
+// snsHostPattern matches the hosts SNS signing certificates and subscribe URLs are served from.
+var snsHostPattern = regexp.MustCompile(`^sns\.[a-z0-9-]+\.amazonaws\.com(\.cn)?$`)
+
+// ValidateSNSURL checks that a SigningCertURL or SubscribeURL points to SNS over HTTPS, so a forged
+// message cannot make the endpoint trust another certificate or call another host.
+func ValidateSNSURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid URL %q: %w", raw, err)
+	}
+	if parsed.Scheme != "https" {
+		return fmt.Errorf("URL %q is not HTTPS", raw)
+	}
+	if !snsHostPattern.MatchString(parsed.Hostname()) {
+		return fmt.Errorf("URL %q is not served by SNS", raw)
+	}
+	return nil
+}
+
+// SNSStringToSign builds the canonical string SNS signs for a message: selected fields as
+// "Name\nValue\n" pairs in byte order. Subject is only part of notifications that have one.
+func SNSStringToSign(message SNSMessage) (string, error) {
+	var fields [][2]string
+	switch message.Type {
+	case "Notification":
+		fields = append(fields, [2]string{"Message", message.Message}, [2]string{"MessageId", message.MessageID})
+		if message.Subject != "" {
+			fields = append(fields, [2]string{"Subject", message.Subject})
+		}
+		fields = append(fields, [2]string{"Timestamp", message.Timestamp}, [2]string{"TopicArn", message.TopicArn},
+			[2]string{"Type", message.Type})
+	case "SubscriptionConfirmation", "UnsubscribeConfirmation":
+		fields = [][2]string{
+			{"Message", message.Message},
+			{"MessageId", message.MessageID},
+			{"SubscribeURL", message.SubscribeURL},
+			{"Timestamp", message.Timestamp},
+			{"Token", message.Token},
+			{"TopicArn", message.TopicArn},
+			{"Type", message.Type},
+		}
+	default:
+		return "", fmt.Errorf("unknown SNS message type %q", message.Type)
+	}
+
+	var builder strings.Builder
+	for _, field := range fields {
+		builder.WriteString(field[0] + "\n" + field[1] + "\n")
+	}
+	return builder.String(), nil
+}
+
+// VerifySNSSignature checks the signature of a message against the SNS signing certificate.
+// SignatureVersion 1 is SHA1withRSA, version 2 is SHA256withRSA.
+func VerifySNSSignature(message SNSMessage, cert *x509.Certificate) error {
+	publicKey, ok := cert.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return fmt.Errorf("signing certificate does not hold an RSA key")
+	}
+	signature, err := base64.StdEncoding.DecodeString(message.Signature)
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	stringToSign, err := SNSStringToSign(message)
+	if err != nil {
+		return err
+	}
+
+	var hash crypto.Hash
+	var digest []byte
+	switch message.SignatureVersion {
+	case "1":
+		sum := sha1.Sum([]byte(stringToSign))
+		hash, digest = crypto.SHA1, sum[:]
+	case "2":
+		sum := sha256.Sum256([]byte(stringToSign))
+		hash, digest = crypto.SHA256, sum[:]
+	default:
+		return fmt.Errorf("unsupported SignatureVersion %q", message.SignatureVersion)
+	}
+	if err := rsa.VerifyPKCS1v15(publicKey, hash, digest, signature); err != nil {
+		return fmt.Errorf("signature of message %s does not verify: %w", message.MessageID, err)
+	}
+	return nil
+}
+
+// SNSEndpoint stands in for the service behind alert_https_endpoint. It confirms subscriptions,
+// verifies the signature of every message and records the notifications it accepts. It is an
+// http.Handler, served by httptest in unit tests and through a tunnel in live runs.
+type SNSEndpoint struct {
+	// Client fetches signing certificates and subscribe URLs
+	Client *http.Client
+	// ValidateURL vets SigningCertURL and SubscribeURL before they are fetched
+	ValidateURL func(string) error
+
+	mu            sync.Mutex
+	certs         map[string]*x509.Certificate
+	confirmed     map[string]string // topic ARN -> subscription ARN
+	notifications []SNSMessage
+	rejected      []string
+}
+
+// NewSNSEndpoint returns an endpoint that only trusts SNS hosts.
+func NewSNSEndpoint() *SNSEndpoint {
+	return &SNSEndpoint{
+		Client:      &http.Client{Timeout: 30 * time.Second},
+		ValidateURL: ValidateSNSURL,
+		certs:       map[string]*x509.Certificate{},
+		confirmed:   map[string]string{},
+	}
+}
+
+func (e *SNSEndpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
+	}
+	if err := e.handle(r.Header.Get("x-amz-sns-message-type"), body); err != nil {
+		e.mu.Lock()
+		e.rejected = append(e.rejected, err.Error())
+		e.mu.Unlock()
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func (e *SNSEndpoint) handle(messageType string, body []byte) error {
+	var message SNSMessage
+	if err := json.Unmarshal(body, &message); err != nil {
+		return fmt.Errorf("failed to parse SNS message: %w", err)
+	}
+	if messageType != "" && messageType != message.Type {
+		return fmt.Errorf("x-amz-sns-message-type %q does not match message type %q", messageType, message.Type)
+	}
+
+	cert, err := e.certificate(message.SigningCertURL)
+	if err != nil {
+		return err
+	}
+	if err := VerifySNSSignature(message, cert); err != nil {
+		return err
+	}
+
+	switch message.Type {
+	case "SubscriptionConfirmation":
+		subscriptionARN, err := e.confirm(message.SubscribeURL)
+		if err != nil {
+			return err
+		}
+		e.mu.Lock()
+		e.confirmed[message.TopicArn] = subscriptionARN
+		e.mu.Unlock()
+	case "Notification":
+		e.mu.Lock()
+		e.notifications = append(e.notifications, message)
+		e.mu.Unlock()
+	}
+	return nil
+}
+
+// certificate fetches and caches the signing certificate at certURL.
+func (e *SNSEndpoint) certificate(certURL string) (*x509.Certificate, error) {
+	e.mu.Lock()
+	cert, ok := e.certs[certURL]
+	e.mu.Unlock()
+	if ok {
+		return cert, nil
+	}
+
+	if err := e.ValidateURL(certURL); err != nil {
+		return nil, fmt.Errorf("untrusted SigningCertURL: %w", err)
+	}
+	resp, err := e.Client.Get(certURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch signing certificate: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch signing certificate: HTTP %d", resp.StatusCode)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("signing certificate at %s is not PEM", certURL)
+	}
+	cert, err = x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing certificate: %w", err)
+	}
+
+	e.mu.Lock()
+	e.certs[certURL] = cert
+	e.mu.Unlock()
+	return cert, nil
+}
+
+// confirm visits the SubscribeURL of a confirmation and returns the confirmed subscription ARN.
+func (e *SNSEndpoint) confirm(subscribeURL string) (string, error) {
+	if err := e.ValidateURL(subscribeURL); err != nil {
+		return "", fmt.Errorf("untrusted SubscribeURL: %w", err)
+	}
+	resp, err := e.Client.Get(subscribeURL)
+	if err != nil {
+		return "", fmt.Errorf("failed to confirm subscription: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to confirm subscription: HTTP %d", resp.StatusCode)
+	}
+
+	var result struct {
+		SubscriptionArn string `xml:"ConfirmSubscriptionResult>SubscriptionArn"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to parse ConfirmSubscription response: %w", err)
+	}
+	return result.SubscriptionArn, nil
+}
+
+// Confirmed returns the subscription ARN confirmed for a topic, or "" if none was.
+func (e *SNSEndpoint) Confirmed(topicARN string) string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.confirmed[topicARN]
+}
+
+// Notifications returns the verified notifications received so far.
+func (e *SNSEndpoint) Notifications() []SNSMessage {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]SNSMessage(nil), e.notifications...)
+}
+
+// Rejected returns why each rejected request was refused.
+func (e *SNSEndpoint) Rejected() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]string(nil), e.rejected...)
+}
+
+// WaitForConfirmation waits until the endpoint has confirmed its subscription to topicARN and
+// returns the subscription ARN.
+func (e *SNSEndpoint) WaitForConfirmation(t *testing.T, topicARN string, timeout time.Duration) string {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		if subscriptionARN := e.Confirmed(topicARN); subscriptionARN != "" {
+			return subscriptionARN
+		}
+		time.Sleep(time.Second)
+	}
+	require.FailNow(t, "Subscription not confirmed", "No SubscriptionConfirmation from %s within %s (rejected: %v)",
+		topicARN, timeout, e.Rejected())
+	return ""
+}
+
+// WaitForAlarmNotification waits until the notification of alarmName entering state with the
+// given reason has been received, and returns it.
+func (e *SNSEndpoint) WaitForAlarmNotification(t *testing.T, alarmName, state, reason string, timeout time.Duration) (SNSMessage, AlarmNotification) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		for _, received := range e.Notifications() {
+			var notification AlarmNotification
+			if err := json.Unmarshal([]byte(received.Message), &notification); err != nil {
+				continue
+			}
+			if notification.AlarmName == alarmName && notification.NewStateValue == state && notification.NewStateReason == reason {
+				return received, notification
+			}
+		}
+		time.Sleep(time.Second)
+	}
+	require.FailNow(t, "Alarm notification not delivered", "No %s notification of %s within %s (rejected: %v)",
+		state, alarmName, timeout, e.Rejected())
+	return SNSMessage{}, AlarmNotification{}
+}
+
+// =============================================================================
+// TUNNEL
+// =============================================================================
+
+var quickTunnelPattern = regexp.MustCompile(`https://[a-z0-9-]+\.trycloudflare\.com`)
+
+// alertTunnelHealthPath answers GET while a tunnel comes up, next to the alert receivers.
+const alertTunnelHealthPath = "/healthz"
+
+// StartAlertTunnel serves the alert receivers (the SNS endpoint, the Slack webhook stand-in) and
+// returns the public HTTPS URL AWS can reach them at, or "" when no tunnel is available.
+// RUNS_ON_TEST_ALERT_ENDPOINT_URL names a tunnel the caller runs to RUNS_ON_TEST_ALERT_ENDPOINT_PORT
+// (default 8080); otherwise a cloudflared quick tunnel is started if cloudflared is installed.
+func StartAlertTunnel(t *testing.T, receivers http.Handler) string {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+alertTunnelHealthPath, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.Handle("/", receivers)
+
+	if publicURL := os.Getenv("RUNS_ON_TEST_ALERT_ENDPOINT_URL"); publicURL != "" {
+		port := GetOptionalEnv("RUNS_ON_TEST_ALERT_ENDPOINT_PORT", "8080")
+		listener, err := net.Listen("tcp", "127.0.0.1:"+port)
+		require.NoError(t, err, "Failed to listen on port %s", port)
+		server := httptest.NewUnstartedServer(mux)
+		server.Listener.Close()
+		server.Listener = listener
+		server.Start()
+		t.Cleanup(server.Close)
+
+		waitForTunnel(t, publicURL)
+		return publicURL
+	}
+
+	cloudflared, err := exec.LookPath("cloudflared")
+	if err != nil {
+		t.Logf("No tunnel for the alert receivers: set RUNS_ON_TEST_ALERT_ENDPOINT_URL or install cloudflared")
+		return ""
+	}
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	cmd := exec.Command(cloudflared, "tunnel", "--no-autoupdate", "--url", server.URL)
+	stderr, err := cmd.StderrPipe()
+	require.NoError(t, err)
+	require.NoError(t, cmd.Start(), "Failed to start cloudflared")
+	t.Cleanup(func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	})
+
+	// cloudflared logs the quick tunnel URL to stderr, keep draining it so it never blocks
+	found := make(chan string, 1)
+	go func() {
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			if match := quickTunnelPattern.FindString(scanner.Text()); match != "" {
+				select {
+				case found <- match:
+				default:
+				}
+			}
+		}
+	}()
+
+	select {
+	case publicURL := <-found:
+		waitForTunnel(t, publicURL)
+		t.Logf("Alert receivers reachable at %s", publicURL)
+		return publicURL
+	case <-time.After(time.Minute):
+		require.FailNow(t, "cloudflared did not report a tunnel URL within 1m")
+		return ""
+	}
+}
+
+// waitForTunnel waits until the receivers answer their health check through publicURL.
+func waitForTunnel(t *testing.T, publicURL string) {
+	client := &http.Client{Timeout: 10 * time.Second}
+	backoff := time.Second
+	deadline := time.Now().Add(2 * time.Minute)
+	for time.Now().Before(deadline) {
+		resp, err := client.Get(publicURL + alertTunnelHealthPath)
+		if err == nil {
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK && strings.TrimSpace(string(body)) == "ok" {
+				return
+			}
+		}
+		time.Sleep(backoff)
+		backoff = min(2*backoff, 10*time.Second)
+	}
+	require.FailNow(t, "Tunnel not reachable", "%s did not reach the alert receivers within 2m", publicURL)
+}
+
+// =============================================================================
+// VALIDATORS
+// =============================================================================
+
+// ValidateSubscriptionConfirmed checks that the endpoint confirmed the alert_https_endpoint
+// subscription and that SNS lists it as confirmed for endpointURL.
+func ValidateSubscriptionConfirmed(t *testing.T, topicARN string, endpoint *SNSEndpoint, endpointURL string) {
+	subscriptionARN := endpoint.WaitForConfirmation(t, topicARN, 3*time.Minute)
+
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := sns.NewFromConfig(cfg)
+
+	var found bool
+	paginator := sns.NewListSubscriptionsByTopicPaginator(client, &sns.ListSubscriptionsByTopicInput{TopicArn: aws.String(topicARN)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		require.NoError(t, err, "Failed to list subscriptions of %s", topicARN)
+		for _, subscription := range page.Subscriptions {
+			if aws.ToString(subscription.Protocol) != "https" || aws.ToString(subscription.Endpoint) != endpointURL {
+				continue
+			}
+			found = true
+			assert.Equal(t, subscriptionARN, aws.ToString(subscription.SubscriptionArn),
+				"SNS should list the subscription the endpoint confirmed")
+		}
+	}
+	require.True(t, found, "No https subscription of %s for %s", topicARN, endpointURL)
+	t.Logf("✓ Subscription %s confirmed by the HTTPS endpoint", subscriptionARN)
+}
+
+// ValidateAlarmDeliveryToEndpoint forces each alarm of the stack into ALARM and checks that the
+// endpoint receives its notification with a valid signature.
+func ValidateAlarmDeliveryToEndpoint(t *testing.T, inputs AlarmInputs, endpoint *SNSEndpoint) {
+	expected, _ := ExpectedAlarms(inputs)
+	for _, alarm := range expected {
+		reason := fmt.Sprintf("terratest forced alarm %d", time.Now().UnixNano())
+		ForceAlarmState(t, alarm.Name, cloudwatchtypes.StateValueAlarm, reason)
+
+		message, notification := endpoint.WaitForAlarmNotification(t, alarm.Name, string(cloudwatchtypes.StateValueAlarm), reason, 3*time.Minute)
+		assert.Equal(t, inputs.TopicARN, message.TopicArn, "Notification should come from the alerts topic")
+		assert.Equal(t, alarm.MetricName, notification.Trigger.MetricName)
+		t.Logf("✓ %s notification of %s delivered to the HTTPS endpoint (message %s)", notification.NewStateValue,
+			alarm.Name, message.MessageID)
+	}
+}
@@ -0,0 +1,233 @@
+package test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeSNS is an httptest stand-in for the SNS side of an HTTPS subscription: it serves the
+// signing certificate, answers ConfirmSubscription and signs the messages it delivers.
+type fakeSNS struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu        sync.Mutex
+	confirmed []string // tokens
+}
+
+func newFakeSNS(t *testing.T) *fakeSNS {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "sns.us-east-1.amazonaws.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+
+	f := &fakeSNS{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /SimpleNotificationService-test.pem", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(certPEM)
+	})
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if query.Get("Action") != "ConfirmSubscription" {
+			http.Error(w, "unknown action", http.StatusBadRequest)
+			return
+		}
+		f.mu.Lock()
+		f.confirmed = append(f.confirmed, query.Get("Token"))
+		f.mu.Unlock()
+		fmt.Fprintf(w, `<ConfirmSubscriptionResponse xmlns="http://sns.amazonaws.com/doc/2010-03-31/">
+  <ConfirmSubscriptionResult><SubscriptionArn>%s:0f1e2d3c</SubscriptionArn></ConfirmSubscriptionResult>
+</ConfirmSubscriptionResponse>`, query.Get("TopicArn"))
+	})
+	f.Server = httptest.NewTLSServer(mux)
+	t.Cleanup(f.Close)
+	return f
+}
+
+// endpoint returns an SNSEndpoint that trusts the fake instead of the SNS hosts.
+func (f *fakeSNS) endpoint() *SNSEndpoint {
+	endpoint := NewSNSEndpoint()
+	endpoint.Client = f.Client()
+	endpoint.ValidateURL = func(raw string) error {
+		if parsed, err := url.Parse(raw); err != nil || parsed.Scheme != "https" || parsed.Host != f.Listener.Addr().String() {
+			return fmt.Errorf("URL %q is not served by the fake", raw)
+		}
+		return nil
+	}
+	return endpoint
+}
+
+func (f *fakeSNS) sign(t *testing.T, message SNSMessage, version string) SNSMessage {
+	message.SigningCertURL = f.URL + "/SimpleNotificationService-test.pem"
+	message.SignatureVersion = version
+	stringToSign, err := SNSStringToSign(message)
+	require.NoError(t, err)
+
+	var signature []byte
+	if version == "1" {
+		sum := sha1.Sum([]byte(stringToSign))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, f.key, crypto.SHA1, sum[:])
+	} else {
+		sum := sha256.Sum256([]byte(stringToSign))
+		signature, err = rsa.SignPKCS1v15(rand.Reader, f.key, crypto.SHA256, sum[:])
+	}
+	require.NoError(t, err)
+	message.Signature = base64.StdEncoding.EncodeToString(signature)
+	return message
+}
+
+func (f *fakeSNS) confirmation(t *testing.T, topicARN string) SNSMessage {
+	query := url.Values{"Action": {"ConfirmSubscription"}, "TopicArn": {topicARN}, "Token": {"token-1"}}
+	return f.sign(t, SNSMessage{
+		Type:         "SubscriptionConfirmation",
+		MessageID:    "165545c9-2a5c-472c-8df2-7ff2be2b3b1b",
+		TopicArn:     topicARN,
+		Message:      "You have chosen to subscribe to the topic " + topicARN,
+		Timestamp:    "2025-01-02T03:00:00.000Z",
+		Token:        "token-1",
+		SubscribeURL: f.URL + "/?" + query.Encode(),
+	}, "1")
+}
+
+// deliver posts a message to the endpoint like SNS does and returns the response status.
+func deliver(t *testing.T, endpointURL string, message SNSMessage) int {
+	body, err := json.Marshal(message)
+	require.NoError(t, err)
+	req, err := http.NewRequest(http.MethodPost, endpointURL, bytes.NewReader(body))
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "text/plain; charset=UTF-8")
+	req.Header.Set("x-amz-sns-message-type", message.Type)
+	req.Header.Set("x-amz-sns-topic-arn", message.TopicArn)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestValidateSNSURL(t *testing.T) {
+	assert.NoError(t, ValidateSNSURL("https://sns.us-east-1.amazonaws.com/SimpleNotificationService-abc.pem"))
+	assert.NoError(t, ValidateSNSURL("https://sns.cn-north-1.amazonaws.com.cn/?Action=ConfirmSubscription"))
+
+	for _, raw := range []string{
+		"http://sns.us-east-1.amazonaws.com/cert.pem",
+		"https://sns.us-east-1.amazonaws.com.example.com/cert.pem",
+		"https://example.com/sns.us-east-1.amazonaws.com/cert.pem",
+		"https://s3.us-east-1.amazonaws.com/cert.pem",
+		"://",
+	} {
+		assert.Error(t, ValidateSNSURL(raw), raw)
+	}
+}
+
+func TestSNSStringToSign(t *testing.T) {
+	message := SNSMessage{Type: "Notification", MessageID: "id", TopicArn: "arn", Message: "body", Timestamp: "ts"}
+	stringToSign, err := SNSStringToSign(message)
+	require.NoError(t, err)
+	assert.Equal(t, "Message\nbody\nMessageId\nid\nTimestamp\nts\nTopicArn\narn\nType\nNotification\n", stringToSign)
+
+	message.Subject = "subject"
+	stringToSign, err = SNSStringToSign(message)
+	require.NoError(t, err)
+	assert.Equal(t, "Message\nbody\nMessageId\nid\nSubject\nsubject\nTimestamp\nts\nTopicArn\narn\nType\nNotification\n", stringToSign)
+
+	confirmation := SNSMessage{Type: "SubscriptionConfirmation", MessageID: "id", TopicArn: "arn", Message: "body",
+		Timestamp: "ts", Token: "token", SubscribeURL: "url", Subject: "ignored"}
+	stringToSign, err = SNSStringToSign(confirmation)
+	require.NoError(t, err)
+	assert.Equal(t, "Message\nbody\nMessageId\nid\nSubscribeURL\nurl\nTimestamp\nts\nToken\ntoken\nTopicArn\narn\nType\nSubscriptionConfirmation\n", stringToSign)
+
+	_, err = SNSStringToSign(SNSMessage{Type: "Other"})
+	assert.ErrorContains(t, err, "unknown SNS message type")
+}
+
+func TestSNSEndpoint(t *testing.T) {
+	fake := newFakeSNS(t)
+	endpoint := fake.endpoint()
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+
+	// Confirmation handshake
+	assert.Equal(t, http.StatusOK, deliver(t, server.URL, fake.confirmation(t, testTopicARN)))
+	assert.Equal(t, testTopicARN+":0f1e2d3c", endpoint.WaitForConfirmation(t, testTopicARN, time.Second))
+	assert.Equal(t, []string{"token-1"}, fake.confirmed)
+
+	// Recorded alarm notification, re-signed by the fake with both signature versions
+	body, err := os.ReadFile(filepath.Join("testdata", "sns", "alarm-notification.json"))
+	require.NoError(t, err)
+	var recorded SNSMessage
+	require.NoError(t, json.Unmarshal(body, &recorded))
+
+	assert.Equal(t, http.StatusOK, deliver(t, server.URL, fake.sign(t, recorded, "1")))
+	assert.Equal(t, http.StatusOK, deliver(t, server.URL, fake.sign(t, recorded, "2")))
+	require.Len(t, endpoint.Notifications(), 2)
+	message, notification := endpoint.WaitForAlarmNotification(t, "test-alerts1-sqs-main-oldest-message", "ALARM",
+		"terratest forced alarm 1735787045000000000", time.Second)
+	assert.Equal(t, recorded.MessageID, message.MessageID)
+	assert.Equal(t, 600.0, notification.Trigger.Threshold)
+	assert.Empty(t, endpoint.Rejected())
+}
+
+func TestSNSEndpointRejects(t *testing.T) {
+	fake := newFakeSNS(t)
+	endpoint := fake.endpoint()
+	server := httptest.NewServer(endpoint)
+	defer server.Close()
+
+	signed := fake.sign(t, SNSMessage{Type: "Notification", MessageID: "id", TopicArn: testTopicARN, Message: "body", Timestamp: "ts"}, "1")
+
+	tampered := signed
+	tampered.Message = "forged"
+	assert.Equal(t, http.StatusForbidden, deliver(t, server.URL, tampered))
+
+	unsupported := signed
+	unsupported.SignatureVersion = "3"
+	assert.Equal(t, http.StatusForbidden, deliver(t, server.URL, unsupported))
+
+	// A forged confirmation cannot make the endpoint visit another host
+	confirmation := fake.confirmation(t, testTopicARN)
+	confirmation.SubscribeURL = "https://attacker.example.com/?Action=ConfirmSubscription"
+	assert.Equal(t, http.StatusForbidden, deliver(t, server.URL, fake.sign(t, confirmation, "1")))
+
+	// The default endpoint only fetches certificates from SNS
+	strict := httptest.NewServer(NewSNSEndpoint())
+	defer strict.Close()
+	assert.Equal(t, http.StatusForbidden, deliver(t, strict.URL, signed))
+
+	assert.Empty(t, endpoint.Notifications())
+	assert.Empty(t, endpoint.Confirmed(testTopicARN))
+	assert.Empty(t, fake.confirmed)
+	rejected := endpoint.Rejected()
+	require.Len(t, rejected, 3)
+	assert.Contains(t, rejected[0], "does not verify")
+	assert.Contains(t, rejected[1], "unsupported SignatureVersion")
+	assert.Contains(t, rejected[2], "untrusted SubscribeURL")
+}
@@ -0,0 +1,357 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/apprunner"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	cloudwatchlogstypes "github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs/types"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	eventbridgetypes "github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// =============================================================================
+// SPOT INTERRUPTION EVENTS
+// =============================================================================
+
+// SpotInterruptionDetailType is the EventBridge detail-type of EC2 spot interruption warnings.
+const SpotInterruptionDetailType = "EC2 Spot Instance Interruption Warning"
+
+// SpotInterruptionEvent is an EventBridge event in the shape EC2 emits two minutes before
+// reclaiming a spot instance.
+type SpotInterruptionEvent struct {
+	Version    string                 `json:"version"`
+	ID         string                 `json:"id"`
+	DetailType string                 `json:"detail-type"`
+	Source     string                 `json:"source"`
+	Account    string                 `json:"account"`
+	Time       string                 `json:"time"`
+	Region     string                 `json:"region"`
+	Resources  []string               `json:"resources"`
+	Detail     SpotInterruptionDetail `json:"detail"`
+}
+
+// SpotInterruptionDetail is the detail of a spot interruption warning.
+type SpotInterruptionDetail struct {
+	InstanceID     string `json:"instance-id"`
+	InstanceAction string `json:"instance-action"`
+}
+
+// SpotCircuitBreaker is a parsed spot_circuit_breaker setting: after Threshold interruptions within
+// Window, runners launch on-demand for Block.
+type SpotCircuitBreaker struct {
+	Threshold int
+	Window    time.Duration
+	Block     time.Duration
+}
+
+// BuildSpotInterruptionEvent builds a "terminate" interruption warning for an instance.
+func BuildSpotInterruptionEvent(account, region, instanceID string, now time.Time) SpotInterruptionEvent {
+	return SpotInterruptionEvent{
+		Version:    "0",
+		ID:         newDeliveryID(),
+		DetailType: SpotInterruptionDetailType,
+		Source:     "aws.ec2",
+		Account:    account,
+		Time:       now.UTC().Format(time.RFC3339),
+		Region:     region,
+		Resources:  []string{fmt.Sprintf("arn:aws:ec2:%s:%s:instance/%s", region, account, instanceID)},
+		Detail: SpotInterruptionDetail{
+			InstanceID:     instanceID,
+			InstanceAction: "terminate",
+		},
+	}
+}
+
+// PutEventsEntry converts the event to a PutEvents entry for the given event bus ("" for default).
+func (e SpotInterruptionEvent) PutEventsEntry(eventBusName string) (eventbridgetypes.PutEventsRequestEntry, error) {
+	detail, err := json.Marshal(e.Detail)
+	if err != nil {
+		return eventbridgetypes.PutEventsRequestEntry{}, err
+	}
+
+	entry := eventbridgetypes.PutEventsRequestEntry{
+		Source:     aws.String(e.Source),
+		DetailType: aws.String(e.DetailType),
+		Detail:     aws.String(string(detail)),
+		Resources:  e.Resources,
+	}
+	if eventTime, err := time.Parse(time.RFC3339, e.Time); err == nil {
+		entry.Time = aws.Time(eventTime)
+	}
+	if eventBusName != "" {
+		entry.EventBusName = aws.String(eventBusName)
+	}
+	return entry, nil
+}
+
+// ParseSpotCircuitBreaker parses a spot_circuit_breaker value such as "2/15/30"
+// (2 interruptions within 15 minutes block spot for 30 minutes).
+func ParseSpotCircuitBreaker(value string) (SpotCircuitBreaker, error) {
+	parts := strings.Split(value, "/")
+	if len(parts) != 3 {
+		return SpotCircuitBreaker{}, fmt.Errorf("spot circuit breaker should be in 'count/window/block' format, got: %q", value)
+	}
+
+	numbers := make([]int, len(parts))
+	for i, part := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n <= 0 {
+			return SpotCircuitBreaker{}, fmt.Errorf("spot circuit breaker values should be positive integers, got: %q", value)
+		}
+		numbers[i] = n
+	}
+
+	return SpotCircuitBreaker{
+		Threshold: numbers[0],
+		Window:    time.Duration(numbers[1]) * time.Minute,
+		Block:     time.Duration(numbers[2]) * time.Minute,
+	}, nil
+}
+
+// =============================================================================
+// SPOT INTERRUPTION INJECTION
+// =============================================================================
+
+// InjectSpotInterruption delivers a synthetic interruption warning for instanceID to the stack's
+// events queue. The event is first checked against the <stack>-spot-interruption rule pattern
+// (TestEventPattern), then sent with PutEvents. EventBridge refuses PutEvents entries with an
+// "aws." source from customer accounts (NotAuthorizedForSourceException); in that case the
+// envelope is sent to the rule's SQS target directly, which is what EventBridge would deliver.
+func InjectSpotInterruption(t *testing.T, stackName, eventsQueueURL, instanceID string) SpotInterruptionEvent {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := eventbridge.NewFromConfig(cfg)
+
+	ruleName := stackName + "-spot-interruption"
+	rule, err := client.DescribeRule(ctx, &eventbridge.DescribeRuleInput{Name: aws.String(ruleName)})
+	require.NoError(t, err, "Failed to describe EventBridge rule %s", ruleName)
+
+	ruleARN, err := arn.Parse(aws.ToString(rule.Arn))
+	require.NoError(t, err, "Invalid rule ARN %s", aws.ToString(rule.Arn))
+
+	event := BuildSpotInterruptionEvent(ruleARN.AccountID, ruleARN.Region, instanceID, time.Now())
+	envelope, err := json.Marshal(event)
+	require.NoError(t, err, "Failed to marshal interruption event")
+
+	match, err := client.TestEventPattern(ctx, &eventbridge.TestEventPatternInput{
+		EventPattern: rule.EventPattern,
+		Event:        aws.String(string(envelope)),
+	})
+	require.NoError(t, err, "Failed to test event against %s", ruleName)
+	require.True(t, match.Result, "Interruption event should match the %s pattern", ruleName)
+
+	entry, err := event.PutEventsEntry(aws.ToString(rule.EventBusName))
+	require.NoError(t, err, "Failed to build PutEvents entry")
+
+	put, err := client.PutEvents(ctx, &eventbridge.PutEventsInput{Entries: []eventbridgetypes.PutEventsRequestEntry{entry}})
+	if err == nil && put.FailedEntryCount == 0 {
+		t.Logf("✓ Injected spot interruption for %s via PutEvents (event %s)", instanceID, aws.ToString(put.Entries[0].EventId))
+		return event
+	}
+	if err == nil {
+		err = fmt.Errorf("%s: %s", aws.ToString(put.Entries[0].ErrorCode), aws.ToString(put.Entries[0].ErrorMessage))
+	}
+	t.Logf("PutEvents refused the aws.ec2 event (%v), sending it to the events queue directly", err)
+
+	sqsClient := sqs.NewFromConfig(cfg)
+	_, err = sqsClient.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(eventsQueueURL),
+		MessageBody: aws.String(string(envelope)),
+	})
+	require.NoError(t, err, "Failed to send interruption event to %s", eventsQueueURL)
+
+	t.Logf("✓ Injected spot interruption for %s via the events queue (event %s)", instanceID, event.ID)
+	return event
+}
+
+// WaitForQueueDrained waits until a queue has no visible or in-flight messages, i.e. its consumer
+// has processed (deleted) everything sent to it.
+func WaitForQueueDrained(t *testing.T, queueURL string, timeout time.Duration) bool {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := sqs.NewFromConfig(cfg)
+
+	queueName := queueURL[strings.LastIndex(queueURL, "/")+1:]
+	deadline := time.Now().Add(timeout)
+
+	for {
+		attrs, err := client.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+			QueueUrl: aws.String(queueURL),
+			AttributeNames: []sqstypes.QueueAttributeName{
+				sqstypes.QueueAttributeNameApproximateNumberOfMessages,
+				sqstypes.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+			},
+		})
+		if err != nil {
+			t.Logf("Error getting attributes of %s: %v", queueName, err)
+		} else {
+			total := 0
+			for _, value := range attrs.Attributes {
+				n, _ := strconv.Atoi(value)
+				total += n
+			}
+			if total == 0 {
+				t.Logf("✓ Queue %s drained", queueName)
+				return true
+			}
+			t.Logf("Queue %s still has %d message(s)...", queueName, total)
+		}
+
+		if time.Now().After(deadline) {
+			return false
+		}
+		sleepUntilRetry(10*time.Second, deadline)
+	}
+}
+
+// GetAppRunnerLogGroup returns the application log group of an App Runner service.
+func GetAppRunnerLogGroup(t *testing.T, serviceARN string) string {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := apprunner.NewFromConfig(cfg)
+
+	result, err := client.DescribeService(ctx, &apprunner.DescribeServiceInput{
+		ServiceArn: aws.String(serviceARN),
+	})
+	require.NoError(t, err, "Failed to describe App Runner service")
+
+	return fmt.Sprintf("/aws/apprunner/%s/%s/application",
+		aws.ToString(result.Service.ServiceName), aws.ToString(result.Service.ServiceId))
+}
+
+// WaitForSpotCircuitBreakerOpen polls the app's snapshot metrics (the same Logs Insights fields the
+// dashboard's circuit breaker widget uses) until one logged after 'since' reports the breaker active.
+func WaitForSpotCircuitBreakerOpen(t *testing.T, logGroupName string, since time.Time, timeout time.Duration) bool {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := cloudwatchlogs.NewFromConfig(cfg)
+
+	query := "filter metric_type = \"snapshot\"" +
+		"\n| fields @timestamp, spot_circuit_breaker.active as active, spot_circuit_breaker.interruption_count as interruptions" +
+		"\n| sort @timestamp desc\n| limit 1"
+	deadline := time.Now().Add(timeout)
+
+	for {
+		started, err := client.StartQuery(ctx, &cloudwatchlogs.StartQueryInput{
+			LogGroupName: aws.String(logGroupName),
+			QueryString:  aws.String(query),
+			StartTime:    aws.Int64(since.Unix()),
+			EndTime:      aws.Int64(time.Now().Unix()),
+		})
+		if err != nil {
+			t.Logf("Error starting Logs Insights query on %s: %v", logGroupName, err)
+		} else {
+			fields, err := waitForQueryResults(ctx, client, aws.ToString(started.QueryId), deadline)
+			if err != nil {
+				t.Logf("Error getting Logs Insights results: %v", err)
+			} else if fields != nil {
+				t.Logf("Latest snapshot: circuit breaker active=%s, interruptions=%s", fields["active"], fields["interruptions"])
+				if fields["active"] == "1" || fields["active"] == "true" {
+					t.Logf("✓ Spot circuit breaker is open")
+					return true
+				}
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return false
+		}
+		sleepUntilRetry(30*time.Second, deadline)
+	}
+}
+
+// waitForQueryResults waits for a Logs Insights query to finish and returns its first row,
+// or nil if the query matched nothing.
+func waitForQueryResults(ctx context.Context, client *cloudwatchlogs.Client, queryID string, deadline time.Time) (map[string]string, error) {
+	for {
+		results, err := client.GetQueryResults(ctx, &cloudwatchlogs.GetQueryResultsInput{QueryId: aws.String(queryID)})
+		if err != nil {
+			return nil, err
+		}
+
+		switch results.Status {
+		case cloudwatchlogstypes.QueryStatusComplete:
+			if len(results.Results) == 0 {
+				return nil, nil
+			}
+			fields := map[string]string{}
+			for _, field := range results.Results[0] {
+				fields[aws.ToString(field.Field)] = aws.ToString(field.Value)
+			}
+			return fields, nil
+		case cloudwatchlogstypes.QueryStatusFailed, cloudwatchlogstypes.QueryStatusCancelled, cloudwatchlogstypes.QueryStatusTimeout:
+			return nil, fmt.Errorf("query %s ended with status %s", queryID, results.Status)
+		}
+
+		if time.Now().After(deadline) {
+			return nil, errors.New("timed out waiting for query results")
+		}
+		sleepUntilRetry(2*time.Second, deadline)
+	}
+}
+
+// RunSpotInterruption launches spot runners with synthetic webhooks and interrupts each of them until
+// the spot circuit breaker threshold is crossed, then asserts the next runner launches on-demand.
+// Each job is in progress when its runner is interrupted, as in a real interruption (the app may
+// disregard interruptions of runners that finished their job), and is reported completed after.
+// The jobs go to the stack's own app (see stackWebhookTarget), which skips the test without one.
+func RunSpotInterruption(t *testing.T, stackName, appRunnerURL, configBucket, serviceARN, eventsQueueURL string) {
+	breaker, err := ParseSpotCircuitBreaker(GetAppRunnerEnvironment(t, serviceARN)["RUNS_ON_SPOT_CIRCUIT_BREAKER"])
+	require.NoError(t, err, "Invalid RUNS_ON_SPOT_CIRCUIT_BREAKER")
+	t.Logf("Spot circuit breaker: %d interruption(s) within %s block spot for %s", breaker.Threshold, breaker.Window, breaker.Block)
+
+	ValidateAppRunnerHealth(t, appRunnerURL, 20)
+	webhookURL, secret := stackWebhookTarget(t, appRunnerURL, configBucket)
+
+	installationID, err := strconv.ParseInt(GetOptionalEnv("RUNS_ON_TEST_APP_INSTALLATION_ID", "0"), 10, 64)
+	require.NoError(t, err, "Invalid RUNS_ON_TEST_APP_INSTALLATION_ID")
+	repo := GetOptionalEnv("RUNS_ON_TEST_REPO", "test-org/test-repo")
+
+	startTime := time.Now()
+	for i := 1; i <= breaker.Threshold; i++ {
+		job := NewSyntheticWorkflowJob(repo, installationID, "runner=2cpu-linux-x64")
+		launchedAfter := time.Now()
+		ReplayWorkflowJob(t, webhookURL, secret, job, 0, WorkflowJobQueued)
+
+		instanceID := FindRunnerInstance(t, stackName, launchedAfter, 5*time.Minute)
+		require.NotEmpty(t, instanceID, "No runner launched for interruption %d", i)
+		t.Cleanup(func() { TerminateTestInstance(t, instanceID) })
+		ValidateRunnerInstance(t, instanceID, RunnerExpectation{Lifecycle: "spot"})
+
+		ReplayWorkflowJob(t, webhookURL, secret, job, 0, WorkflowJobInProgress)
+
+		InjectSpotInterruption(t, stackName, eventsQueueURL, instanceID)
+		require.True(t, WaitForQueueDrained(t, eventsQueueURL, 5*time.Minute), "App should consume interruption %d from the events queue", i)
+
+		ReplayWorkflowJob(t, webhookURL, secret, job, 0, WorkflowJobCompleted)
+	}
+	require.Less(t, time.Since(startTime), breaker.Window, "Interruptions should be injected within the circuit breaker window")
+
+	assert.True(t, WaitForSpotCircuitBreakerOpen(t, GetAppRunnerLogGroup(t, serviceARN), startTime, 5*time.Minute),
+		"App should report the spot circuit breaker as active")
+
+	job := NewSyntheticWorkflowJob(repo, installationID, "runner=2cpu-linux-x64")
+	launchedAfter := time.Now()
+	ReplayWorkflowJob(t, webhookURL, secret, job, 0, WorkflowJobQueued)
+
+	instanceID := FindRunnerInstance(t, stackName, launchedAfter, 5*time.Minute)
+	require.NotEmpty(t, instanceID, "No runner launched after the circuit breaker opened")
+	t.Cleanup(func() { TerminateTestInstance(t, instanceID) })
+	ValidateRunnerInstance(t, instanceID, RunnerExpectation{Lifecycle: "on-demand"})
+
+	ReplayWorkflowJob(t, webhookURL, secret, job, 0, WorkflowJobInProgress, WorkflowJobCompleted)
+}
@@ -0,0 +1,71 @@
+package test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildSpotInterruptionEvent(t *testing.T) {
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+	event := BuildSpotInterruptionEvent("123456789012", "us-east-1", "i-0123456789abcdef0", now)
+
+	envelope, err := json.Marshal(event)
+	require.NoError(t, err)
+
+	// Same shape as the EC2 Spot Instance Interruption Warning example in the EC2 user guide
+	var raw map[string]interface{}
+	require.NoError(t, json.Unmarshal(envelope, &raw))
+	assert.Equal(t, "0", raw["version"])
+	assert.Equal(t, "EC2 Spot Instance Interruption Warning", raw["detail-type"])
+	assert.Equal(t, "aws.ec2", raw["source"])
+	assert.Equal(t, "123456789012", raw["account"])
+	assert.Equal(t, "2025-01-02T02:04:05Z", raw["time"])
+	assert.Equal(t, "us-east-1", raw["region"])
+	assert.Equal(t, []interface{}{"arn:aws:ec2:us-east-1:123456789012:instance/i-0123456789abcdef0"}, raw["resources"])
+	assert.Equal(t, map[string]interface{}{
+		"instance-id":     "i-0123456789abcdef0",
+		"instance-action": "terminate",
+	}, raw["detail"])
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`, raw["id"])
+
+	other := BuildSpotInterruptionEvent("123456789012", "us-east-1", "i-0123456789abcdef0", now)
+	assert.NotEqual(t, event.ID, other.ID, "Each event should get a unique ID")
+}
+
+func TestSpotInterruptionPutEventsEntry(t *testing.T) {
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	event := BuildSpotInterruptionEvent("123456789012", "us-east-1", "i-0123456789abcdef0", now)
+
+	entry, err := event.PutEventsEntry("")
+	require.NoError(t, err)
+	assert.Equal(t, "aws.ec2", aws.ToString(entry.Source))
+	assert.Equal(t, SpotInterruptionDetailType, aws.ToString(entry.DetailType))
+	assert.JSONEq(t, `{"instance-id":"i-0123456789abcdef0","instance-action":"terminate"}`, aws.ToString(entry.Detail))
+	assert.Equal(t, event.Resources, entry.Resources)
+	assert.Equal(t, now, aws.ToTime(entry.Time))
+	assert.Nil(t, entry.EventBusName)
+
+	entry, err = event.PutEventsEntry("custom-bus")
+	require.NoError(t, err)
+	assert.Equal(t, "custom-bus", aws.ToString(entry.EventBusName))
+}
+
+func TestParseSpotCircuitBreaker(t *testing.T) {
+	breaker, err := ParseSpotCircuitBreaker("2/15/30")
+	require.NoError(t, err)
+	assert.Equal(t, SpotCircuitBreaker{Threshold: 2, Window: 15 * time.Minute, Block: 30 * time.Minute}, breaker)
+
+	breaker, err = ParseSpotCircuitBreaker("1/5/10")
+	require.NoError(t, err)
+	assert.Equal(t, 1, breaker.Threshold)
+
+	for _, invalid := range []string{"", "2/15", "2/15/30/1", "a/15/30", "0/15/30", "2/-1/30"} {
+		_, err := ParseSpotCircuitBreaker(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
@@ -0,0 +1,441 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/stretchr/testify/require"
+)
+
+// =============================================================================
+// SSM SCRIPTS
+// =============================================================================
+
+// Markers written around each step of an SSM script. The end markers carry the exit code.
+const (
+	ssmStepBeginMarker   = "::ssm-step-begin::"
+	ssmStepEndMarker     = "::ssm-step-end::"
+	ssmScriptEndMarker   = "::ssm-script-end::"
+	defaultSSMTimeout    = 10 * time.Minute
+	defaultSSMPrefix     = "cache/ssm-output"
+	ssmInlineOutputLimit = 24000 // Characters of stdout returned by GetCommandInvocation
+)
+
+var ssmStepNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// SSMStep is a named shell step of an SSM script.
+type SSMStep struct {
+	Name    string
+	Command string
+
+	// AlwaysRun runs the step even after an earlier step failed (e.g. cleanup)
+	AlwaysRun bool
+	// IgnoreFailure keeps a failure of this step from failing the script and skipping later steps
+	IgnoreFailure bool
+}
+
+// SSMOutput selects where the full output of an SSM script is sent, since GetCommandInvocation
+// truncates stdout to 24,000 characters. Set Bucket or LogGroup; with neither, the truncated
+// inline output is used.
+type SSMOutput struct {
+	// Bucket receives the output under Prefix. The instance role must be allowed to write there,
+	// e.g. the cache bucket under cache/
+	Bucket string
+	// Prefix is the key prefix in Bucket (optional - defaults to cache/ssm-output)
+	Prefix string
+	// LogGroup receives the output as log streams <command-id>/<instance-id>/aws-runShellScript/stdout,
+	// e.g. the stack's EC2 instance log group
+	LogGroup string
+	// Timeout is the execution timeout of the script (optional - defaults to 10 minutes)
+	Timeout time.Duration
+}
+
+// SSMStepResult is the outcome of one step, parsed from the script output.
+type SSMStepResult struct {
+	Name     string
+	Ran      bool   // False if the step was skipped after an earlier failure
+	Finished bool   // False if the output ends before the step's end marker
+	ExitCode int    // Exit code of the step, -1 unless finished
+	Output   string // Combined stdout and stderr of the step
+}
+
+// Succeeded reports whether the step ran to completion with exit code 0.
+func (s SSMStepResult) Succeeded() bool {
+	return s.Finished && s.ExitCode == 0
+}
+
+// SSMScriptOutput is the parsed output of an SSM script.
+type SSMScriptOutput struct {
+	Steps    []SSMStepResult
+	Complete bool // The script end marker was found, so no output is missing
+	ExitCode int  // Exit code of the script, -1 unless complete
+}
+
+// SSMScriptResult is the result of RunSSMScript.
+type SSMScriptResult struct {
+	SSMScriptOutput
+
+	CommandID string
+	Status    string // SSM command invocation status
+	Output    string // Full stdout of the script
+	Source    string // Where Output was read from: inline, s3://... or a log stream
+}
+
+// Step returns the result of the named step, or a not-run result if the script has no such step output.
+func (r SSMScriptOutput) Step(name string) SSMStepResult {
+	for _, step := range r.Steps {
+		if step.Name == name {
+			return step
+		}
+	}
+	return SSMStepResult{Name: name, ExitCode: -1}
+}
+
+// Failed returns the steps that ran and did not succeed.
+func (r SSMScriptOutput) Failed() []SSMStepResult {
+	var failed []SSMStepResult
+	for _, step := range r.Steps {
+		if step.Ran && !step.Succeeded() {
+			failed = append(failed, step)
+		}
+	}
+	return failed
+}
+
+// BuildSSMScript renders steps as a single bash script. Each step runs in a subshell with stderr
+// merged into stdout, between begin and end markers; the end marker records its exit code.
+// After a failing step, later steps are skipped unless they are AlwaysRun.
+func BuildSSMScript(steps []SSMStep) (string, error) {
+	if len(steps) == 0 {
+		return "", errors.New("at least one step is required")
+	}
+
+	seen := map[string]bool{}
+	var b strings.Builder
+	b.WriteString("_rc=0\n")
+	for _, step := range steps {
+		if !ssmStepNamePattern.MatchString(step.Name) {
+			return "", fmt.Errorf("invalid step name %q (letters, digits, '.', '_' and '-' only)", step.Name)
+		}
+		if seen[step.Name] {
+			return "", fmt.Errorf("duplicate step name %q", step.Name)
+		}
+		seen[step.Name] = true
+
+		if !step.AlwaysRun {
+			b.WriteString("if [ \"$_rc\" -eq 0 ]; then\n")
+		}
+		fmt.Fprintf(&b, "echo '%s%s'\n", ssmStepBeginMarker, step.Name)
+		fmt.Fprintf(&b, "(\n%s\n) 2>&1\n", strings.TrimSpace(step.Command))
+		b.WriteString("_step=$?\n")
+		fmt.Fprintf(&b, "echo \"%s%s::$_step\"\n", ssmStepEndMarker, step.Name)
+		if !step.IgnoreFailure {
+			b.WriteString("if [ \"$_step\" -ne 0 ] && [ \"$_rc\" -eq 0 ]; then _rc=$_step; fi\n")
+		}
+		if !step.AlwaysRun {
+			b.WriteString("fi\n")
+		}
+	}
+	fmt.Fprintf(&b, "echo \"%s$_rc\"\nexit $_rc\n", ssmScriptEndMarker)
+	return b.String(), nil
+}
+
+// ParseSSMScriptOutput parses the output of a script built with BuildSSMScript. Output lost to
+// truncation shows up as unfinished steps and an incomplete script.
+func ParseSSMScriptOutput(output string) SSMScriptOutput {
+	parsed := SSMScriptOutput{ExitCode: -1}
+	var current *SSMStepResult
+	var lines []string
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		// End markers may follow output without a trailing newline on the same line
+		if idx := strings.Index(line, ssmStepEndMarker); idx >= 0 && current != nil {
+			if idx > 0 {
+				lines = append(lines, line[:idx])
+			}
+			name, code, _ := strings.Cut(line[idx+len(ssmStepEndMarker):], "::")
+			if exitCode, err := strconv.Atoi(strings.TrimSpace(code)); err == nil && name == current.Name {
+				current.Finished = true
+				current.ExitCode = exitCode
+			}
+			current.Output = strings.Join(lines, "\n")
+			parsed.Steps = append(parsed.Steps, *current)
+			current, lines = nil, nil
+			continue
+		}
+
+		if name, ok := strings.CutPrefix(line, ssmStepBeginMarker); ok {
+			if current != nil {
+				current.Output = strings.Join(lines, "\n")
+				parsed.Steps = append(parsed.Steps, *current)
+			}
+			current = &SSMStepResult{Name: strings.TrimSpace(name), Ran: true, ExitCode: -1}
+			lines = nil
+			continue
+		}
+
+		if code, ok := strings.CutPrefix(line, ssmScriptEndMarker); ok && current == nil {
+			if exitCode, err := strconv.Atoi(strings.TrimSpace(code)); err == nil {
+				parsed.Complete = true
+				parsed.ExitCode = exitCode
+			}
+			continue
+		}
+
+		if current != nil {
+			lines = append(lines, line)
+		}
+	}
+
+	if current != nil {
+		current.Output = strings.Join(lines, "\n")
+		parsed.Steps = append(parsed.Steps, *current)
+	}
+	return parsed
+}
+
+// =============================================================================
+// SSM SCRIPT EXECUTION
+// =============================================================================
+
+// RunSSMScript runs steps as a single AWS-RunShellScript invocation and returns the parsed result.
+// The full output is read from output.Bucket or output.LogGroup when set, otherwise from the
+// (truncated) inline output. A script whose steps fail is not an error; check the step results.
+// Errors are returned for delivery failures, timeouts and cancellations.
+func RunSSMScript(t *testing.T, instanceID string, steps []SSMStep, output SSMOutput) (*SSMScriptResult, error) {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := ssm.NewFromConfig(cfg)
+
+	script, err := BuildSSMScript(steps)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := output.Timeout
+	if timeout <= 0 {
+		timeout = defaultSSMTimeout
+	}
+	prefix := strings.TrimSuffix(output.Prefix, "/")
+	if prefix == "" {
+		prefix = defaultSSMPrefix
+	}
+
+	names := make([]string, len(steps))
+	for i, step := range steps {
+		names[i] = step.Name
+	}
+	t.Logf("Running SSM script on instance %s: %s", instanceID, strings.Join(names, ", "))
+
+	input := &ssm.SendCommandInput{
+		InstanceIds:  []string{instanceID},
+		DocumentName: aws.String("AWS-RunShellScript"),
+		Parameters: map[string][]string{
+			"commands":         {script},
+			"executionTimeout": {strconv.Itoa(int(timeout.Seconds()))},
+		},
+		TimeoutSeconds: aws.Int32(120),
+	}
+	if output.Bucket != "" {
+		input.OutputS3BucketName = aws.String(output.Bucket)
+		input.OutputS3KeyPrefix = aws.String(prefix)
+	}
+	if output.LogGroup != "" {
+		input.CloudWatchOutputConfig = &ssmtypes.CloudWatchOutputConfig{
+			CloudWatchOutputEnabled: true,
+			CloudWatchLogGroupName:  aws.String(output.LogGroup),
+		}
+	}
+
+	sendResult, err := client.SendCommand(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send SSM script: %w", err)
+	}
+	result := &SSMScriptResult{CommandID: aws.ToString(sendResult.Command.CommandId)}
+	t.Logf("SSM command ID: %s", result.CommandID)
+
+	invocation, err := waitForSSMInvocation(ctx, client, result.CommandID, instanceID, time.Now().Add(timeout+2*time.Minute))
+	if err != nil {
+		return result, err
+	}
+	result.Status = string(invocation.Status)
+	t.Logf("SSM script status: %s", result.Status)
+
+	result.Output, result.Source = aws.ToString(invocation.StandardOutputContent), "inline"
+	switch {
+	case output.Bucket != "":
+		result.Output, result.Source, err = readSSMOutputFromS3(ctx, cfg, output.Bucket, prefix, result.CommandID, instanceID)
+	case output.LogGroup != "":
+		result.Output, result.Source, err = readSSMOutputFromCloudWatch(ctx, cfg, output.LogGroup, result.CommandID, instanceID)
+	}
+	if err != nil {
+		t.Logf("Warning: falling back to inline SSM output: %v", err)
+		result.Output, result.Source = aws.ToString(invocation.StandardOutputContent), "inline"
+	}
+
+	result.SSMScriptOutput = ParseSSMScriptOutput(result.Output)
+	if !result.Complete {
+		t.Logf("Warning: SSM script output from %s is incomplete (%d characters, inline output is limited to %d)",
+			result.Source, len(result.Output), ssmInlineOutputLimit)
+	}
+	for _, step := range result.Steps {
+		t.Logf("SSM step %s: exit code %d", step.Name, step.ExitCode)
+	}
+
+	switch invocation.Status {
+	case ssmtypes.CommandInvocationStatusCancelled, ssmtypes.CommandInvocationStatusTimedOut:
+		return result, fmt.Errorf("SSM script %s: %s", invocation.Status, aws.ToString(invocation.StatusDetails))
+	}
+	return result, nil
+}
+
+// waitForSSMInvocation polls a command invocation until it reaches a terminal status.
+func waitForSSMInvocation(ctx context.Context, client *ssm.Client, commandID, instanceID string, deadline time.Time) (*ssm.GetCommandInvocationOutput, error) {
+	for {
+		sleepUntilRetry(3*time.Second, deadline)
+
+		invocation, err := client.GetCommandInvocation(ctx, &ssm.GetCommandInvocationInput{
+			CommandId:  aws.String(commandID),
+			InstanceId: aws.String(instanceID),
+		})
+		if err != nil && !strings.Contains(err.Error(), "InvocationDoesNotExist") {
+			return nil, fmt.Errorf("failed to get command invocation: %w", err)
+		}
+
+		if err == nil {
+			switch invocation.Status {
+			case ssmtypes.CommandInvocationStatusSuccess, ssmtypes.CommandInvocationStatusFailed,
+				ssmtypes.CommandInvocationStatusCancelled, ssmtypes.CommandInvocationStatusTimedOut:
+				return invocation, nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("SSM command %s did not finish in time", commandID)
+		}
+	}
+}
+
+// readSSMOutputFromS3 reads the stdout object SSM uploads under <prefix>/<command-id>/<instance-id>/.
+// The upload happens shortly after the command finishes, so the object is polled for a minute.
+func readSSMOutputFromS3(ctx context.Context, cfg aws.Config, bucket, prefix, commandID, instanceID string) (string, string, error) {
+	client := s3.NewFromConfig(cfg)
+	keyPrefix := fmt.Sprintf("%s/%s/%s/", prefix, commandID, instanceID)
+	deadline := time.Now().Add(time.Minute)
+
+	for {
+		listed, err := client.ListObjectsV2(ctx, &s3.ListObjectsV2Input{
+			Bucket: aws.String(bucket),
+			Prefix: aws.String(keyPrefix),
+		})
+		if err != nil {
+			return "", "", fmt.Errorf("failed to list s3://%s/%s: %w", bucket, keyPrefix, err)
+		}
+
+		for _, object := range listed.Contents {
+			key := aws.ToString(object.Key)
+			if !strings.HasSuffix(key, "/stdout") {
+				continue
+			}
+			body, err := client.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+			if err != nil {
+				return "", "", fmt.Errorf("failed to get s3://%s/%s: %w", bucket, key, err)
+			}
+			defer body.Body.Close()
+			data, err := io.ReadAll(body.Body)
+			if err != nil {
+				return "", "", fmt.Errorf("failed to read s3://%s/%s: %w", bucket, key, err)
+			}
+			return string(data), fmt.Sprintf("s3://%s/%s", bucket, key), nil
+		}
+
+		if time.Now().After(deadline) {
+			return "", "", fmt.Errorf("no stdout object under s3://%s/%s", bucket, keyPrefix)
+		}
+		sleepUntilRetry(5*time.Second, deadline)
+	}
+}
+
+// readSSMOutputFromCloudWatch reads the stdout log stream SSM writes as <command-id>/<instance-id>/<plugin>/stdout.
+// Events can arrive after the command finishes, so the stream is read until the script end marker shows up
+// or a minute has passed.
+func readSSMOutputFromCloudWatch(ctx context.Context, cfg aws.Config, logGroup, commandID, instanceID string) (string, string, error) {
+	client := cloudwatchlogs.NewFromConfig(cfg)
+	streamPrefix := fmt.Sprintf("%s/%s/", commandID, instanceID)
+	deadline := time.Now().Add(time.Minute)
+
+	for {
+		streams, err := client.DescribeLogStreams(ctx, &cloudwatchlogs.DescribeLogStreamsInput{
+			LogGroupName:        aws.String(logGroup),
+			LogStreamNamePrefix: aws.String(streamPrefix),
+		})
+		if err != nil {
+			return "", "", fmt.Errorf("failed to describe log streams in %s: %w", logGroup, err)
+		}
+
+		for _, stream := range streams.LogStreams {
+			name := aws.ToString(stream.LogStreamName)
+			if !strings.HasSuffix(name, "/stdout") {
+				continue
+			}
+
+			var messages []string
+			var token *string
+			for {
+				events, err := client.GetLogEvents(ctx, &cloudwatchlogs.GetLogEventsInput{
+					LogGroupName:  aws.String(logGroup),
+					LogStreamName: aws.String(name),
+					StartFromHead: aws.Bool(true),
+					NextToken:     token,
+				})
+				if err != nil {
+					return "", "", fmt.Errorf("failed to get log events of %s: %w", name, err)
+				}
+				for _, event := range events.Events {
+					messages = append(messages, strings.TrimSuffix(aws.ToString(event.Message), "\n"))
+				}
+				if aws.ToString(events.NextForwardToken) == aws.ToString(token) {
+					break
+				}
+				token = events.NextForwardToken
+			}
+
+			output := strings.Join(messages, "\n")
+			if strings.Contains(output, ssmScriptEndMarker) || time.Now().After(deadline) {
+				return output, fmt.Sprintf("%s:%s", logGroup, name), nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return "", "", fmt.Errorf("no stdout log stream %s*/stdout in %s", streamPrefix, logGroup)
+		}
+		sleepUntilRetry(5*time.Second, deadline)
+	}
+}
+
+// requireSSMStep fails the test unless the named step succeeded, and returns its result.
+func requireSSMStep(t *testing.T, result *SSMScriptResult, name, description string) SSMStepResult {
+	step := result.Step(name)
+	require.True(t, step.Ran, "%s: step %s did not run (script output from %s, complete: %t)",
+		description, name, result.Source, result.Complete)
+	require.True(t, step.Succeeded(), "%s: step %s exited with %d. output: %s",
+		description, name, step.ExitCode, truncateString(step.Output, 2000))
+	return step
+}
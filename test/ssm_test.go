@@ -0,0 +1,129 @@
+package test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readSSMRecording(t *testing.T, name string) string {
+	data, err := os.ReadFile(filepath.Join("testdata", "ssm", name))
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestParseSSMScriptOutput(t *testing.T) {
+	t.Run("Success", func(t *testing.T) {
+		parsed := ParseSSMScriptOutput(readSSMRecording(t, "efs-success.txt"))
+		assert.True(t, parsed.Complete)
+		assert.Equal(t, 0, parsed.ExitCode)
+		require.Len(t, parsed.Steps, 8)
+		assert.Empty(t, parsed.Failed())
+
+		assert.Equal(t, "nfs4", parsed.Step("fstype").Output)
+		assert.Equal(t, "8.0E", parsed.Step("capacity").Output)
+		assert.Empty(t, parsed.Step("mkdir").Output)
+		assert.True(t, parsed.Step("cleanup").Succeeded())
+	})
+
+	t.Run("FailedStep", func(t *testing.T) {
+		parsed := ParseSSMScriptOutput(readSSMRecording(t, "ecr-login-failed.txt"))
+		assert.True(t, parsed.Complete)
+		assert.Equal(t, 1, parsed.ExitCode)
+
+		login := parsed.Step("login")
+		assert.True(t, login.Ran)
+		assert.True(t, login.Finished)
+		assert.Equal(t, 1, login.ExitCode)
+		assert.Contains(t, login.Output, "AccessDeniedException")
+
+		failed := parsed.Failed()
+		require.Len(t, failed, 1)
+		assert.Equal(t, "login", failed[0].Name)
+
+		assert.Contains(t, parsed.Step("buildx").Output, "Driver:        docker-container")
+		skipped := parsed.Step("first-build")
+		assert.False(t, skipped.Ran, "Steps after a failure should be skipped")
+		assert.False(t, skipped.Succeeded())
+		assert.True(t, parsed.Step("cleanup").Succeeded(), "Cleanup always runs")
+	})
+
+	t.Run("Truncated", func(t *testing.T) {
+		// GetCommandInvocation cuts stdout at 24,000 characters, mid build log
+		output := readSSMRecording(t, "ecr-truncated.txt")
+		require.Len(t, output, ssmInlineOutputLimit)
+
+		parsed := ParseSSMScriptOutput(output)
+		assert.False(t, parsed.Complete)
+		assert.Equal(t, -1, parsed.ExitCode)
+		require.Len(t, parsed.Steps, 2)
+		assert.True(t, parsed.Step("install").Succeeded())
+
+		build := parsed.Step("first-build")
+		assert.True(t, build.Ran)
+		assert.False(t, build.Finished)
+		assert.Equal(t, -1, build.ExitCode)
+		assert.False(t, build.Succeeded())
+		assert.True(t, strings.HasPrefix(build.Output, `#0 building with "testbuilder"`))
+		assert.Equal(t, []SSMStepResult{build}, parsed.Failed())
+	})
+
+	t.Run("MarkerAfterUnterminatedOutput", func(t *testing.T) {
+		parsed := ParseSSMScriptOutput("::ssm-step-begin::read\nno newline::ssm-step-end::read::0\n::ssm-script-end::0\n")
+		assert.True(t, parsed.Complete)
+		assert.Equal(t, "no newline", parsed.Step("read").Output)
+		assert.True(t, parsed.Step("read").Succeeded())
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		parsed := ParseSSMScriptOutput("")
+		assert.False(t, parsed.Complete)
+		assert.Empty(t, parsed.Steps)
+		assert.False(t, parsed.Step("missing").Ran)
+	})
+}
+
+func TestBuildSSMScript(t *testing.T) {
+	_, err := BuildSSMScript(nil)
+	assert.Error(t, err)
+	_, err = BuildSSMScript([]SSMStep{{Name: "has space", Command: "true"}})
+	assert.ErrorContains(t, err, "invalid step name")
+	_, err = BuildSSMScript([]SSMStep{{Name: "a", Command: "true"}, {Name: "a", Command: "true"}})
+	assert.ErrorContains(t, err, "duplicate")
+
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash not available")
+	}
+
+	// Run the script locally, the same way AWS-RunShellScript does, and parse its output
+	script, err := BuildSSMScript([]SSMStep{
+		{Name: "first", Command: "echo one\necho two >&2"},
+		{Name: "optional", Command: "exit 3", IgnoreFailure: true},
+		{Name: "failing", Command: "echo broken; exit 7"},
+		{Name: "skipped", Command: "echo should not run"},
+		{Name: "cleanup", Command: "echo cleaning; exit 1", AlwaysRun: true, IgnoreFailure: true},
+	})
+	require.NoError(t, err)
+
+	out, err := exec.Command(bash, "-c", script).Output()
+	var exitErr *exec.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	assert.Equal(t, 7, exitErr.ExitCode(), "The script exits with the first failing step's code")
+
+	parsed := ParseSSMScriptOutput(string(out))
+	assert.True(t, parsed.Complete)
+	assert.Equal(t, 7, parsed.ExitCode)
+	assert.Equal(t, "one\ntwo", parsed.Step("first").Output, "stderr is merged into the step output")
+	assert.Equal(t, 3, parsed.Step("optional").ExitCode)
+	assert.Equal(t, 7, parsed.Step("failing").ExitCode)
+	assert.Equal(t, "broken", parsed.Step("failing").Output)
+	assert.False(t, parsed.Step("skipped").Ran)
+	assert.Equal(t, 1, parsed.Step("cleanup").ExitCode)
+	assert.Equal(t, "cleaning", parsed.Step("cleanup").Output)
+}
@@ -0,0 +1,421 @@
+package test
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// =============================================================================
+// PLAN DIFF CLASSIFICATION
+// =============================================================================
+
+// StatefulResourceTypes are resource types that hold data or history, so a plan must never delete
+// or replace them during an in-place upgrade.
+var StatefulResourceTypes = map[string]bool{
+	"aws_s3_bucket":            true,
+	"aws_dynamodb_table":       true,
+	"aws_ssm_parameter":        true,
+	"aws_efs_file_system":      true,
+	"aws_ecr_repository":       true,
+	"aws_cloudwatch_log_group": true,
+}
+
+// Planned actions of a resource change, derived from the plan's change.actions.
+const (
+	PlanActionNoOp    = "no-op"
+	PlanActionCreate  = "create"
+	PlanActionRead    = "read"
+	PlanActionUpdate  = "update"
+	PlanActionDelete  = "delete"
+	PlanActionReplace = "replace"
+	PlanActionForget  = "forget"
+)
+
+// PlanChange is one entry of a plan's resource_changes or resource_drift.
+type PlanChange struct {
+	Address      string
+	Type         string
+	Mode         string   // managed or data
+	Action       string   // One of the PlanAction constants
+	ActionReason string   // e.g. replace_because_cannot_update
+	Attributes   []string // Top-level attributes that differ between before and after
+}
+
+// Destructive reports whether applying the change deletes the existing object.
+func (c PlanChange) Destructive() bool {
+	return c.Action == PlanActionDelete || c.Action == PlanActionReplace
+}
+
+// Stateful reports whether the change targets a StatefulResourceTypes resource.
+func (c PlanChange) Stateful() bool {
+	return c.Mode == "managed" && StatefulResourceTypes[c.Type]
+}
+
+// PlanDiff is the classified resource changes of a plan.
+type PlanDiff struct {
+	Changes []PlanChange
+	Drift   []PlanChange // Changes made outside of OpenTofu since the last apply
+	Outputs []string     // Outputs whose value changes
+}
+
+// planResourceChange is an entry of resource_changes or resource_drift in plan JSON.
+type planResourceChange struct {
+	Address      string `json:"address"`
+	Mode         string `json:"mode"`
+	Type         string `json:"type"`
+	ActionReason string `json:"action_reason"`
+	Change       struct {
+		Actions      []string               `json:"actions"`
+		Before       map[string]interface{} `json:"before"`
+		After        map[string]interface{} `json:"after"`
+		AfterUnknown map[string]interface{} `json:"after_unknown"`
+	} `json:"change"`
+}
+
+// ParsePlanDiff classifies the resource_changes of `tofu show -json <planfile>` output.
+func ParsePlanDiff(planJSON []byte) (*PlanDiff, error) {
+	var plan struct {
+		FormatVersion   string               `json:"format_version"`
+		ResourceChanges []planResourceChange `json:"resource_changes"`
+		ResourceDrift   []planResourceChange `json:"resource_drift"`
+		OutputChanges   map[string]struct {
+			Actions []string `json:"actions"`
+		} `json:"output_changes"`
+	}
+	if err := json.Unmarshal(planJSON, &plan); err != nil {
+		return nil, fmt.Errorf("failed to parse plan JSON: %w", err)
+	}
+	if plan.FormatVersion == "" {
+		return nil, fmt.Errorf("not a plan JSON document (no format_version)")
+	}
+
+	diff := &PlanDiff{}
+	var err error
+	if diff.Changes, err = classifyResourceChanges(plan.ResourceChanges); err != nil {
+		return nil, err
+	}
+	if diff.Drift, err = classifyResourceChanges(plan.ResourceDrift); err != nil {
+		return nil, err
+	}
+	for name, change := range plan.OutputChanges {
+		if strings.Join(change.Actions, ",") != PlanActionNoOp {
+			diff.Outputs = append(diff.Outputs, name)
+		}
+	}
+	sort.Strings(diff.Outputs)
+	return diff, nil
+}
+
+// classifyResourceChanges converts plan JSON resource changes, sorted by address.
+func classifyResourceChanges(resourceChanges []planResourceChange) ([]PlanChange, error) {
+	var changes []PlanChange
+	for _, rc := range resourceChanges {
+		action, err := classifyPlanActions(rc.Change.Actions)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", rc.Address, err)
+		}
+		change := PlanChange{
+			Address:      rc.Address,
+			Type:         rc.Type,
+			Mode:         rc.Mode,
+			Action:       action,
+			ActionReason: rc.ActionReason,
+		}
+		if action == PlanActionUpdate || action == PlanActionReplace {
+			change.Attributes = changedAttributes(rc.Change.Before, rc.Change.After, rc.Change.AfterUnknown)
+		}
+		changes = append(changes, change)
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Address < changes[j].Address })
+	return changes, nil
+}
+
+// changedAttributes returns the sorted top-level attributes that differ between before and after,
+// including attributes only known after apply.
+func changedAttributes(before, after, afterUnknown map[string]interface{}) []string {
+	changed := map[string]bool{}
+	for name, value := range after {
+		if !reflect.DeepEqual(before[name], value) {
+			changed[name] = true
+		}
+	}
+	for name := range before {
+		if _, ok := after[name]; !ok {
+			changed[name] = true
+		}
+	}
+	for name, unknown := range afterUnknown {
+		if unknown == true {
+			changed[name] = true
+		}
+	}
+
+	var names []string
+	for name := range changed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// classifyPlanActions maps a change.actions list to a single action. Replacements are
+// ["delete", "create"] or ["create", "delete"] (create_before_destroy).
+func classifyPlanActions(actions []string) (string, error) {
+	switch strings.Join(actions, ",") {
+	case "no-op":
+		return PlanActionNoOp, nil
+	case "create":
+		return PlanActionCreate, nil
+	case "read":
+		return PlanActionRead, nil
+	case "update":
+		return PlanActionUpdate, nil
+	case "delete":
+		return PlanActionDelete, nil
+	case "delete,create", "create,delete":
+		return PlanActionReplace, nil
+	case "forget":
+		return PlanActionForget, nil
+	}
+	return "", fmt.Errorf("unknown plan actions %v", actions)
+}
+
+// StatefulDestructive returns the changes that would delete or replace a stateful resource.
+func (d *PlanDiff) StatefulDestructive() []PlanChange {
+	var changes []PlanChange
+	for _, change := range d.Changes {
+		if change.Stateful() && change.Destructive() {
+			changes = append(changes, change)
+		}
+	}
+	return changes
+}
+
+// Change returns the planned change of a resource address, if any.
+func (d *PlanDiff) Change(address string) (PlanChange, bool) {
+	for _, change := range d.Changes {
+		if change.Address == address {
+			return change, true
+		}
+	}
+	return PlanChange{}, false
+}
+
+// Empty reports whether applying the plan would change nothing.
+func (d *PlanDiff) Empty() bool {
+	return len(d.Counts()) == 0 && len(d.Outputs) == 0
+}
+
+// Counts returns the number of changes per action, ignoring no-ops and data source reads.
+func (d *PlanDiff) Counts() map[string]int {
+	counts := map[string]int{}
+	for _, change := range d.Changes {
+		if change.Action != PlanActionNoOp && change.Action != PlanActionRead {
+			counts[change.Action]++
+		}
+	}
+	return counts
+}
+
+// String summarizes the diff, one line per change that is not a no-op or read.
+func (d *PlanDiff) String() string {
+	counts := d.Counts()
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d to create, %d to update, %d to replace, %d to delete, %d to forget\n",
+		counts[PlanActionCreate], counts[PlanActionUpdate], counts[PlanActionReplace],
+		counts[PlanActionDelete], counts[PlanActionForget])
+	for _, change := range d.Changes {
+		if change.Action == PlanActionNoOp || change.Action == PlanActionRead {
+			continue
+		}
+		fmt.Fprintf(&b, "  %-8s %s", change.Action, change.Address)
+		if change.ActionReason != "" {
+			fmt.Fprintf(&b, " (%s)", change.ActionReason)
+		}
+		if len(change.Attributes) > 0 {
+			fmt.Fprintf(&b, ": %s", strings.Join(change.Attributes, ", "))
+		}
+		b.WriteString("\n")
+	}
+	for _, change := range d.Drift {
+		fmt.Fprintf(&b, "  drifted  %s", change.Address)
+		if len(change.Attributes) > 0 {
+			fmt.Fprintf(&b, ": %s", strings.Join(change.Attributes, ", "))
+		}
+		b.WriteString("\n")
+	}
+	if len(d.Outputs) > 0 {
+		fmt.Fprintf(&b, "  outputs  %s\n", strings.Join(d.Outputs, ", "))
+	}
+	return b.String()
+}
+
+// =============================================================================
+// PREVIOUS RELEASE CHECKOUT
+// =============================================================================
+
+// PreviousGitTag returns the most recent tag reachable from HEAD that does not point at HEAD itself,
+// or an empty string if there is none.
+func PreviousGitTag(repoDir string) (string, error) {
+	head, err := gitOutput(repoDir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	tags, err := gitOutput(repoDir, "tag", "--merged", "HEAD", "--sort=-v:refname")
+	if err != nil {
+		return "", err
+	}
+
+	for _, tag := range strings.Fields(tags) {
+		commit, err := gitOutput(repoDir, "rev-list", "-n", "1", tag)
+		if err != nil {
+			return "", err
+		}
+		if commit != head {
+			return tag, nil
+		}
+	}
+	return "", nil
+}
+
+// UpgradeBaseRef returns the git ref the upgrade scenario deploys first: RUNS_ON_TEST_UPGRADE_FROM if
+// set, otherwise the previous release tag. Skips the test if there is no earlier release.
+func UpgradeBaseRef(t *testing.T, repoDir string) string {
+	if ref := os.Getenv("RUNS_ON_TEST_UPGRADE_FROM"); ref != "" {
+		return ref
+	}
+
+	tag, err := PreviousGitTag(repoDir)
+	require.NoError(t, err, "Failed to look up previous release tag")
+	if tag == "" {
+		t.Skip("Skipping upgrade test: no earlier release tag (set RUNS_ON_TEST_UPGRADE_FROM)")
+	}
+	return tag
+}
+
+// ExportGitRef extracts the tree of a git ref (e.g. a release tag) of the repository into a new
+// temporary directory, without touching the working tree, and returns the directory.
+func ExportGitRef(t *testing.T, repoDir, ref string) string {
+	cmd := exec.Command("git", "-C", repoDir, "archive", "--format=tar", ref)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	archive, err := cmd.Output()
+	require.NoError(t, err, "Failed to archive %s: %s", ref, stderr.String())
+
+	dir := t.TempDir()
+	require.NoError(t, extractTar(bytes.NewReader(archive), dir), "Failed to extract %s", ref)
+	t.Logf("Exported %s to %s", ref, dir)
+	return dir
+}
+
+// extractTar extracts regular files and directories of a tar stream below dir.
+func extractTar(r io.Reader, dir string) error {
+	reader := tar.NewReader(r)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(dir, filepath.FromSlash(header.Name))
+		if !strings.HasPrefix(path, filepath.Clean(dir)+string(os.PathSeparator)) {
+			return fmt.Errorf("archive entry %s escapes %s", header.Name, dir)
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(path, 0o755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+				return err
+			}
+			file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode)&0o755|0o644)
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(file, reader); err != nil {
+				file.Close()
+				return err
+			}
+			if err := file.Close(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// CopyTerraformState copies the local state of a module directory to another directory, so the
+// working tree can take over resources deployed from an exported release.
+func CopyTerraformState(t *testing.T, fromDir, toDir string) {
+	state, err := os.ReadFile(filepath.Join(fromDir, "terraform.tfstate"))
+	require.NoError(t, err, "Failed to read state of %s", fromDir)
+	require.NoError(t, os.WriteFile(filepath.Join(toDir, "terraform.tfstate"), state, 0o600), "Failed to write state to %s", toDir)
+}
+
+// gitOutput runs git in repoDir and returns its trimmed stdout.
+func gitOutput(repoDir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", repoDir}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+var variableBlockPattern = regexp.MustCompile(`(?m)^variable\s+"([^"]+)"`)
+
+// DeclaredVariables returns the input variables declared in the .tf files of a module directory.
+func DeclaredVariables(moduleDir string) (map[string]bool, error) {
+	files, err := filepath.Glob(filepath.Join(moduleDir, "*.tf"))
+	if err != nil {
+		return nil, err
+	}
+
+	declared := map[string]bool{}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range variableBlockPattern.FindAllStringSubmatch(string(data), -1) {
+			declared[match[1]] = true
+		}
+	}
+	return declared, nil
+}
+
+// FilterVariables returns the vars a module declares, so inputs added after a release can be
+// passed to that release. The dropped names are returned sorted.
+func FilterVariables(vars map[string]interface{}, declared map[string]bool) (map[string]interface{}, []string) {
+	filtered := map[string]interface{}{}
+	var dropped []string
+	for name, value := range vars {
+		if declared[name] {
+			filtered[name] = value
+		} else {
+			dropped = append(dropped, name)
+		}
+	}
+	sort.Strings(dropped)
+	return filtered, dropped
+}
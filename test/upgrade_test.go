@@ -0,0 +1,121 @@
+package test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func loadPlanDiff(t *testing.T, name string) *PlanDiff {
+	data, err := os.ReadFile(filepath.Join("testdata", "plan", name))
+	require.NoError(t, err)
+	diff, err := ParsePlanDiff(data)
+	require.NoError(t, err)
+	return diff
+}
+
+func TestParsePlanDiff(t *testing.T) {
+	t.Run("Safe", func(t *testing.T) {
+		diff := loadPlanDiff(t, "upgrade-safe.json")
+		require.Len(t, diff.Changes, 7)
+		assert.Empty(t, diff.StatefulDestructive(), "Updates of stateful resources and replacements of stateless ones are allowed")
+		assert.Equal(t, map[string]int{
+			PlanActionCreate:  1,
+			PlanActionUpdate:  3,
+			PlanActionReplace: 1,
+		}, diff.Counts())
+
+		summary := diff.String()
+		assert.Contains(t, summary, "1 to create, 3 to update, 1 to replace, 0 to delete, 0 to forget\n")
+		assert.Contains(t, summary, "replace  module.compute.aws_launch_template.linux_default (replace_because_cannot_update)\n")
+		assert.NotContains(t, summary, "aws_s3_bucket.config", "No-ops are not listed")
+		assert.NotContains(t, summary, "data.aws_region.current", "Data source reads are not listed")
+	})
+
+	t.Run("Destructive", func(t *testing.T) {
+		diff := loadPlanDiff(t, "upgrade-destructive.json")
+		var addresses []string
+		for _, change := range diff.StatefulDestructive() {
+			addresses = append(addresses, change.Address+" "+change.Action)
+		}
+		assert.Equal(t, []string{
+			"module.compute.aws_cloudwatch_log_group.ec2_instances replace", // create_before_destroy
+			"module.core.aws_dynamodb_table.locks delete",
+			"module.storage.aws_s3_bucket.cache replace",
+		}, addresses, "Stateless replacements and forgotten resources are not reported")
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := ParsePlanDiff([]byte("not json"))
+		assert.Error(t, err)
+
+		_, err = ParsePlanDiff([]byte(`{"resource_changes": []}`))
+		assert.ErrorContains(t, err, "format_version")
+
+		_, err = ParsePlanDiff([]byte(`{"format_version": "1.2", "resource_changes": [
+			{"address": "aws_s3_bucket.x", "mode": "managed", "type": "aws_s3_bucket", "change": {"actions": ["create", "update"]}}
+		]}`))
+		assert.ErrorContains(t, err, "aws_s3_bucket.x: unknown plan actions")
+	})
+}
+
+func TestDeclaredVariables(t *testing.T) {
+	declared, err := DeclaredVariables("..")
+	require.NoError(t, err)
+	assert.True(t, declared["stack_name"])
+	assert.True(t, declared["private_mode"])
+	assert.False(t, declared["tags_extra"])
+
+	filtered, dropped := FilterVariables(map[string]interface{}{
+		"stack_name":     "test-upg",
+		"added_later":    true,
+		"another_option": 1,
+	}, declared)
+	assert.Equal(t, map[string]interface{}{"stack_name": "test-upg"}, filtered)
+	assert.Equal(t, []string{"added_later", "another_option"}, dropped)
+}
+
+func TestPreviousGitTag(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	repo := t.TempDir()
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-C", repo, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+	commit := func(content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(repo, "main.tf"), []byte(content), 0o644))
+		git("add", "main.tf")
+		git("commit", "-q", "-m", content)
+	}
+
+	git("init", "-q")
+	commit(`variable "stack_name" {}`)
+	tag, err := PreviousGitTag(repo)
+	require.NoError(t, err)
+	assert.Empty(t, tag, "No tags")
+
+	git("tag", "v1.9.0")
+	commit(`variable "stack_name" {}` + "\n" + `variable "private_mode" {}`)
+	git("tag", "v1.10.0")
+	tag, err = PreviousGitTag(repo)
+	require.NoError(t, err)
+	assert.Equal(t, "v1.9.0", tag, "Tags pointing at HEAD are skipped and versions sort numerically")
+
+	commit(`variable "stack_name" {}`)
+	tag, err = PreviousGitTag(repo)
+	require.NoError(t, err)
+	assert.Equal(t, "v1.10.0", tag)
+
+	dir := ExportGitRef(t, repo, "v1.9.0")
+	declared, err := DeclaredVariables(dir)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"stack_name": true}, declared)
+}
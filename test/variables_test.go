@@ -0,0 +1,118 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// mockPlanVars are valid values for the required inputs of the root module.
+func mockPlanVars(overrides map[string]interface{}) map[string]interface{} {
+	vars := map[string]interface{}{
+		"stack_name":          "test-validation",
+		"github_organization": "test-org",
+		"license_key":         "test-license-key",
+		"vpc_id":              "vpc-0123456789abcdef0",
+		"public_subnet_ids":   []string{"subnet-0123456789abcdef0"},
+		"private_subnet_ids":  []string{"subnet-0fedcba9876543210"},
+	}
+	for name, value := range overrides {
+		vars[name] = value
+	}
+	return vars
+}
+
+// TestVariableValidation plans the root module against mock providers: invalid inputs must fail with
+// their validation message, and valid boundary values must plan cleanly. The app_cpu/app_memory pair
+// is checked by a precondition on the App Runner service instead of a variable validation.
+func TestVariableValidation(t *testing.T) {
+	options := MockPlanModule(t)
+
+	const (
+		privateModeMessage   = "Private mode must be one of: false, true, always, only."
+		privateSubnetMessage = "At least one private subnet ID is required for private networking."
+		spotMessage          = "Spot circuit breaker must be in 'count/window/block' format with positive integers (e.g., '2/15/30')."
+		strategyMessage      = "GitHub API strategy must be one of: normal, conservative."
+		cpuMessage           = "CPU must be one of: 256, 512, 1024, 2048, 4096."
+		memoryMessage        = "Memory must match app_cpu: 256 (512, 1024), 512 (1024), 1024 (2048, 3072, 4096), 2048 (4096, 6144), 4096 (8192, 10240, 12288)."
+		maxRuntimeMessage    = "Runner max runtime must be at least 1 minute."
+		sshCIDRMessage       = "ssh_cidr_range must be a valid IPv4 CIDR block."
+		logRetentionMessage  = "Log retention days must be a valid CloudWatch Logs retention period."
+	)
+
+	cases := []struct {
+		name      string
+		vars      map[string]interface{}
+		wantError string // Empty if the plan should succeed
+	}{
+		// private_mode
+		{"PrivateMode/false", map[string]interface{}{"private_mode": "false", "private_subnet_ids": []string{}}, ""},
+		{"PrivateMode/true", map[string]interface{}{"private_mode": "true"}, ""},
+		{"PrivateMode/always", map[string]interface{}{"private_mode": "always"}, ""},
+		{"PrivateMode/only", map[string]interface{}{"private_mode": "only"}, ""},
+		{"PrivateMode/invalid", map[string]interface{}{"private_mode": "yes"}, privateModeMessage},
+		{"PrivateMode/uppercase", map[string]interface{}{"private_mode": "True"}, privateModeMessage},
+		{"PrivateMode/no-private-subnets", map[string]interface{}{"private_mode": "only", "private_subnet_ids": []string{}}, privateSubnetMessage},
+
+		// spot_circuit_breaker
+		{"SpotCircuitBreaker/default", map[string]interface{}{"spot_circuit_breaker": "2/15/30"}, ""},
+		{"SpotCircuitBreaker/minimum", map[string]interface{}{"spot_circuit_breaker": "1/1/1"}, ""},
+		{"SpotCircuitBreaker/two-parts", map[string]interface{}{"spot_circuit_breaker": "2/15"}, spotMessage},
+		{"SpotCircuitBreaker/zero", map[string]interface{}{"spot_circuit_breaker": "0/15/30"}, spotMessage},
+		{"SpotCircuitBreaker/not-a-number", map[string]interface{}{"spot_circuit_breaker": "a/b/c"}, spotMessage},
+		{"SpotCircuitBreaker/empty", map[string]interface{}{"spot_circuit_breaker": ""}, spotMessage},
+
+		// github_api_strategy
+		{"GithubAPIStrategy/normal", map[string]interface{}{"github_api_strategy": "normal"}, ""},
+		{"GithubAPIStrategy/conservative", map[string]interface{}{"github_api_strategy": "conservative"}, ""},
+		{"GithubAPIStrategy/invalid", map[string]interface{}{"github_api_strategy": "aggressive"}, strategyMessage},
+
+		// app_cpu / app_memory (the pair is a precondition of aws_apprunner_service.this in modules/core)
+		{"AppResources/256-512", map[string]interface{}{"app_cpu": 256, "app_memory": 512}, ""},
+		{"AppResources/256-1024", map[string]interface{}{"app_cpu": 256, "app_memory": 1024}, ""},
+		{"AppResources/512-1024", map[string]interface{}{"app_cpu": 512, "app_memory": 1024}, ""},
+		{"AppResources/1024-4096", map[string]interface{}{"app_cpu": 1024, "app_memory": 4096}, ""},
+		{"AppResources/2048-6144", map[string]interface{}{"app_cpu": 2048, "app_memory": 6144}, ""},
+		{"AppResources/4096-12288", map[string]interface{}{"app_cpu": 4096, "app_memory": 12288}, ""},
+		{"AppResources/256-2048", map[string]interface{}{"app_cpu": 256, "app_memory": 2048}, memoryMessage},
+		{"AppResources/512-512", map[string]interface{}{"app_cpu": 512, "app_memory": 512}, memoryMessage},
+		{"AppResources/4096-4096", map[string]interface{}{"app_cpu": 4096, "app_memory": 4096}, memoryMessage},
+		{"AppResources/invalid-cpu", map[string]interface{}{"app_cpu": 3072, "app_memory": 6144}, cpuMessage},
+
+		// runner_max_runtime
+		{"RunnerMaxRuntime/minimum", map[string]interface{}{"runner_max_runtime": 1}, ""},
+		{"RunnerMaxRuntime/zero", map[string]interface{}{"runner_max_runtime": 0}, maxRuntimeMessage},
+		{"RunnerMaxRuntime/negative", map[string]interface{}{"runner_max_runtime": -5}, maxRuntimeMessage},
+
+		// ssh_cidr_range
+		{"SSHCIDRRange/any", map[string]interface{}{"ssh_cidr_range": "0.0.0.0/0"}, ""},
+		{"SSHCIDRRange/host", map[string]interface{}{"ssh_cidr_range": "203.0.113.10/32"}, ""},
+		{"SSHCIDRRange/prefix-too-long", map[string]interface{}{"ssh_cidr_range": "10.0.0.0/33"}, sshCIDRMessage},
+		{"SSHCIDRRange/no-prefix", map[string]interface{}{"ssh_cidr_range": "10.0.0.1"}, sshCIDRMessage},
+		{"SSHCIDRRange/ipv6", map[string]interface{}{"ssh_cidr_range": "::/0"}, sshCIDRMessage},
+
+		// log_retention_days
+		{"LogRetentionDays/minimum", map[string]interface{}{"log_retention_days": 1}, ""},
+		{"LogRetentionDays/maximum", map[string]interface{}{"log_retention_days": 3653}, ""},
+		{"LogRetentionDays/never-expire", map[string]interface{}{"log_retention_days": 0}, logRetentionMessage},
+		{"LogRetentionDays/unsupported", map[string]interface{}{"log_retention_days": 2}, logRetentionMessage},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			output, err := MockPlan(t, options, mockPlanVars(tc.vars))
+			if tc.wantError == "" {
+				assert.NoError(t, err, "Plan should succeed:\n%s", output)
+				return
+			}
+			if assert.Error(t, err, "Plan should fail with %q", tc.wantError) {
+				assert.Contains(t, normalizeWhitespace(output), tc.wantError)
+				if tc.wantError == memoryMessage {
+					assert.Contains(t, output, "Resource precondition failed", "The CPU/memory pair should fail the App Runner precondition")
+				}
+			}
+		})
+	}
+}
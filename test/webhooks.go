@@ -0,0 +1,354 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	cloudwatchtypes "github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	sqstypes "github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/google/go-github/v68/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// =============================================================================
+// SYNTHETIC WEBHOOK HELPERS
+// =============================================================================
+
+// workflow_job webhook actions, in the order GitHub sends them
+const (
+	WorkflowJobQueued     = "queued"
+	WorkflowJobInProgress = "in_progress"
+	WorkflowJobCompleted  = "completed"
+)
+
+// SyntheticWorkflowJob describes a workflow job replayed as workflow_job webhooks.
+type SyntheticWorkflowJob struct {
+	JobID          int64
+	RunID          int64
+	Repo           string // "owner/repo"
+	InstallationID int64
+	Name           string
+	Labels         []string
+}
+
+// RunsOnLabel returns the runs-on label for a run, e.g. "runs-on=123/runner=2cpu-linux-x64".
+func RunsOnLabel(runID int64, spec string) string {
+	return fmt.Sprintf("runs-on=%d/%s", runID, spec)
+}
+
+// NewSyntheticWorkflowJob creates a job with unique run and job IDs, requesting a RunsOn runner
+// with the given spec (e.g. "runner=2cpu-linux-x64").
+func NewSyntheticWorkflowJob(repo string, installationID int64, spec string) SyntheticWorkflowJob {
+	runID := time.Now().UnixNano() / int64(time.Microsecond)
+	return SyntheticWorkflowJob{
+		JobID:          runID*10 + 1,
+		RunID:          runID,
+		Repo:           repo,
+		InstallationID: installationID,
+		Name:           "synthetic",
+		Labels:         []string{RunsOnLabel(runID, spec)},
+	}
+}
+
+// BuildWorkflowJobWebhook builds the workflow_job webhook payload GitHub sends for action
+// (queued, in_progress or completed). Jobs complete successfully.
+func BuildWorkflowJobWebhook(job SyntheticWorkflowJob, action string, now time.Time) ([]byte, error) {
+	owner, repoName, err := parseRepo(job.Repo)
+	if err != nil {
+		return nil, err
+	}
+
+	created := github.Timestamp{Time: now}
+	workflowJob := &github.WorkflowJob{
+		ID:           github.Ptr(job.JobID),
+		RunID:        github.Ptr(job.RunID),
+		RunAttempt:   github.Ptr(int64(1)),
+		Name:         github.Ptr(job.Name),
+		WorkflowName: github.Ptr("RunsOn webhook replay"),
+		HeadBranch:   github.Ptr("main"),
+		Labels:       job.Labels,
+		CreatedAt:    &created,
+		RunURL:       github.Ptr(fmt.Sprintf("https://api.github.com/repos/%s/actions/runs/%d", job.Repo, job.RunID)),
+		HTMLURL:      github.Ptr(fmt.Sprintf("https://github.com/%s/actions/runs/%d/job/%d", job.Repo, job.RunID, job.JobID)),
+	}
+
+	switch action {
+	case WorkflowJobQueued:
+		workflowJob.Status = github.Ptr("queued")
+	case WorkflowJobInProgress, WorkflowJobCompleted:
+		workflowJob.Status = github.Ptr(action)
+		workflowJob.StartedAt = &created
+		workflowJob.RunnerName = github.Ptr(fmt.Sprintf("runs-on--%d", job.JobID))
+		if action == WorkflowJobCompleted {
+			workflowJob.Conclusion = github.Ptr("success")
+			workflowJob.CompletedAt = &created
+		}
+	default:
+		return nil, fmt.Errorf("unsupported workflow_job action %q", action)
+	}
+
+	event := &github.WorkflowJobEvent{
+		Action:      github.Ptr(action),
+		WorkflowJob: workflowJob,
+		Repo: &github.Repository{
+			Name:     github.Ptr(repoName),
+			FullName: github.Ptr(job.Repo),
+			Private:  github.Ptr(true),
+			Owner:    &github.User{Login: github.Ptr(owner), Type: github.Ptr("Organization")},
+		},
+		Org:    &github.Organization{Login: github.Ptr(owner)},
+		Sender: &github.User{Login: github.Ptr(owner), Type: github.Ptr("Organization")},
+	}
+	if job.InstallationID != 0 {
+		event.Installation = &github.Installation{ID: github.Ptr(job.InstallationID)}
+	}
+
+	return json.Marshal(event)
+}
+
+// SignWebhookPayload returns the X-Hub-Signature-256 header value for payload.
+func SignWebhookPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// newDeliveryID returns a random X-GitHub-Delivery ID in GitHub's UUID format.
+func newDeliveryID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+// SendWebhook POSTs a signed webhook to webhookURL with the headers GitHub sends
+// and returns the response status code.
+func SendWebhook(webhookURL, secret, event string, payload []byte) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GitHub-Hookshot/runs-on-test")
+	req.Header.Set("X-GitHub-Event", event)
+	req.Header.Set("X-GitHub-Delivery", newDeliveryID())
+	req.Header.Set("X-Hub-Signature-256", SignWebhookPayload(secret, payload))
+
+	client := &http.Client{Timeout: 30 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to send %s webhook: %w", event, err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	return resp.StatusCode, nil
+}
+
+// ReplayWorkflowJob sends the given workflow_job actions for job, in order, pausing between
+// actions like GitHub does, and requires every delivery to be accepted (2xx).
+func ReplayWorkflowJob(t *testing.T, webhookURL, secret string, job SyntheticWorkflowJob, pause time.Duration, actions ...string) {
+	for i, action := range actions {
+		if i > 0 {
+			time.Sleep(pause)
+		}
+
+		payload, err := BuildWorkflowJobWebhook(job, action, time.Now())
+		require.NoError(t, err, "Failed to build %s payload", action)
+
+		status, err := SendWebhook(webhookURL, secret, "workflow_job", payload)
+		require.NoError(t, err)
+		require.True(t, status >= 200 && status < 300, "workflow_job %s webhook should be accepted, got status %d", action, status)
+		t.Logf("✓ workflow_job %s delivered for job %d (status %d)", action, job.JobID, status)
+	}
+}
+
+// StackWebhookURL returns the URL the app of a stack receives GitHub webhooks on: its App Runner
+// URL followed by RUNS_ON_TEST_WEBHOOK_PATH (default /webhook).
+func StackWebhookURL(appRunnerURL string) string {
+	path := GetOptionalEnv("RUNS_ON_TEST_WEBHOOK_PATH", "/webhook")
+	return appBaseURL(appRunnerURL) + "/" + strings.TrimPrefix(path, "/")
+}
+
+// stackWebhookTarget returns the URL and secret to replay webhooks to the stack under test with:
+// its own App Runner URL, and the webhook secret of the app registered for it (the credentials in
+// its config bucket). Without an app, the pre-created app (RUNS_ON_TEST_APP_ID etc.) is installed
+// for the stack; its webhook is not repointed, replays go to the stack directly. Skips the test
+// if there is neither.
+func stackWebhookTarget(t *testing.T, appRunnerURL, configBucket string) (string, string) {
+	creds, err := GetStackAppCredentials(configBucket)
+	require.NoError(t, err, "Failed to read the stack's app credentials")
+	if creds == nil {
+		creds, err = GetGitHubAppCredentialsFromEnv()
+		require.NoError(t, err, "Invalid pre-created GitHub App configuration")
+		if creds == nil {
+			t.Skip("No GitHub App registered for the stack and RUNS_ON_TEST_APP_ID not set")
+		}
+		require.NoError(t, InstallGitHubAppCredentials(configBucket, creds), "Failed to install the pre-created app for the stack")
+		t.Logf("✓ Pre-created app %d installed in s3://%s", creds.ID, configBucket)
+	}
+	require.NotEmpty(t, creds.WebhookSecret, "App credentials of the stack have no webhook secret")
+	return StackWebhookURL(appRunnerURL), creds.WebhookSecret
+}
+
+// =============================================================================
+// WEBHOOK EFFECT OBSERVERS
+// =============================================================================
+
+// WaitForQueueActivity waits until the queue shows messages received since 'since': either
+// messages currently visible, in flight or delayed, or a non-zero NumberOfMessagesSent metric
+// (the app usually consumes messages before they can be seen).
+func WaitForQueueActivity(t *testing.T, queueURL string, since time.Time, timeout time.Duration) bool {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	sqsClient := sqs.NewFromConfig(cfg)
+	cwClient := cloudwatch.NewFromConfig(cfg)
+
+	queueName := queueURL[strings.LastIndex(queueURL, "/")+1:]
+	deadline := time.Now().Add(timeout)
+
+	for {
+		attrs, err := sqsClient.GetQueueAttributes(ctx, &sqs.GetQueueAttributesInput{
+			QueueUrl: aws.String(queueURL),
+			AttributeNames: []sqstypes.QueueAttributeName{
+				sqstypes.QueueAttributeNameApproximateNumberOfMessages,
+				sqstypes.QueueAttributeNameApproximateNumberOfMessagesNotVisible,
+				sqstypes.QueueAttributeNameApproximateNumberOfMessagesDelayed,
+			},
+		})
+		if err != nil {
+			t.Logf("Error getting attributes of %s: %v", queueName, err)
+		} else {
+			total := 0
+			for _, value := range attrs.Attributes {
+				n, _ := strconv.Atoi(value)
+				total += n
+			}
+			if total > 0 {
+				t.Logf("✓ Queue %s has %d message(s) visible, in flight or delayed", queueName, total)
+				return true
+			}
+		}
+
+		metrics, err := cwClient.GetMetricStatistics(ctx, &cloudwatch.GetMetricStatisticsInput{
+			Namespace:  aws.String("AWS/SQS"),
+			MetricName: aws.String("NumberOfMessagesSent"),
+			Dimensions: []cloudwatchtypes.Dimension{
+				{Name: aws.String("QueueName"), Value: aws.String(queueName)},
+			},
+			StartTime:  aws.Time(since.Add(-time.Minute)),
+			EndTime:    aws.Time(time.Now()),
+			Period:     aws.Int32(60),
+			Statistics: []cloudwatchtypes.Statistic{cloudwatchtypes.StatisticSum},
+		})
+		if err != nil {
+			t.Logf("Error getting NumberOfMessagesSent for %s: %v", queueName, err)
+		} else {
+			for _, point := range metrics.Datapoints {
+				if aws.ToFloat64(point.Sum) > 0 {
+					t.Logf("✓ Queue %s received %.0f message(s) (NumberOfMessagesSent)", queueName, aws.ToFloat64(point.Sum))
+					return true
+				}
+			}
+		}
+
+		if time.Now().After(deadline) {
+			t.Logf("No activity on queue %s since %s", queueName, since.Format(time.RFC3339))
+			return false
+		}
+		sleepUntilRetry(10*time.Second, deadline)
+	}
+}
+
+// WaitForWorkflowJobItem waits for the workflow-jobs table to hold an item for jobID and
+// returns its attributes.
+func WaitForWorkflowJobItem(t *testing.T, tableName string, jobID int64, timeout time.Duration) map[string]dynamodbtypes.AttributeValue {
+	ctx := context.Background()
+	cfg := MustGetAWSConfig(ctx)
+	client := dynamodb.NewFromConfig(cfg)
+
+	deadline := time.Now().Add(timeout)
+	for {
+		result, err := client.GetItem(ctx, &dynamodb.GetItemInput{
+			TableName: aws.String(tableName),
+			Key: map[string]dynamodbtypes.AttributeValue{
+				"job_id": &dynamodbtypes.AttributeValueMemberN{Value: strconv.FormatInt(jobID, 10)},
+			},
+			ConsistentRead: aws.Bool(true),
+		})
+		if err != nil {
+			t.Logf("Error getting job %d from %s: %v", jobID, tableName, err)
+		} else if len(result.Item) > 0 {
+			t.Logf("✓ Job %d recorded in %s", jobID, tableName)
+			return result.Item
+		}
+
+		if time.Now().After(deadline) {
+			return nil
+		}
+		sleepUntilRetry(5*time.Second, deadline)
+	}
+}
+
+// WaitForRunnerLaunched polls ValidateRunnerLaunched until a runner instance tagged with the
+// stack name is launched after 'since', or the timeout expires.
+func WaitForRunnerLaunched(t *testing.T, stackName string, since time.Time, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for {
+		if ValidateRunnerLaunched(t, stackName, since) {
+			return true
+		}
+		if time.Now().After(deadline) {
+			return false
+		}
+		sleepUntilRetry(15*time.Second, deadline)
+	}
+}
+
+// RunWebhookReplay replays a synthetic job (queued, in_progress, completed) against a deployed
+// stack and verifies the app acted on it: activity on the github and jobs queues, an item in the
+// workflow-jobs table and a runner instance tagged with the stack name.
+// Skips unless an app is registered for the stack or RUNS_ON_TEST_APP_ID is set (see stackWebhookTarget).
+func RunWebhookReplay(t *testing.T, stackName, appRunnerURL, configBucket, githubQueueURL, jobsQueueURL, workflowJobsTable string) {
+	ValidateAppRunnerHealth(t, appRunnerURL, 20)
+	webhookURL, secret := stackWebhookTarget(t, appRunnerURL, configBucket)
+
+	installationID, err := strconv.ParseInt(GetOptionalEnv("RUNS_ON_TEST_APP_INSTALLATION_ID", "0"), 10, 64)
+	require.NoError(t, err, "Invalid RUNS_ON_TEST_APP_INSTALLATION_ID")
+
+	repo := GetOptionalEnv("RUNS_ON_TEST_REPO", "test-org/test-repo")
+	job := NewSyntheticWorkflowJob(repo, installationID, "runner=2cpu-linux-x64")
+	startTime := time.Now()
+
+	t.Logf("Replaying job %d (%s) to %s", job.JobID, job.Labels[0], webhookURL)
+
+	// Deliver queued first, then give the app time to launch a runner before the job "runs"
+	ReplayWorkflowJob(t, webhookURL, secret, job, 0, WorkflowJobQueued)
+
+	assert.True(t, WaitForQueueActivity(t, githubQueueURL, startTime, 5*time.Minute), "github queue should receive the webhook")
+	assert.True(t, WaitForQueueActivity(t, jobsQueueURL, startTime, 5*time.Minute), "jobs queue should receive the job")
+
+	item := WaitForWorkflowJobItem(t, workflowJobsTable, job.JobID, 5*time.Minute)
+	assert.NotNil(t, item, "Job %d should be recorded in %s", job.JobID, workflowJobsTable)
+
+	assert.True(t, WaitForRunnerLaunched(t, stackName, startTime, 5*time.Minute), "Runner instance should have been launched for the synthetic job")
+
+	ReplayWorkflowJob(t, webhookURL, secret, job, 5*time.Second, WorkflowJobInProgress, WorkflowJobCompleted)
+}
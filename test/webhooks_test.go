@@ -0,0 +1,168 @@
+package test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-github/v68/github"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newRegisteredFakeRunsOnApp starts an app stand-in and registers it through the fake manifest flow.
+func newRegisteredFakeRunsOnApp(t *testing.T) *fakeRunsOnApp {
+	t.Setenv("RUNS_ON_TEST_APP_ID", "")
+	gh := newFakeGitHubServer(t, "")
+	app := newFakeRunsOnApp(t, gh, "", fakeTestOrg)
+	require.NoError(t, RegisterGitHubApp(t, GitHubOptions{BaseURL: gh.URL, PollInterval: 10 * time.Millisecond, AppRegistered: app.hasCredentials}, app.URL, ""))
+	return app
+}
+
+func TestSignWebhookPayload(t *testing.T) {
+	// Test vector from GitHub's "Validating webhook deliveries" documentation
+	signature := SignWebhookPayload("It's a Secret to Everybody", []byte("Hello, World!"))
+	assert.Equal(t, "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17", signature)
+
+	payload := []byte(`{"action":"queued"}`)
+	assert.NoError(t, github.ValidateSignature(SignWebhookPayload("secret", payload), payload, []byte("secret")))
+	assert.Error(t, github.ValidateSignature(SignWebhookPayload("other", payload), payload, []byte("secret")))
+}
+
+func TestBuildWorkflowJobWebhook(t *testing.T) {
+	job := SyntheticWorkflowJob{
+		JobID:          1234,
+		RunID:          567,
+		Repo:           "acme/app",
+		InstallationID: 42,
+		Name:           "build",
+		Labels:         []string{RunsOnLabel(567, "runner=2cpu-linux-x64")},
+	}
+	now := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		action     string
+		status     string
+		conclusion string
+		hasRunner  bool
+	}{
+		{WorkflowJobQueued, "queued", "", false},
+		{WorkflowJobInProgress, "in_progress", "", true},
+		{WorkflowJobCompleted, "completed", "success", true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.action, func(t *testing.T) {
+			payload, err := BuildWorkflowJobWebhook(job, tc.action, now)
+			require.NoError(t, err)
+
+			parsed, err := github.ParseWebHook("workflow_job", payload)
+			require.NoError(t, err)
+			event, ok := parsed.(*github.WorkflowJobEvent)
+			require.True(t, ok)
+
+			assert.Equal(t, tc.action, event.GetAction())
+			assert.Equal(t, int64(1234), event.GetWorkflowJob().GetID())
+			assert.Equal(t, int64(567), event.GetWorkflowJob().GetRunID())
+			assert.Equal(t, tc.status, event.GetWorkflowJob().GetStatus())
+			assert.Equal(t, tc.conclusion, event.GetWorkflowJob().GetConclusion())
+			assert.Equal(t, []string{"runs-on=567/runner=2cpu-linux-x64"}, event.GetWorkflowJob().Labels)
+			assert.Equal(t, tc.hasRunner, event.GetWorkflowJob().GetRunnerName() != "")
+			assert.Equal(t, now, event.GetWorkflowJob().GetCreatedAt().Time)
+			assert.Equal(t, "acme/app", event.GetRepo().GetFullName())
+			assert.Equal(t, "acme", event.GetOrg().GetLogin())
+			assert.Equal(t, int64(42), event.GetInstallation().GetID())
+		})
+	}
+
+	t.Run("NoInstallation", func(t *testing.T) {
+		noInstallation := job
+		noInstallation.InstallationID = 0
+		payload, err := BuildWorkflowJobWebhook(noInstallation, WorkflowJobQueued, now)
+		require.NoError(t, err)
+
+		var raw map[string]interface{}
+		require.NoError(t, json.Unmarshal(payload, &raw))
+		assert.NotContains(t, raw, "installation")
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		_, err := BuildWorkflowJobWebhook(job, "waiting", now)
+		assert.Error(t, err)
+
+		badRepo := job
+		badRepo.Repo = "no-owner"
+		_, err = BuildWorkflowJobWebhook(badRepo, WorkflowJobQueued, now)
+		assert.Error(t, err)
+	})
+}
+
+func TestNewSyntheticWorkflowJob(t *testing.T) {
+	job := NewSyntheticWorkflowJob("acme/app", 42, "runner=2cpu-linux-x64")
+	assert.NotZero(t, job.RunID)
+	assert.NotEqual(t, job.RunID, job.JobID)
+	assert.Equal(t, []string{RunsOnLabel(job.RunID, "runner=2cpu-linux-x64")}, job.Labels)
+	assert.Regexp(t, `^runs-on=\d+/runner=2cpu-linux-x64$`, job.Labels[0])
+}
+
+func TestSendWebhookHeaders(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		body, err = github.ValidatePayload(r, []byte("secret"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		got = r
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	status, err := SendWebhook(server.URL, "secret", "workflow_job", []byte(`{"action":"queued"}`))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusAccepted, status)
+	require.NotNil(t, got)
+	assert.Equal(t, "workflow_job", github.WebHookType(got))
+	assert.Regexp(t, `^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`, github.DeliveryID(got))
+	assert.Equal(t, `{"action":"queued"}`, string(body))
+
+	status, err = SendWebhook(server.URL, "wrong", "workflow_job", []byte(`{"action":"queued"}`))
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestReplayWorkflowJob(t *testing.T) {
+	app := newRegisteredFakeRunsOnApp(t)
+	job := NewSyntheticWorkflowJob("acme/app", 42, "runner=2cpu-linux-x64")
+
+	ReplayWorkflowJob(t, app.URL+"/webhook", app.registered().WebhookSecret, job, 0,
+		WorkflowJobQueued, WorkflowJobInProgress, WorkflowJobCompleted)
+
+	events := app.workflowJobEvents()
+	require.Len(t, events, 3)
+	for i, action := range []string{WorkflowJobQueued, WorkflowJobInProgress, WorkflowJobCompleted} {
+		assert.Equal(t, action, events[i].GetAction())
+		assert.Equal(t, job.JobID, events[i].GetWorkflowJob().GetID())
+	}
+
+	// Deliveries signed with another secret are rejected by the app
+	payload, err := BuildWorkflowJobWebhook(job, WorkflowJobQueued, time.Now())
+	require.NoError(t, err)
+	status, err := SendWebhook(app.URL+"/webhook", "not-the-secret", "workflow_job", payload)
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	assert.Len(t, app.workflowJobEvents(), 3)
+}
+
+func TestStackWebhookURL(t *testing.T) {
+	t.Setenv("RUNS_ON_TEST_WEBHOOK_PATH", "")
+	assert.Equal(t, "https://abc123.us-east-1.awsapprunner.com/webhook", StackWebhookURL("abc123.us-east-1.awsapprunner.com"))
+	assert.Equal(t, "http://127.0.0.1:8080/webhook", StackWebhookURL("http://127.0.0.1:8080/"))
+
+	t.Setenv("RUNS_ON_TEST_WEBHOOK_PATH", "github/webhook")
+	assert.Equal(t, "https://abc123.us-east-1.awsapprunner.com/github/webhook", StackWebhookURL("abc123.us-east-1.awsapprunner.com"))
+}
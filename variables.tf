@@ -130,7 +130,7 @@ variable "ssh_cidr_range" {
   default     = "0.0.0.0/0"
 
   validation {
-    condition     = can(cidrhost(var.ssh_cidr_range, 0))
+    condition     = can(cidrhost(var.ssh_cidr_range, 0)) && can(regex("^[0-9.]+/[0-9]+$", var.ssh_cidr_range))
     error_message = "ssh_cidr_range must be a valid IPv4 CIDR block."
   }
 }
@@ -376,6 +376,11 @@ variable "spot_circuit_breaker" {
   description = "Spot instance circuit breaker configuration (e.g., '2/15/30' = 2 failures in 15min, block for 30min)"
   type        = string
   default     = "2/15/30"
+
+  validation {
+    condition     = can(regex("^[1-9][0-9]*/[1-9][0-9]*/[1-9][0-9]*$", var.spot_circuit_breaker))
+    error_message = "Spot circuit breaker must be in 'count/window/block' format with positive integers (e.g., '2/15/30')."
+  }
 }
 
 ###########################